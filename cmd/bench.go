@@ -0,0 +1,429 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initBench() *cobra.Command {
+	var flags struct {
+		method, data      string
+		headers           []string
+		concurrency       int
+		requests          int
+		qps               float64
+		insecure          bool
+		duration, timeout time.Duration
+	}
+	var benchCmd = &cobra.Command{
+		GroupID: getGroupID(CommandBench),
+		Use:     CommandBench + " [url]",
+		Args:    cobra.ExactArgs(1),
+		Short:   "Send load to a HTTP server and report latency percentiles",
+		Run: func(_ *cobra.Command, args []string) {
+			if !common.IsURL(args[0]) {
+				logger.Error(common.ErrInvalidURL.Error(), common.DefaultField(args[0]))
+				printer.Error(common.ErrInvalidURL)
+				return
+			}
+			headers, err := parseHeaders(flags.headers)
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(flags.headers))
+				printer.Error(err)
+				return
+			}
+			b := Bench{
+				Config: common.HTTPConfig{
+					Method:   flags.method,
+					Body:     flags.data,
+					Headers:  headers,
+					Timeout:  flags.timeout,
+					Insecure: flags.insecure,
+				},
+				Concurrency: flags.concurrency,
+				Requests:    flags.requests,
+				Duration:    flags.duration,
+				QPS:         flags.qps,
+			}
+			ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+			defer cancel()
+			result, err := b.Run(ctx, args[0])
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(args[0]))
+				printer.Error(err)
+				return
+			}
+			result.String()
+		},
+		Example: common.Examples(`# Send 1000 requests with 50 workers
+http://127.0.0.1:8080 -n 1000 -c 50
+
+# Keep 100 requests per second for 30 seconds
+http://127.0.0.1:8080 -z 30s --qps 100
+
+# POST JSON and print the result as JSON
+http://127.0.0.1:8080/api -m POST -d '{"a":1}' -H 'Content-Type: application/json' --output json`, CommandBench),
+	}
+	benchCmd.Flags().StringVarP(&flags.method, "method", "m", http.MethodGet, common.Usage("Request method"))
+	benchCmd.Flags().StringVarP(&flags.data, "data", "d", "", common.Usage("Request body, @file reads from file"))
+	benchCmd.Flags().StringArrayVarP(&flags.headers, "headers", "H", nil, common.Usage("Headers, 'Key: Value' or JSON object, can be repeated"))
+	benchCmd.Flags().IntVarP(&flags.concurrency, "concurrency", "c", 10, common.Usage("Number of workers"))
+	benchCmd.Flags().IntVarP(&flags.requests, "requests", "n", 200, common.Usage("Number of requests, ignored if duration is set"))
+	benchCmd.Flags().DurationVarP(&flags.duration, "duration", "z", 0, common.Usage("Send requests for the duration"))
+	benchCmd.Flags().Float64Var(&flags.qps, "qps", 0, common.Usage("Requests per second in total, 0 means unlimited"))
+	benchCmd.Flags().BoolVarP(&flags.insecure, "insecure", "k", false, common.Usage("Skip TLS certificate verification"))
+	benchCmd.Flags().DurationVarP(&flags.timeout, "timeout", "t", 15*time.Second, common.Usage("Timeout of each request"))
+	return benchCmd
+}
+
+type Bench struct {
+	Config      common.HTTPConfig
+	Concurrency int
+	/* Requests is the total requests to send, unless Duration is set. */
+	Requests int
+	Duration time.Duration
+	QPS      float64
+}
+
+/* BenchResult is the report of a run, latencies are in milliseconds. */
+type BenchResult struct {
+	Requests     int64            `json:"requests" yaml:"requests"`
+	Errors       int64            `json:"errors" yaml:"errors"`
+	Duration     float64          `json:"duration" yaml:"duration"`
+	RPS          float64          `json:"rps" yaml:"rps"`
+	BytesPerSec  float64          `json:"bytes_per_sec" yaml:"bytes_per_sec"`
+	Latency      BenchLatency     `json:"latency" yaml:"latency"`
+	Status       map[string]int64 `json:"status" yaml:"status"`
+	ErrorReasons map[string]int64 `json:"error_reasons,omitempty" yaml:"error_reasons,omitempty"`
+}
+
+type BenchLatency struct {
+	Min   float64 `json:"min" yaml:"min"`
+	Mean  float64 `json:"mean" yaml:"mean"`
+	P50   float64 `json:"p50" yaml:"p50"`
+	P75   float64 `json:"p75" yaml:"p75"`
+	P90   float64 `json:"p90" yaml:"p90"`
+	P95   float64 `json:"p95" yaml:"p95"`
+	P99   float64 `json:"p99" yaml:"p99"`
+	P999  float64 `json:"p99.9" yaml:"p99.9"`
+	Max   float64 `json:"max" yaml:"max"`
+	Stdev float64 `json:"stdev" yaml:"stdev"`
+}
+
+/* benchWorker collects results of a worker, so workers never share a lock. */
+type benchWorker struct {
+	hist    latencyHistogram
+	bytes   int64
+	errors  int64
+	status  map[int]int64
+	reasons map[string]int64
+}
+
+func (b *Bench) Run(ctx context.Context, url string) (*BenchResult, error) {
+	if b.Concurrency <= 0 || (b.Requests <= 0 && b.Duration <= 0) || b.QPS < 0 {
+		return nil, common.ErrInvalidArg
+	}
+	client, err := b.Config.Client()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := client.Transport.(*http.Transport); ok {
+		t.MaxIdleConnsPerHost = b.Concurrency
+	}
+	defer client.CloseIdleConnections()
+	/* Read the body of @file or @- once, workers would read the file in the timed requests and race on stdin. */
+	if err = b.Config.ReadBody(); err != nil {
+		return nil, err
+	}
+	/* Check the request once, so that a bad config fails before the run. */
+	if _, err = b.Config.NewRequest(ctx, url); err != nil {
+		return nil, err
+	}
+
+	jobs := make(chan struct{})
+	workers := make([]*benchWorker, b.Concurrency)
+	var wg sync.WaitGroup
+	for i := range workers {
+		w := &benchWorker{status: make(map[int]int64), reasons: make(map[string]int64)}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				b.request(ctx, client, url, w)
+			}
+		}()
+	}
+
+	start := time.Now()
+	b.produce(ctx, jobs)
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	result := &BenchResult{
+		Duration:     elapsed.Seconds(),
+		Status:       make(map[string]int64),
+		ErrorReasons: make(map[string]int64),
+	}
+	var hist latencyHistogram
+	var transferred int64
+	for _, w := range workers {
+		hist.merge(&w.hist)
+		transferred += w.bytes
+		result.Errors += w.errors
+		for k, v := range w.status {
+			result.Status[strconv.Itoa(k)] += v
+		}
+		for k, v := range w.reasons {
+			result.ErrorReasons[k] += v
+		}
+	}
+	result.Requests = hist.total + result.Errors
+	result.RPS = float64(result.Requests) / elapsed.Seconds()
+	result.BytesPerSec = float64(transferred) / elapsed.Seconds()
+	ms := func(us float64) float64 { return math.Round(us) / 1000 }
+	result.Latency = BenchLatency{
+		Min:   ms(float64(hist.min)),
+		Mean:  ms(hist.mean()),
+		P50:   ms(hist.percentile(50)),
+		P75:   ms(hist.percentile(75)),
+		P90:   ms(hist.percentile(90)),
+		P95:   ms(hist.percentile(95)),
+		P99:   ms(hist.percentile(99)),
+		P999:  ms(hist.percentile(99.9)),
+		Max:   ms(float64(hist.max)),
+		Stdev: ms(hist.stdev()),
+	}
+	return result, nil
+}
+
+/* produce hands out requests until Requests are sent or Duration ends, at the pace of QPS. */
+func (b *Bench) produce(ctx context.Context, jobs chan<- struct{}) {
+	var deadline <-chan time.Time
+	if b.Duration > 0 {
+		timer := time.NewTimer(b.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var tick <-chan time.Time
+	if b.QPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.QPS))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for i := 0; b.Duration > 0 || i < b.Requests; i++ {
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline:
+				return
+			case <-tick:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case jobs <- struct{}{}:
+		}
+	}
+}
+
+func (b *Bench) request(ctx context.Context, client *http.Client, url string, w *benchWorker) {
+	start := time.Now()
+	resp, err := b.Config.Do(ctx, client, url)
+	if err == nil {
+		var n int64
+		n, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		w.bytes += n
+	}
+	if ctx.Err() != nil {
+		/* Interrupted, the request is not a failure of the server. */
+		return
+	}
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(url))
+		w.errors++
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		w.reasons[err.Error()]++
+		return
+	}
+	w.hist.record(time.Since(start).Microseconds())
+	w.status[resp.StatusCode]++
+}
+
+func (r *BenchResult) String() {
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, r)
+		return
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	format := printer.SetTableAsDefaultFormat(rootOutputFormat)
+
+	printer.Printf(format, []string{"Requests", "Errors", "Duration", "Requests/sec", "Transfer/sec"}, [][]string{{
+		strconv.FormatInt(r.Requests, 10), strconv.FormatInt(r.Errors, 10),
+		f(r.Duration) + "s", f(r.RPS), common.ByteSize(r.BytesPerSec),
+	}})
+	printer.Printf("\n")
+	l := r.Latency
+	printer.Printf(format, []string{"Min", "Mean", "Stdev", "P50", "P75", "P90", "P95", "P99", "P99.9", "Max"}, [][]string{{
+		f(l.Min) + "ms", f(l.Mean) + "ms", f(l.Stdev) + "ms", f(l.P50) + "ms", f(l.P75) + "ms",
+		f(l.P90) + "ms", f(l.P95) + "ms", f(l.P99) + "ms", f(l.P999) + "ms", f(l.Max) + "ms",
+	}})
+
+	var data [][]string
+	for k, v := range r.Status {
+		data = append(data, []string{k, strconv.FormatInt(v, 10)})
+	}
+	for k, v := range r.ErrorReasons {
+		data = append(data, []string{k, strconv.FormatInt(v, 10)})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i][0] < data[j][0] })
+	if len(data) != 0 {
+		printer.Printf("\n")
+		printer.Printf(format, []string{"Status", "Count"}, data)
+	}
+}
+
+/* histogramSubBits gives 128 linear sub-buckets per power of two, a relative error below 1%. */
+const histogramSubBits = 7
+
+/* latencyHistogram is a log-linear histogram in the style of HdrHistogram, values are microseconds. */
+type latencyHistogram struct {
+	counts   []int64
+	total    int64
+	min, max int64
+	sum      float64
+	sumSq    float64
+}
+
+func (*latencyHistogram) index(v int64) int {
+	const sub = 1 << histogramSubBits
+	if v < sub {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histogramSubBits - 1
+	return sub + shift*sub + int(v>>shift) - sub
+}
+
+/* value returns the middle of the bucket at index i. */
+func (*latencyHistogram) value(i int) float64 {
+	const sub = 1 << histogramSubBits
+	if i < sub {
+		return float64(i)
+	}
+	shift := (i - sub) / sub
+	lower := int64((i-sub)%sub+sub) << shift
+	return float64(lower) + float64(int64(1)<<shift)/2
+}
+
+func (h *latencyHistogram) record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	i := h.index(v)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i-len(h.counts)+1)...)
+	}
+	h.counts[i]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+}
+
+func (h *latencyHistogram) merge(o *latencyHistogram) {
+	if o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(o.counts)-len(h.counts))...)
+	}
+	for i, v := range o.counts {
+		h.counts[i] += v
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+	h.sumSq += o.sumSq
+}
+
+func (h *latencyHistogram) percentile(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p / 100 * float64(h.total)))
+	var count int64
+	for i, v := range h.counts {
+		count += v
+		if count >= target {
+			return math.Min(math.Max(h.value(i), float64(h.min)), float64(h.max))
+		}
+	}
+	return float64(h.max)
+}
+
+func (h *latencyHistogram) mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+func (h *latencyHistogram) stdev() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	mean := h.mean()
+	return math.Sqrt(math.Max(h.sumSq/float64(h.total)-mean*mean, 0))
+}
@@ -18,6 +18,7 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"io"
@@ -47,7 +48,7 @@ func initCert() *cobra.Command {
 			case common.IsFile(input):
 				resp, err = resp.CheckFile(input)
 			case common.IsDomain(input) || common.IsIPv4(input):
-				resp, err = resp.CheckHost(net.JoinHostPort(input, flags.port))
+				resp, err = resp.CheckHost(common.Context, net.JoinHostPort(input, flags.port))
 			default:
 				logger.Error(common.ErrInvalidArg.Error(), common.DefaultField(input))
 				return
@@ -111,13 +112,15 @@ type Cert struct {
 	DNS        []string `json:"dns,omitempty" yaml:"dns,omitempty"`
 }
 
-func (c *Cert) CheckHost(host string) (*Cert, error) {
-	conn, err := tls.Dial("tcp", host, nil)
+/* CheckHost reads the certificate of host, the dial and the handshake stop when ctx is done. */
+func (c *Cert) CheckHost(ctx context.Context, host string) (*Cert, error) {
+	raw, err := new(tls.Dialer).DialContext(ctx, "tcp", host)
 	if err != nil {
 		logger.Debug(err.Error(), common.NewField("host", host))
 		return nil, err
 	}
-	defer conn.Close()
+	defer raw.Close()
+	conn := raw.(*tls.Conn)
 
 	cert := conn.ConnectionState().PeerCertificates[0]
 	dayRemain := cert.NotAfter.Local().Sub(common.TimeNow)
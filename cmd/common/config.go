@@ -64,10 +64,15 @@ func (r *readConfig) get() (map[string]any, error) {
 
 /* Get secret token and other settings from config. */
 func Config(path, table string) map[string]any {
-	r := &readConfig{path: path, table: table}
-	v, err := r.get()
+	v, err := ConfigTable(path, table)
 	if err != nil {
 		stdLogger.Log.Fatal(err.Error(), NewField("path", path), NewField("table", table))
 	}
 	return v
 }
+
+/* ConfigTable is Config returning the error instead of exiting. */
+func ConfigTable(path, table string) (map[string]any, error) {
+	r := &readConfig{path: path, table: table}
+	return r.get()
+}
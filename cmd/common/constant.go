@@ -29,11 +29,20 @@ const (
 )
 
 const (
-	JSONFormat  = "json"
-	NoneFormat  = "none"
-	TableFormat = "table"
-	TomlFormat  = "toml"
-	YamlFormat  = "yaml"
+	CSVFormat      = "csv"
+	JSONFormat     = "json"
+	MarkdownFormat = "markdown"
+	NDJSONFormat   = "ndjson"
+	NoneFormat     = "none"
+	TableFormat    = "table"
+	TomlFormat     = "toml"
+	YamlFormat     = "yaml"
+)
+
+const (
+	HTTPAuthBasic  = "basic"
+	HTTPAuthBearer = "bearer"
+	HTTPAuthDigest = "digest"
 )
 
 const (
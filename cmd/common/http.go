@@ -17,12 +17,28 @@ limitations under the License.
 package common
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
@@ -33,57 +49,522 @@ type HTTPConfig struct {
 	Body    string
 	Verbose bool
 	Headers string
-}
+	/* RawBody is sent as is if it is not nil, Body, Form and Multipart are ignored. */
+	RawBody []byte
 
-/* HttpRequestContent make a simple request to url, and return response body, default request method is get. */
-func HTTPRequestContent(url string, config ...HTTPConfig) ([]byte, error) {
-	if len(config) == 0 {
-		config = append(config, HTTPConfig{Method: http.MethodGet})
-	}
+	/* Auth is user:password for basic and digest auth, or the token for bearer auth. */
+	Auth     string
+	AuthType string
+	/* Form fields are key=value, Multipart fields may also be key=@file. */
+	Form      []string
+	Multipart []string
+	/* CookieJar is a file to load cookies from and save cookies to. */
+	CookieJar string
+	Timeout   time.Duration
+	/* Stream limits Timeout to dialing, the TLS handshake and the response headers, so reading a long body like a download is not cut off. */
+	Stream bool
+	Retry  int
+	/* RetryUnsafe also retries 5xx of methods which are not idempotent like POST, which may repeat their side effects. */
+	RetryUnsafe bool
+	Insecure    bool
+	CACert      string
+	/* Proxy overrides HTTP_PROXY, HTTPS_PROXY and ALL_PROXY, supports http, https and socks5. */
+	Proxy string
 
-	var client = &http.Client{
-		Timeout: 15 * time.Second,
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 5 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
+	/* contentType is the type of RawBody read from Form or Multipart. */
+	contentType string
+}
+
+/* NewRequest creates a request with the method, body, headers and auth of c, Body of @file is read from file. */
+func (c HTTPConfig) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	body, contentType := c.RawBody, c.contentType
+	if body == nil {
+		var err error
+		if body, contentType, err = c.body(); err != nil {
+			return nil, err
+		}
 	}
-	body := strings.NewReader(config[0].Body)
-	req, err := http.NewRequestWithContext(Context, config[0].Method, url, body)
+	req, err := http.NewRequestWithContext(ctx, c.Method, url, bytes.NewReader(body))
 	if err != nil {
 		stdLogger.Log.Debug(err.Error(),
-			NewField("method", config[0].Method),
+			NewField("method", c.Method),
 			NewField("url", url),
-			NewField("body", body),
+			NewField("body", string(body)),
 		)
 		return nil, err
 	}
-	if config[0].Headers != "" {
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Headers != "" {
 		header := make(map[string]string, 0)
-		err = json.Unmarshal([]byte(config[0].Headers), &header)
+		err = json.Unmarshal([]byte(c.Headers), &header)
 		if err != nil {
-			stdLogger.Log.Debug(err.Error(), NewField("data", config[0].Headers))
+			stdLogger.Log.Debug(err.Error(), NewField("data", c.Headers))
 			return nil, err
 		}
 		for k, v := range header {
 			req.Header.Set(k, v)
 		}
 	}
+	switch strings.ToLower(c.AuthType) {
+	case "", HTTPAuthBasic:
+		if user, password, ok := strings.Cut(c.Auth, ":"); ok {
+			req.SetBasicAuth(user, password)
+		}
+	case HTTPAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+c.Auth)
+	case HTTPAuthDigest:
+		/* Answered after the 401 challenge in Do. */
+	default:
+		stdLogger.Log.Debug(ErrInvalidArg.Error(), NewField("auth-type", c.AuthType))
+		return nil, ErrInvalidArg
+	}
+	return req, nil
+}
+
+/* ReadBody reads Body, Form or Multipart into RawBody, so every request sent with c has the body of @file or @- without reading it again. */
+func (c *HTTPConfig) ReadBody() error {
+	if c.RawBody != nil {
+		return nil
+	}
+	var err error
+	if c.RawBody, c.contentType, err = c.body(); err != nil {
+		return err
+	}
+	if c.RawBody == nil {
+		c.RawBody = []byte{}
+	}
+	return nil
+}
+
+func (c HTTPConfig) body() ([]byte, string, error) {
+	switch {
+	case len(c.Multipart) != 0:
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for _, v := range c.Multipart {
+			key, value, _ := strings.Cut(v, "=")
+			if !strings.HasPrefix(value, "@") {
+				if err := w.WriteField(key, value); err != nil {
+					return nil, "", err
+				}
+				continue
+			}
+			f, err := os.Open(value[1:])
+			if err != nil {
+				stdLogger.Log.Debug(err.Error(), DefaultField(value))
+				return nil, "", err
+			}
+			part, err := w.CreateFormFile(key, filepath.Base(value[1:]))
+			if err == nil {
+				_, err = io.Copy(part, f)
+			}
+			f.Close()
+			if err != nil {
+				stdLogger.Log.Debug(err.Error(), DefaultField(value))
+				return nil, "", err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), w.FormDataContentType(), nil
+	case len(c.Form) != 0:
+		form := make(url.Values)
+		for _, v := range c.Form {
+			key, value, _ := strings.Cut(v, "=")
+			form.Add(key, value)
+		}
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	case strings.HasPrefix(c.Body, "@"):
+		var b []byte
+		var err error
+		if c.Body == "@-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(c.Body[1:])
+		}
+		if err != nil {
+			stdLogger.Log.Debug(err.Error(), DefaultField(c.Body))
+			return nil, "", err
+		}
+		return b, "", nil
+	}
+	return []byte(c.Body), "", nil
+}
+
+/* Client creates a client with the timeout, TLS, proxy and cookie settings of c. */
+func (c HTTPConfig) Client() (*http.Client, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	/* #nosec G402 -- enabled by --insecure only. */
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.Insecure}
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			stdLogger.Log.Debug(err.Error(), DefaultField(c.CACert))
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			stdLogger.Log.Debug(ErrInvalidFile.Error(), DefaultField(c.CACert))
+			return nil, ErrInvalidFile
+		}
+		tlsConfig.RootCAs = pool
+	}
+	proxy, err := c.proxy()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 5 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	if c.Stream {
+		client.Timeout = 0
+		transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 5 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = timeout
+		transport.ResponseHeaderTimeout = timeout
+	}
+	if c.CookieJar != "" {
+		if client.Jar, err = loadHTTPCookieJar(c.CookieJar); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+/* proxy honours ALL_PROXY as well, which http.ProxyFromEnvironment ignores. */
+func (c HTTPConfig) proxy() (func(*http.Request) (*url.URL, error), error) {
+	proxy := c.Proxy
+	if proxy == "" {
+		proxy = getenv("ALL_PROXY", "all_proxy")
+		if proxy == "" {
+			return http.ProxyFromEnvironment, nil
+		}
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(proxy))
+		return nil, err
+	}
+	if c.Proxy != "" {
+		return http.ProxyURL(u), nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		p, err := http.ProxyFromEnvironment(req)
+		if p != nil || err != nil || noProxy(req.URL.Hostname()) {
+			return p, err
+		}
+		return u, nil
+	}, nil
+}
+
+func getenv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+/* noProxy reports whether host matches NO_PROXY, or is a loopback address. */
+func noProxy(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, v := range strings.Split(getenv("NO_PROXY", "no_proxy"), ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), ".")
+		switch {
+		case v == "":
+			continue
+		case v == "*", v == host, strings.HasSuffix(host, "."+v):
+			return true
+		}
+		if _, ipnet, err := net.ParseCIDR(v); err == nil && ip != nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/* Do sends the request, answers a digest challenge and retries network errors, 429 and 5xx of idempotent methods with backoff. */
+func (c HTTPConfig) Do(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	/* The body is read once, so @- of stdin is sent again by retries and the answer of a digest challenge. */
+	if err := c.ReadBody(); err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, client, url)
+		var retry bool
+		if err != nil {
+			retry = ctx.Err() == nil && httpRetryable(err)
+		} else {
+			retry = resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode >= 500 && (c.RetryUnsafe || httpIdempotent(c.Method)))
+		}
+		if !retry || attempt >= c.Retry {
+			if jar, ok := client.Jar.(*httpCookieJar); ok && err == nil {
+				if err := jar.save(); err != nil {
+					return resp, err
+				}
+			}
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		backoff := time.Second << attempt
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+		stdLogger.Log.Debug("retry", NewField("attempt", attempt+1), NewField("backoff", backoff.String()))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+/* httpRetryable reports whether err of a request is of the network and may not happen again, like a refused connection or a timeout. */
+func httpRetryable(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var unknownErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &unknownErr) || errors.As(err, &hostErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+/* httpIdempotent reports whether sending a request of method again has the same effect as once. */
+func httpIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (c HTTPConfig) do(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := c.NewRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Do(req)
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(req))
+		return nil, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.EqualFold(c.AuthType, HTTPAuthDigest) ||
+		!strings.HasPrefix(strings.ToLower(challenge), HTTPAuthDigest) {
+		return resp, nil
+	}
+	resp.Body.Close()
+	if req, err = c.NewRequest(ctx, url); err != nil {
+		return nil, err
+	}
+	auth, err := digestAuthorization(challenge, req.Method, req.URL.RequestURI(), c.Auth)
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(challenge))
+		return nil, err
+	}
+	req.Header.Set("Authorization", auth)
+	return client.Do(req)
+}
+
+/* digestAuthorization answers a RFC 7616 challenge with MD5 or SHA-256 and qop auth. */
+func digestAuthorization(challenge, method, uri, userPassword string) (string, error) {
+	user, password, ok := strings.Cut(userPassword, ":")
+	if !ok {
+		return "", ErrInvalidArg
+	}
+	params := make(map[string]string)
+	_, rest, _ := strings.Cut(challenge, " ")
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	var h func(string) string
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		/* #nosec G401 -- required by the digest scheme. */
+		h = func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+	case "SHA-256":
+		h = func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+	default:
+		return "", ErrInvalidArg
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(b)
+	const nc = "00000001"
+
+	realm, nonce := params["realm"], params["nonce"]
+	ha1 := h(user + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	var qop string
+	for _, v := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(v) == "auth" {
+			qop = "auth"
+		}
+	}
+	response := h(ha1 + ":" + nonce + ":" + ha2)
+	if qop != "" {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		user, realm, nonce, uri, algorithm, response)
+	if qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque, ok := params["opaque"]; ok {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return auth, nil
+}
+
+/* httpCookieJar keeps every cookie it is given, so that they can be saved to a JSON file. */
+type httpCookieJar struct {
+	*cookiejar.Jar
+
+	path    string
+	mu      sync.Mutex
+	cookies map[string][]*http.Cookie
+}
+
+func loadHTTPCookieJar(path string) (*httpCookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	j := &httpCookieJar{Jar: jar, path: path, cookies: make(map[string][]*http.Cookie)}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(path))
+		return nil, err
+	}
+	cookies := make(map[string][]*http.Cookie)
+	if len(b) != 0 {
+		if err = json.Unmarshal(b, &cookies); err != nil {
+			stdLogger.Log.Debug(err.Error(), DefaultField(path))
+			return nil, err
+		}
+	}
+	for k, v := range cookies {
+		u, err := url.Parse(k)
+		if err != nil {
+			continue
+		}
+		j.SetCookies(u, v)
+	}
+	return j, nil
+}
+
+func (j *httpCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := u.Scheme + "://" + u.Host
+	for _, c := range cookies {
+		kept := j.cookies[key][:0]
+		for _, v := range j.cookies[key] {
+			if v.Name != c.Name || v.Path != c.Path || v.Domain != c.Domain {
+				kept = append(kept, v)
+			}
+		}
+		j.cookies[key] = append(kept, c)
+	}
+}
+
+func (j *httpCookieJar) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	b, err := json.MarshalIndent(j.cookies, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(j.path, b, 0600); err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(j.path))
+	}
+	return err
+}
+
+/* HttpRequestContent make a simple request to url, and return response body, default request method is get. */
+func HTTPRequestContent(url string, config ...HTTPConfig) ([]byte, error) {
+	if len(config) == 0 {
+		config = append(config, HTTPConfig{Method: http.MethodGet})
+	}
+
+	client, err := config[0].Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := config[0].Do(Context, client, url)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 	if err != nil {
-		stdLogger.Log.Debug(err.Error(), DefaultField(req))
 		return nil, err
 	}
 	if config[0].Verbose {
-		reqDump, err := httputil.DumpRequestOut(req, true)
+		req := resp.Request
+		if req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+		reqDump, err := httputil.DumpRequestOut(req, req.GetBody != nil)
 		if err != nil {
 			stdLogger.Log.Debug(err.Error(), DefaultField(req))
 			return nil, err
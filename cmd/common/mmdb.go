@@ -0,0 +1,312 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"strconv"
+)
+
+const (
+	mmdbMetadataMarker = "\xab\xcd\xefMaxMind.com"
+	mmdbDataSeparator  = 16
+)
+
+/* MMDB reads MaxMind DB files (GeoLite2/GeoIP2 City, Country and ASN). */
+type MMDB struct {
+	DatabaseType string
+
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+/* OpenMMDB loads the whole database file into memory. */
+func OpenMMDB(path string) (*MMDB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(path))
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, []byte(mmdbMetadataMarker))
+	if i == -1 {
+		stdLogger.Log.Debug(ErrInvalidFile.Error(), DefaultField(path))
+		return nil, ErrInvalidFile
+	}
+	metadata := &mmdbDecoder{buf: buf[i+len(mmdbMetadataMarker):]}
+	v, _, err := metadata.decode(0)
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(path))
+		return nil, err
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidFile
+	}
+	m := &MMDB{
+		buf:        buf,
+		nodeCount:  mmdbUint(meta["node_count"]),
+		recordSize: mmdbUint(meta["record_size"]),
+		ipVersion:  mmdbUint(meta["ip_version"]),
+	}
+	m.DatabaseType, _ = meta["database_type"].(string)
+	if m.recordSize != 24 && m.recordSize != 28 && m.recordSize != 32 {
+		stdLogger.Log.Debug(ErrInvalidFile.Error(), NewField("record_size", m.recordSize))
+		return nil, ErrInvalidFile
+	}
+	treeSize := int(m.recordSize * 2 / 8 * m.nodeCount)
+	if treeSize+mmdbDataSeparator > i {
+		return nil, ErrInvalidFile
+	}
+	m.data = buf[treeSize+mmdbDataSeparator : i]
+
+	/* IPv4 addresses live under ::/96 in an IPv6 tree. */
+	if m.ipVersion == 6 {
+		for j := 0; j < 96 && m.ipv4Start < m.nodeCount; j++ {
+			m.ipv4Start = m.record(m.ipv4Start, 0)
+		}
+	}
+	return m, nil
+}
+
+/* Lookup returns the record of ip, or nil if ip is not in the database. */
+func (m *MMDB) Lookup(ip net.IP) (map[string]any, error) {
+	node := uint(0)
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+		node = m.ipv4Start
+	} else if m.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < bits && node < m.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = m.record(node, bit)
+	}
+	if node <= m.nodeCount {
+		return nil, nil
+	}
+	offset := int(node-m.nodeCount) - mmdbDataSeparator
+	d := &mmdbDecoder{buf: m.data}
+	v, _, err := d.decode(offset)
+	if err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(ip))
+		return nil, err
+	}
+	record, _ := v.(map[string]any)
+	return record, nil
+}
+
+/* record returns the left (bit 0) or right (bit 1) record of node. */
+func (m *MMDB) record(node, bit uint) uint {
+	b := m.buf[node*m.recordSize/4:]
+	switch m.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+/* mmdbDecoder decodes the MaxMind DB data section format. */
+type mmdbDecoder struct {
+	buf []byte
+	/* depth counts the nested values and pointers being decoded, a pointer to itself would never end. */
+	depth int
+}
+
+/* mmdbMaxDepth is the deepest nesting of values and pointers decoded. */
+const mmdbMaxDepth = 512
+
+func (d *mmdbDecoder) decode(offset int) (any, int, error) {
+	if offset < 0 || offset >= len(d.buf) {
+		return nil, 0, ErrInvalidFile
+	}
+	if d.depth >= mmdbMaxDepth {
+		stdLogger.Log.Debug(ErrInvalidFile.Error(), NewField("depth", d.depth))
+		return nil, 0, ErrInvalidFile
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	ctrl := d.buf[offset]
+	offset++
+	typ := int(ctrl >> 5)
+	if typ == 1 {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(pointer)
+		return v, next, err
+	}
+	if typ == 0 {
+		if offset >= len(d.buf) {
+			return nil, 0, ErrInvalidFile
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case 7:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			var k, v any
+			if k, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			if v, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			key, _ := k.(string)
+			m[key] = v
+		}
+		return m, offset, nil
+	case 11:
+		a := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			var v any
+			if v, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case 14:
+		return size != 0, offset, nil
+	}
+	if offset+size > len(d.buf) {
+		return nil, 0, ErrInvalidFile
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+	switch typ {
+	case 2:
+		return string(b), offset, nil
+	case 3:
+		if size != 8 {
+			return nil, 0, ErrInvalidFile
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 4:
+		return append([]byte(nil), b...), offset, nil
+	case 5, 6, 9, 10:
+		var n uint64
+		for _, v := range b {
+			n = n<<8 | uint64(v)
+		}
+		return n, offset, nil
+	case 8:
+		var n uint32
+		for _, v := range b {
+			n = n<<8 | uint32(v)
+		}
+		return int64(int32(n)), offset, nil
+	case 15:
+		if size != 4 {
+			return nil, 0, ErrInvalidFile
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	}
+	return nil, offset, nil
+}
+
+func (d *mmdbDecoder) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	n := size - 28
+	if offset+n > len(d.buf) {
+		return 0, 0, ErrInvalidFile
+	}
+	var v int
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | int(b)
+	}
+	switch n {
+	case 1:
+		size = 29 + v
+	case 2:
+		size = 285 + v
+	default:
+		size = 65821 + v
+	}
+	return size, offset + n, nil
+}
+
+func (d *mmdbDecoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int((ctrl>>3)&0x3) + 1
+	if offset+n > len(d.buf) {
+		return 0, 0, ErrInvalidFile
+	}
+	v := int(ctrl & 0x7)
+	if n == 4 {
+		v = 0
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | int(b)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+func mmdbUint(v any) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
+
+/* MMDBString walks the nested maps of a record, e.g. MMDBString(r, "city", "names", "en"). */
+func MMDBString(record map[string]any, keys ...string) string {
+	var v any = record
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	switch data := v.(type) {
+	case string:
+		return data
+	case uint64:
+		return strconv.FormatUint(data, 10)
+	}
+	return ""
+}
@@ -18,6 +18,7 @@ package common
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -37,6 +38,8 @@ type printer struct {
 	align   int
 	/* JSON and yaml args. */
 	indent int
+	/* err is set if data could not be printed in the format. */
+	err error
 }
 
 func (p *printer) Printf(format string, a ...any) {
@@ -56,32 +59,25 @@ func (p *printer) Printf(format string, a ...any) {
 		}
 	case JSONFormat:
 		p.json(a...)
+	case NDJSONFormat:
+		p.ndjson(a...)
 	case NoneFormat:
-	case TableFormat:
-		if len(a) == 1 {
-			data, ok := a[0].([][]string)
-			if ok {
-				p.table(nil, data)
-			}
+	case CSVFormat, MarkdownFormat, TableFormat:
+		header, data, ok := p.tableArgs(a...)
+		if !ok {
+			/* Commands printing structured data only support json, ndjson and yaml. */
+			p.err = fmt.Errorf("%w: output %s is not supported by this command, use %s/%s/%s", ErrInvalidArg, format, JSONFormat, NDJSONFormat, YamlFormat)
+			p.Error(p.err)
 			return
 		}
-
-		/* Assume a[0] is header. */
-		h1, ok1 := a[0].([]string)
-		d1, ok2 := a[1].([][]string)
-		if ok1 && ok2 {
-			p.table(h1, d1)
-			return
-		}
-
-		/* Assume a[1] is header. */
-		h2, ok3 := a[1].([]string)
-		d2, ok4 := a[0].([][]string)
-		if ok3 && ok4 {
-			p.table(h2, d2)
-			return
+		switch format {
+		case CSVFormat:
+			p.csv(header, data)
+		case MarkdownFormat:
+			p.markdown(header, data)
+		default:
+			p.table(header, data)
 		}
-		p.Error(ErrInvalidArg)
 	case YamlFormat:
 		p.yaml(a...)
 	default:
@@ -112,6 +108,18 @@ func (p *printer) json(a ...any) {
 	}
 }
 
+/* ndjson prints every argument as a single line of JSON. */
+func (*printer) ndjson(a ...any) {
+	for _, i := range a {
+		b, err := json.Marshal(i)
+		if err != nil {
+			stdLogger.Log.Debug(err.Error())
+			return
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", b)
+	}
+}
+
 func (p *printer) yaml(a ...any) {
 	for _, i := range a {
 		var buf bytes.Buffer
@@ -125,6 +133,66 @@ func (p *printer) yaml(a ...any) {
 	}
 }
 
+/* tableArgs accepts data, header and data, or data and header. */
+func (*printer) tableArgs(a ...any) ([]string, [][]string, bool) {
+	if len(a) == 1 {
+		data, ok := a[0].([][]string)
+		return nil, data, ok
+	}
+	if len(a) != 2 {
+		return nil, nil, false
+	}
+
+	/* Assume a[0] is header. */
+	h1, ok1 := a[0].([]string)
+	d1, ok2 := a[1].([][]string)
+	if ok1 && ok2 {
+		return h1, d1, true
+	}
+
+	/* Assume a[1] is header. */
+	h2, ok3 := a[1].([]string)
+	d2, ok4 := a[0].([][]string)
+	if ok3 && ok4 {
+		return h2, d2, true
+	}
+	return nil, nil, false
+}
+
+func (*printer) csv(header []string, data [][]string) {
+	w := csv.NewWriter(os.Stdout)
+	if header != nil {
+		if err := w.Write(header); err != nil {
+			stdLogger.Log.Debug(err.Error())
+			return
+		}
+	}
+	if err := w.WriteAll(data); err != nil {
+		stdLogger.Log.Debug(err.Error())
+	}
+}
+
+func (*printer) markdown(header []string, data [][]string) {
+	if header == nil && len(data) != 0 {
+		header, data = data[0], data[1:]
+	}
+	escape := strings.NewReplacer("|", `\|`, "\n", "<br>")
+	row := func(cells []string) string {
+		var out []string
+		for _, v := range cells {
+			out = append(out, escape.Replace(v))
+		}
+		return "| " + strings.Join(out, " | ") + " |\n"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(row(header))
+	buf.WriteString("|" + strings.Repeat("---|", len(header)) + "\n")
+	for _, v := range data {
+		buf.WriteString(row(v))
+	}
+	fmt.Fprintf(os.Stdout, "%s", buf.String())
+}
+
 func (p *printer) table(header []string, data [][]string) {
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader(header)
@@ -146,11 +214,23 @@ func (p *printer) table(header []string, data [][]string) {
 	table.Render()
 }
 
+/* Err returns the error of the last Printf which could not print its data in the format. */
+func (p *printer) Err() error { return p.err }
+
 func (p *printer) SetIndent(indent int)              { p.indent = indent }
 func (p *printer) SetTableAlign(align int)           { p.align = align }
 func (p *printer) SetTablePadding(padding string)    { p.padding = padding }
 func (p *printer) SetTableFormatHeaders(format bool) { p.headers = format }
 
+/* IsTableFormat returns true if format renders header and rows rather than structured data. */
+func (*printer) IsTableFormat(format string) bool {
+	switch format {
+	case "", CSVFormat, MarkdownFormat, TableFormat:
+		return true
+	}
+	return false
+}
+
 func (*printer) SetJSONAsDefaultFormat(format string) string {
 	if format == "" {
 		return JSONFormat
@@ -0,0 +1,758 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/* Protobuf wire types. */
+const (
+	ProtoWireVarint  = 0
+	ProtoWireFixed64 = 1
+	ProtoWireBytes   = 2
+	ProtoWireFixed32 = 5
+)
+
+/* FieldDescriptorProto types and labels. */
+const (
+	protoTypeDouble   = 1
+	protoTypeFloat    = 2
+	protoTypeInt64    = 3
+	protoTypeUint64   = 4
+	protoTypeInt32    = 5
+	protoTypeFixed64  = 6
+	protoTypeFixed32  = 7
+	protoTypeBool     = 8
+	protoTypeString   = 9
+	protoTypeGroup    = 10
+	protoTypeMessage  = 11
+	protoTypeBytes    = 12
+	protoTypeUint32   = 13
+	protoTypeEnum     = 14
+	protoTypeSfixed32 = 15
+	protoTypeSfixed64 = 16
+	protoTypeSint32   = 17
+	protoTypeSint64   = 18
+
+	protoLabelRepeated = 3
+)
+
+var protoTypeNames = map[int]string{
+	protoTypeDouble: "double", protoTypeFloat: "float", protoTypeInt64: "int64",
+	protoTypeUint64: "uint64", protoTypeInt32: "int32", protoTypeFixed64: "fixed64",
+	protoTypeFixed32: "fixed32", protoTypeBool: "bool", protoTypeString: "string",
+	protoTypeGroup: "group", protoTypeBytes: "bytes", protoTypeUint32: "uint32",
+	protoTypeSfixed32: "sfixed32", protoTypeSfixed64: "sfixed64",
+	protoTypeSint32: "sint32", protoTypeSint64: "sint64",
+}
+
+/* ProtoField is a field of a message in the wire format, Varint also holds fixed32 and fixed64 values. */
+type ProtoField struct {
+	Number int
+	Wire   int
+	Varint uint64
+	Bytes  []byte
+}
+
+/* ProtoDecode splits a message into its fields. */
+func ProtoDecode(b []byte) ([]ProtoField, error) {
+	var fields []ProtoField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 || tag>>3 == 0 {
+			return nil, ErrInvalidProto
+		}
+		b = b[n:]
+		f := ProtoField{Number: int(tag >> 3), Wire: int(tag & 7)}
+		switch f.Wire {
+		case ProtoWireVarint:
+			if f.Varint, n = binary.Uvarint(b); n <= 0 {
+				return nil, ErrInvalidProto
+			}
+		case ProtoWireFixed64:
+			if n = 8; len(b) < n {
+				return nil, ErrInvalidProto
+			}
+			f.Varint = binary.LittleEndian.Uint64(b)
+		case ProtoWireFixed32:
+			if n = 4; len(b) < n {
+				return nil, ErrInvalidProto
+			}
+			f.Varint = uint64(binary.LittleEndian.Uint32(b))
+		case ProtoWireBytes:
+			size, m := binary.Uvarint(b)
+			if m <= 0 || size > uint64(len(b)-m) {
+				return nil, ErrInvalidProto
+			}
+			f.Bytes = b[m : m+int(size)]
+			n = m + int(size)
+		default:
+			return nil, ErrInvalidProto
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func ProtoAppendVarint(b []byte, number int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(number)<<3|ProtoWireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func ProtoAppendBytes(b []byte, number int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(number)<<3|ProtoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func ProtoAppendFixed32(b []byte, number int, v uint32) []byte {
+	b = binary.AppendUvarint(b, uint64(number)<<3|ProtoWireFixed32)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func ProtoAppendFixed64(b []byte, number int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(number)<<3|ProtoWireFixed64)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+/* ProtoFile is the part of a FileDescriptorProto needed to describe and encode messages, names are fully qualified. */
+type ProtoFile struct {
+	Name         string          `json:"name" yaml:"name"`
+	Package      string          `json:"package,omitempty" yaml:"package,omitempty"`
+	Dependencies []string        `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	Messages     []*ProtoMessage `json:"messages,omitempty" yaml:"messages,omitempty"`
+	Enums        []*ProtoEnum    `json:"enums,omitempty" yaml:"enums,omitempty"`
+	Services     []*ProtoService `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+type ProtoMessage struct {
+	Name     string              `json:"name" yaml:"name"`
+	Fields   []*ProtoFieldSchema `json:"fields,omitempty" yaml:"fields,omitempty"`
+	MapEntry bool                `json:"map_entry,omitempty" yaml:"map_entry,omitempty"`
+}
+
+type ProtoFieldSchema struct {
+	Name     string `json:"name" yaml:"name"`
+	JSONName string `json:"json_name" yaml:"json_name"`
+	Number   int    `json:"number" yaml:"number"`
+	Repeated bool   `json:"repeated,omitempty" yaml:"repeated,omitempty"`
+	Type     int    `json:"-" yaml:"-"`
+	/* TypeName is the full name of message and enum types, or the scalar type name. */
+	TypeName string `json:"type" yaml:"type"`
+}
+
+type ProtoEnum struct {
+	Name   string           `json:"name" yaml:"name"`
+	Values []ProtoEnumValue `json:"values" yaml:"values"`
+}
+
+type ProtoEnumValue struct {
+	Name   string `json:"name" yaml:"name"`
+	Number int32  `json:"number" yaml:"number"`
+}
+
+type ProtoService struct {
+	Name    string        `json:"name" yaml:"name"`
+	Methods []ProtoMethod `json:"methods" yaml:"methods"`
+}
+
+type ProtoMethod struct {
+	Name            string `json:"name" yaml:"name"`
+	Input           string `json:"input" yaml:"input"`
+	Output          string `json:"output" yaml:"output"`
+	ClientStreaming bool   `json:"client_streaming,omitempty" yaml:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty" yaml:"server_streaming,omitempty"`
+}
+
+/* ParseProtoFile decodes a serialized FileDescriptorProto. */
+func ParseProtoFile(b []byte) (*ProtoFile, error) {
+	fields, err := ProtoDecode(b)
+	if err != nil {
+		return nil, err
+	}
+	var f ProtoFile
+	for _, v := range fields {
+		switch v.Number {
+		case 1:
+			f.Name = string(v.Bytes)
+		case 2:
+			f.Package = string(v.Bytes)
+		case 3:
+			f.Dependencies = append(f.Dependencies, string(v.Bytes))
+		}
+	}
+	for _, v := range fields {
+		var err error
+		switch v.Number {
+		case 4:
+			err = f.parseMessage(v.Bytes, f.Package)
+		case 5:
+			var enum *ProtoEnum
+			if enum, err = parseProtoEnum(v.Bytes, f.Package); err == nil {
+				f.Enums = append(f.Enums, enum)
+			}
+		case 6:
+			err = f.parseService(v.Bytes)
+		}
+		if err != nil {
+			stdLogger.Log.Debug(err.Error(), DefaultField(f.Name))
+			return nil, err
+		}
+	}
+	return &f, nil
+}
+
+func protoFullName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+/* parseMessage decodes a DescriptorProto, nested types are added to f as well. */
+func (f *ProtoFile) parseMessage(b []byte, scope string) error {
+	fields, err := ProtoDecode(b)
+	if err != nil {
+		return err
+	}
+	m := &ProtoMessage{}
+	for _, v := range fields {
+		if v.Number == 1 {
+			m.Name = protoFullName(scope, string(v.Bytes))
+		}
+	}
+	for _, v := range fields {
+		switch v.Number {
+		case 2:
+			field, err := parseProtoField(v.Bytes)
+			if err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, field)
+		case 3:
+			if err = f.parseMessage(v.Bytes, m.Name); err != nil {
+				return err
+			}
+		case 4:
+			enum, err := parseProtoEnum(v.Bytes, m.Name)
+			if err != nil {
+				return err
+			}
+			f.Enums = append(f.Enums, enum)
+		case 7:
+			/* MessageOptions.map_entry */
+			options, err := ProtoDecode(v.Bytes)
+			if err != nil {
+				return err
+			}
+			for _, o := range options {
+				if o.Number == 7 && o.Varint == 1 {
+					m.MapEntry = true
+				}
+			}
+		}
+	}
+	f.Messages = append(f.Messages, m)
+	return nil
+}
+
+func parseProtoField(b []byte) (*ProtoFieldSchema, error) {
+	fields, err := ProtoDecode(b)
+	if err != nil {
+		return nil, err
+	}
+	var field ProtoFieldSchema
+	for _, v := range fields {
+		switch v.Number {
+		case 1:
+			field.Name = string(v.Bytes)
+		case 3:
+			field.Number = int(v.Varint)
+		case 4:
+			field.Repeated = v.Varint == protoLabelRepeated
+		case 5:
+			field.Type = int(v.Varint)
+		case 6:
+			field.TypeName = strings.TrimPrefix(string(v.Bytes), ".")
+		case 10:
+			field.JSONName = string(v.Bytes)
+		}
+	}
+	if field.TypeName == "" {
+		field.TypeName = protoTypeNames[field.Type]
+	}
+	if field.JSONName == "" {
+		field.JSONName = protoJSONName(field.Name)
+	}
+	return &field, nil
+}
+
+/* protoJSONName converts snake_case to lowerCamelCase like protoc does. */
+func protoJSONName(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func parseProtoEnum(b []byte, scope string) (*ProtoEnum, error) {
+	fields, err := ProtoDecode(b)
+	if err != nil {
+		return nil, err
+	}
+	var enum ProtoEnum
+	for _, v := range fields {
+		switch v.Number {
+		case 1:
+			enum.Name = protoFullName(scope, string(v.Bytes))
+		case 2:
+			values, err := ProtoDecode(v.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			var value ProtoEnumValue
+			for _, e := range values {
+				switch e.Number {
+				case 1:
+					value.Name = string(e.Bytes)
+				case 2:
+					value.Number = int32(e.Varint)
+				}
+			}
+			enum.Values = append(enum.Values, value)
+		}
+	}
+	return &enum, nil
+}
+
+func (f *ProtoFile) parseService(b []byte) error {
+	fields, err := ProtoDecode(b)
+	if err != nil {
+		return err
+	}
+	var s ProtoService
+	for _, v := range fields {
+		switch v.Number {
+		case 1:
+			s.Name = protoFullName(f.Package, string(v.Bytes))
+		case 2:
+			methods, err := ProtoDecode(v.Bytes)
+			if err != nil {
+				return err
+			}
+			var m ProtoMethod
+			for _, e := range methods {
+				switch e.Number {
+				case 1:
+					m.Name = string(e.Bytes)
+				case 2:
+					m.Input = strings.TrimPrefix(string(e.Bytes), ".")
+				case 3:
+					m.Output = strings.TrimPrefix(string(e.Bytes), ".")
+				case 5:
+					m.ClientStreaming = e.Varint == 1
+				case 6:
+					m.ServerStreaming = e.Varint == 1
+				}
+			}
+			s.Methods = append(s.Methods, m)
+		}
+	}
+	f.Services = append(f.Services, &s)
+	return nil
+}
+
+/* ProtoRegistry indexes the types of files, and converts messages between JSON and the wire format. */
+type ProtoRegistry struct {
+	Files    map[string]*ProtoFile
+	messages map[string]*ProtoMessage
+	enums    map[string]*ProtoEnum
+	services map[string]*ProtoService
+}
+
+func NewProtoRegistry() *ProtoRegistry {
+	return &ProtoRegistry{
+		Files:    make(map[string]*ProtoFile),
+		messages: make(map[string]*ProtoMessage),
+		enums:    make(map[string]*ProtoEnum),
+		services: make(map[string]*ProtoService),
+	}
+}
+
+func (r *ProtoRegistry) Add(f *ProtoFile) {
+	r.Files[f.Name] = f
+	for _, v := range f.Messages {
+		r.messages[v.Name] = v
+	}
+	for _, v := range f.Enums {
+		r.enums[v.Name] = v
+	}
+	for _, v := range f.Services {
+		r.services[v.Name] = v
+	}
+}
+
+func (r *ProtoRegistry) Message(name string) *ProtoMessage { return r.messages[name] }
+
+func (r *ProtoRegistry) Enum(name string) *ProtoEnum { return r.enums[name] }
+
+func (r *ProtoRegistry) Service(name string) *ProtoService { return r.services[name] }
+
+/* Marshal encodes a JSON object as message name, fields may use the proto or JSON name. */
+func (r *ProtoRegistry) Marshal(name string, data []byte) ([]byte, error) {
+	var v map[string]any
+	d := json.NewDecoder(strings.NewReader(string(data)))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		stdLogger.Log.Debug(err.Error(), DefaultField(string(data)))
+		return nil, err
+	}
+	return r.marshal(name, v)
+}
+
+func (r *ProtoRegistry) marshal(name string, v map[string]any) ([]byte, error) {
+	m := r.messages[name]
+	if m == nil {
+		return nil, fmt.Errorf("%w: unknown message %s", ErrInvalidArg, name)
+	}
+	/* Fields are written in the order of their numbers like protoc, so the encoding is deterministic. */
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		if m.field(key) == nil {
+			return nil, fmt.Errorf("%w: unknown field %s in %s", ErrInvalidArg, key, name)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := m.field(keys[i]).Number, m.field(keys[j]).Number
+		return a < b || a == b && keys[i] < keys[j]
+	})
+	var b []byte
+	for _, key := range keys {
+		field, value := m.field(key), v[key]
+		if value == nil {
+			continue
+		}
+		var err error
+		switch values := value.(type) {
+		case []any:
+			if !field.Repeated {
+				return nil, fmt.Errorf("%w: %s is not repeated", ErrInvalidArg, key)
+			}
+			/* Scalars are packed like protoc does for proto3, parsers accept packed proto2 fields as well. */
+			if field.packable() && len(values) != 0 {
+				tag := len(binary.AppendUvarint(nil, uint64(field.Number)<<3))
+				var packed, e []byte
+				for _, item := range values {
+					if e, err = r.appendValue(nil, field, item); err != nil {
+						return nil, err
+					}
+					packed = append(packed, e[tag:]...)
+				}
+				b = ProtoAppendBytes(b, field.Number, packed)
+				break
+			}
+			for _, e := range values {
+				if b, err = r.appendValue(b, field, e); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]any:
+			entry := r.messages[field.TypeName]
+			if entry == nil || !entry.MapEntry {
+				b, err = r.appendValue(b, field, values)
+				break
+			}
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				b, err = r.appendValue(b, field, map[string]any{"key": json.Number(k), "value": values[k]})
+				if err != nil {
+					break
+				}
+			}
+		default:
+			b, err = r.appendValue(b, field, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (m *ProtoMessage) field(name string) *ProtoFieldSchema {
+	for _, v := range m.Fields {
+		if v.Name == name || v.JSONName == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (m *ProtoMessage) fieldByNumber(number int) *ProtoFieldSchema {
+	for _, v := range m.Fields {
+		if v.Number == number {
+			return v
+		}
+	}
+	return nil
+}
+
+func (r *ProtoRegistry) appendValue(b []byte, field *ProtoFieldSchema, value any) ([]byte, error) {
+	invalid := fmt.Errorf("%w: invalid value %v for %s", ErrInvalidArg, value, field.Name)
+	text := fmt.Sprint(value)
+	switch field.Type {
+	case protoTypeMessage:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, invalid
+		}
+		data, err := r.marshal(field.TypeName, object)
+		if err != nil {
+			return nil, err
+		}
+		return ProtoAppendBytes(b, field.Number, data), nil
+	case protoTypeString:
+		s, ok := value.(string)
+		if !ok {
+			s = text
+		}
+		return ProtoAppendBytes(b, field.Number, []byte(s)), nil
+	case protoTypeBytes:
+		data, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			if data, err = base64.URLEncoding.DecodeString(text); err != nil {
+				return nil, invalid
+			}
+		}
+		return ProtoAppendBytes(b, field.Number, data), nil
+	case protoTypeBool:
+		v, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, invalid
+		}
+		var i uint64
+		if v {
+			i = 1
+		}
+		return ProtoAppendVarint(b, field.Number, i), nil
+	case protoTypeEnum:
+		if enum := r.enums[field.TypeName]; enum != nil {
+			for _, e := range enum.Values {
+				if e.Name == text {
+					return ProtoAppendVarint(b, field.Number, uint64(int64(e.Number))), nil
+				}
+			}
+		}
+		i, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return nil, invalid
+		}
+		return ProtoAppendVarint(b, field.Number, uint64(i)), nil
+	case protoTypeDouble, protoTypeFloat:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		if field.Type == protoTypeFloat {
+			return ProtoAppendFixed32(b, field.Number, math.Float32bits(float32(f))), nil
+		}
+		return ProtoAppendFixed64(b, field.Number, math.Float64bits(f)), nil
+	case protoTypeUint32, protoTypeUint64, protoTypeFixed32, protoTypeFixed64:
+		u, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		switch field.Type {
+		case protoTypeFixed32:
+			return ProtoAppendFixed32(b, field.Number, uint32(u)), nil
+		case protoTypeFixed64:
+			return ProtoAppendFixed64(b, field.Number, u), nil
+		}
+		return ProtoAppendVarint(b, field.Number, u), nil
+	case protoTypeInt32, protoTypeInt64, protoTypeSint32, protoTypeSint64, protoTypeSfixed32, protoTypeSfixed64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		switch field.Type {
+		case protoTypeSint32, protoTypeSint64:
+			return ProtoAppendVarint(b, field.Number, uint64(i<<1^i>>63)), nil
+		case protoTypeSfixed32:
+			return ProtoAppendFixed32(b, field.Number, uint32(i)), nil
+		case protoTypeSfixed64:
+			return ProtoAppendFixed64(b, field.Number, uint64(i)), nil
+		}
+		return ProtoAppendVarint(b, field.Number, uint64(i)), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type of %s", ErrInvalidArg, field.Name)
+}
+
+/* Unmarshal decodes message name to a map keyed by JSON names, 64-bit integers are strings like protojson. */
+func (r *ProtoRegistry) Unmarshal(name string, b []byte) (map[string]any, error) {
+	m := r.messages[name]
+	if m == nil {
+		return nil, fmt.Errorf("%w: unknown message %s", ErrInvalidArg, name)
+	}
+	fields, err := ProtoDecode(b)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any)
+	for _, v := range fields {
+		field := m.fieldByNumber(v.Number)
+		if field == nil {
+			/* Unknown fields are skipped. */
+			continue
+		}
+		items := []ProtoField{v}
+		if v.Wire == ProtoWireBytes && field.Repeated && field.packable() {
+			if items, err = field.unpack(v.Bytes); err != nil {
+				return nil, err
+			}
+		}
+		values := make([]any, 0, len(items))
+		for _, item := range items {
+			value, err := r.value(field, item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		entry := r.messages[field.TypeName]
+		switch {
+		case entry != nil && entry.MapEntry:
+			object, _ := out[field.JSONName].(map[string]any)
+			if object == nil {
+				object = make(map[string]any)
+			}
+			e, _ := values[0].(map[string]any)
+			object[fmt.Sprint(e["key"])] = e["value"]
+			out[field.JSONName] = object
+		case field.Repeated:
+			list, _ := out[field.JSONName].([]any)
+			out[field.JSONName] = append(list, values...)
+		default:
+			out[field.JSONName] = values[0]
+		}
+	}
+	return out, nil
+}
+
+func (f *ProtoFieldSchema) packable() bool {
+	switch f.Type {
+	case protoTypeString, protoTypeBytes, protoTypeMessage, protoTypeGroup:
+		return false
+	}
+	return true
+}
+
+/* unpack decodes a packed repeated scalar field. */
+func (f *ProtoFieldSchema) unpack(b []byte) ([]ProtoField, error) {
+	var values []ProtoField
+	for len(b) > 0 {
+		v := ProtoField{Number: f.Number}
+		switch f.Type {
+		case protoTypeDouble, protoTypeFixed64, protoTypeSfixed64:
+			if len(b) < 8 {
+				return nil, ErrInvalidProto
+			}
+			v.Varint, b = binary.LittleEndian.Uint64(b), b[8:]
+		case protoTypeFloat, protoTypeFixed32, protoTypeSfixed32:
+			if len(b) < 4 {
+				return nil, ErrInvalidProto
+			}
+			v.Varint, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			n := 0
+			if v.Varint, n = binary.Uvarint(b); n <= 0 {
+				return nil, ErrInvalidProto
+			}
+			b = b[n:]
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (r *ProtoRegistry) value(field *ProtoFieldSchema, v ProtoField) (any, error) {
+	switch field.Type {
+	case protoTypeMessage:
+		return r.Unmarshal(field.TypeName, v.Bytes)
+	case protoTypeString:
+		return string(v.Bytes), nil
+	case protoTypeBytes:
+		return base64.StdEncoding.EncodeToString(v.Bytes), nil
+	case protoTypeEnum:
+		if enum := r.enums[field.TypeName]; enum != nil {
+			for _, e := range enum.Values {
+				if e.Number == int32(v.Varint) {
+					return e.Name, nil
+				}
+			}
+		}
+		return int32(v.Varint), nil
+	}
+	return field.scalar(v.Varint), nil
+}
+
+func (f *ProtoFieldSchema) scalar(v uint64) any {
+	switch f.Type {
+	case protoTypeDouble:
+		return math.Float64frombits(v)
+	case protoTypeFloat:
+		return math.Float32frombits(uint32(v))
+	case protoTypeBool:
+		return v != 0
+	case protoTypeInt32, protoTypeSfixed32:
+		return int32(v)
+	case protoTypeUint32, protoTypeFixed32:
+		return uint32(v)
+	case protoTypeSint32:
+		return int32(v>>1) ^ -int32(v&1)
+	case protoTypeInt64, protoTypeSfixed64:
+		return strconv.FormatInt(int64(v), 10)
+	case protoTypeSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10)
+	default:
+		return strconv.FormatUint(v, 10)
+	}
+}
@@ -23,14 +23,17 @@ import (
 )
 
 var (
+	ErrChecksum      = errors.New("checksum mismatch")
 	ErrConfigContent = errors.New("config content is incorrect")
 	ErrConfigTable   = errors.New("table not found in the config")
 	ErrFailedInitial = errors.New("initial failed")
 	ErrIllegalPath   = errors.New("illegal file path")
 	ErrInvalidArg    = errors.New("invalid argument")
+	ErrInvalidBSON   = errors.New("invalid BSON document")
 	ErrInvalidFlag   = errors.New("required flag(s) not set")
 	ErrInvalidIP     = errors.New("invalid IP")
 	ErrInvalidFile   = errors.New("invalid file format")
+	ErrInvalidProto  = errors.New("invalid protobuf message")
 	ErrInvalidToken  = errors.New("invalid token")
 	ErrInvalidURL    = errors.New("invalid URL")
 	ErrResponse      = errors.New("response error")
@@ -22,6 +22,8 @@ import (
 )
 
 const (
+	CommandAck        = "acknowledge"
+	CommandAnalysis   = CommandScan + "-analysis"
 	CommandArping     = "arping"
 	CommandAudio      = "audio"
 	CommandBase32     = "base32"
@@ -30,8 +32,11 @@ const (
 	CommandBase32Std  = CommandBase32 + "std"
 	CommandBase64Std  = CommandBase64 + "std"
 	CommandBase64URL  = CommandBase64 + "url"
+	CommandBench      = "bench"
+	CommandBot        = "bot"
 	CommandBootstrap  = "bootstrap-token"
 	CommandCalculate  = "calculate"
+	CommandCall       = "call"
 	CommandCert       = "cert"
 	CommandConvert    = "convert"
 	CommandCPU        = "cpu"
@@ -41,21 +46,31 @@ const (
 	CommandCsv2XML    = CommandCsv + "2" + CommandXML
 	CommandCsv2Yaml   = CommandCsv + "2" + CommandYaml
 	CommandDate       = "date"
+	CommandDB         = "db"
+	CommandDescribe   = "describe"
 	CommandDf         = "df"
 	CommandDig        = "dig"
 	CommandDiscord    = "discord"
 	CommandDisk       = "disk"
 	CommandDoc        = "doc"
 	CommandDos2Unix   = "dos2unix"
+	CommandEcho       = "echo"
+	CommandEmail      = "email"
 	CommandEncode     = "encode"
 	CommandEncrypt    = "encrypt"
+	CommandExporter   = "exporter"
 	CommandFile       = "file"
+	CommandFiles      = "files"
+	CommandFlush      = "flush"
 	CommandFree       = "free"
 	CommandGenerate   = "generate"
 	CommandGeoip      = "geoip"
+	CommandGRPC       = "grpc"
 	CommandHash       = "hash"
+	CommandHealth     = "health"
 	CommandHex        = "hex"
 	CommandHost       = "host"
+	CommandHTTP       = "http"
 	CommandICP        = "icp"
 	CommandID         = "id"
 	CommandIP         = "ip"
@@ -65,6 +80,7 @@ const (
 	CommandJSON2XML   = CommandJSON + "2" + CommandXML
 	CommandJSON2Yaml  = CommandJSON + "2" + CommandYaml
 	CommandLINE       = "line"
+	CommandList       = "list"
 	CommandLoad       = "load"
 	CommandLowercase  = "lowercase"
 	CommandMan        = "man"
@@ -73,17 +89,23 @@ const (
 	CommandMTR        = "mtr"
 	CommandNetmask    = "netmask"
 	CommandNetwork    = "network"
+	CommandNotify     = "notify"
 	CommandNumber     = "number"
 	CommandOTP        = "otp"
+	CommandPagerDuty  = "pagerduty"
 	CommandPhoto      = "photo"
 	CommandPing       = "ping"
+	CommandProbe      = "probe"
 	CommandPs         = "ps"
 	CommandQrcode     = "qrcode"
 	CommandRandom     = "random"
 	CommandRead       = "read"
 	CommandReadlink   = "readlink"
 	CommandRedis      = "redis"
+	CommandResolve    = "resolve"
 	CommandReST       = "rest"
+	CommandScan       = "scan"
+	CommandServe      = "serve"
 	CommandSign       = "sign"
 	CommandSlack      = "slack"
 	CommandSs         = "ss"
@@ -94,6 +116,7 @@ const (
 	CommandSymbol     = "symbol"
 	CommandSystem     = "system"
 	CommandTCPing     = "tcping"
+	CommandTeams      = "teams"
 	CommandTelegram   = "telegram"
 	CommandText       = "text"
 	CommandToml       = "toml"
@@ -101,14 +124,18 @@ const (
 	CommandToml2JSON  = CommandToml + "2" + CommandJSON
 	CommandToml2XML   = CommandToml + "2" + CommandXML
 	CommandToml2Yaml  = CommandToml + "2" + CommandYaml
+	CommandTop        = "top"
 	CommandTraceroute = "traceroute"
 	CommandTree       = "tree"
+	CommandTrigger    = "trigger"
 	CommandUpdate     = "update"
 	CommandUppercase  = "uppercase"
 	CommandURL        = "url"
 	CommandVersion    = "version"
 	CommandVideo      = "video"
 	CommandVoice      = "voice"
+	CommandWatch      = "watch"
+	CommandWebhook    = "webhook"
 	CommandWhois      = "whois"
 	CommandWiFi       = "wifi"
 	CommandWsping     = "wsping"
@@ -181,5 +208,14 @@ const (
 	keyFileExtension  = ".key"
 	tempFileExtension = ".temp"
 
-	mtrStatHeader = "Loss%   Snt   Last   Avg  Best  Wrst StDev"
+	mtrStatHeader   = "Loss%   Snt   Last   Avg  Best  Wrst StDev"
+	mtrJitterHeader = "Loss%   Snt   Last  Jttr  Javg  Jmax  Jint"
+)
+
+/* MTR display modes, cycled by the d key. */
+const (
+	mtrDisplayStatistics = iota
+	mtrDisplayHeatmap
+	mtrDisplaySparkline
+	mtrDisplayModes
 )
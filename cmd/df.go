@@ -137,7 +137,7 @@ func (d Df) String(value any) {
 	/* tablewriter.ALIGN_LEFT */
 	printer.SetTableAlign(3)
 	printer.SetTablePadding(IndentTwoSpaces)
-	if rootOutputFormat != "" && rootOutputFormat != common.TableFormat {
+	if !printer.IsTableFormat(rootOutputFormat) {
 		printer.Printf(rootOutputFormat, data)
 		return
 	}
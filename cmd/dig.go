@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"reflect"
@@ -49,7 +50,7 @@ func initDig() *cobra.Command {
 			switch lens := len(args); {
 			case lens == 1:
 				flags.domain = args[0]
-				if output, err = output.Request(dns.TypeA, flags.domain, flags.network, flags.server); err != nil {
+				if output, err = output.Request(common.Context, dns.TypeA, flags.domain, flags.network, flags.server); err != nil {
 					logger.Error(err.Error())
 					return
 				}
@@ -57,7 +58,7 @@ func initDig() *cobra.Command {
 					logger.Warn(common.ErrResponse.Error())
 					return
 				}
-				if rootOutputFormat != "" && rootOutputFormat != common.TableFormat {
+				if !printer.IsTableFormat(rootOutputFormat) {
 					printer.Printf(rootOutputFormat, output)
 					return
 				}
@@ -95,7 +96,7 @@ func initDig() *cobra.Command {
 				}
 			}
 			typ := dns.StringToType[strings.ToUpper(argsType[0])]
-			output, err = output.Request(typ, flags.domain, flags.network, flags.server)
+			output, err = output.Request(common.Context, typ, flags.domain, flags.network, flags.server)
 			if err != nil {
 				logger.Error(err.Error())
 				return
@@ -104,7 +105,7 @@ func initDig() *cobra.Command {
 				logger.Warn(common.ErrResponse.Error())
 				return
 			}
-			if rootOutputFormat != "" && rootOutputFormat != common.TableFormat {
+			if !printer.IsTableFormat(rootOutputFormat) {
 				printer.Printf(rootOutputFormat, output)
 				return
 			}
@@ -152,7 +153,8 @@ func (d *DigList) GetLocalServer() (string, error) {
 	return s.Servers[0], err
 }
 
-func (d *DigList) Request(digType uint16, domain, network, server string) (DigList, error) {
+/* Request queries server, or the local resolver if it is empty, until ctx is done. */
+func (d *DigList) Request(ctx context.Context, digType uint16, domain, network, server string) (DigList, error) {
 	var err error
 	/* If Query type is PTR, need to do reverse. */
 	if dns.TypeToString[digType] == "PTR" {
@@ -174,7 +176,7 @@ func (d *DigList) Request(digType uint16, domain, network, server string) (DigLi
 			return nil, err
 		}
 	}
-	resp, _, err := client.Exchange(&message, net.JoinHostPort(server, "53"))
+	resp, _, err := client.ExchangeContext(ctx, &message, net.JoinHostPort(server, "53"))
 	if err != nil {
 		logger.Debug(err.Error(), common.NewField("dns.Msg", message), common.NewField("server", server))
 		return nil, err
@@ -17,8 +17,13 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/linzeyan/ops-cli/cmd/common"
@@ -29,7 +34,12 @@ func initDiscord() *cobra.Command {
 	var flags struct {
 		Token   string `json:"token"`
 		Channel string `json:"channel_id"`
+		NotifyQueue
 		arg     string
+		thread  string
+		edit    string
+		message NotifyMessage
+		bot     DiscordBot
 	}
 	var discordCmd = &cobra.Command{
 		GroupID: getGroupID(CommandDiscord),
@@ -40,44 +50,116 @@ func initDiscord() *cobra.Command {
 		DisableFlagsInUseLine: true,
 	}
 
+	var d Discord
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandDiscord, &flags); err != nil {
+				return err
+			}
+		}
+		d = Discord{Format: flags.message.Format, Color: flags.message.Color}
+		return d.Init(flags.Token)
+	}
+	/* Entries of the outbox keep their channel, format and color, flags are used if they have none. */
+	send := func(entry NotifyOutboxEntry) error {
+		channel := notifyOption(entry, "channel", flags.Channel)
+		d.Format = notifyOption(entry, "format", flags.message.Format)
+		d.Color = notifyOption(entry, "color", flags.message.Color)
+		d.Thread = entry.Options["thread"]
+		if entry.Options["edit"] != "" {
+			return d.Edit(channel, entry.Options["edit"], entry.Arg)
+		}
+		switch entry.Kind {
+		case CommandText:
+			return d.Text(channel, entry.Arg)
+		case CommandText + "TS":
+			return d.TextTTS(channel, entry.Arg)
+		}
+		return d.File(channel, entry.Arg)
+	}
+
 	run := func(cmd *cobra.Command, _ []string) {
-		if flags.arg == "" {
+		if flags.arg == "" && (cmd.Name() == CommandFile || flags.message.Template == "") {
 			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
 			return
 		}
+		if flags.edit != "" && cmd.Name() != CommandText {
+			logger.Error(common.ErrInvalidArg.Error(), common.NewField("edit", flags.edit))
+			return
+		}
 		var err error
-		if rootConfig != "" {
-			if err = ReadConfig(CommandDiscord, &flags); err != nil {
+		if err = setup(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if cmd.Name() != CommandFile {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
 				logger.Error(err.Error())
 				return
 			}
 		}
-		var d Discord
-		if err = d.Init(flags.Token); err != nil {
-			logger.Error(err.Error())
-			return
-		}
 		if cmd.Name() == CommandFile {
 			if !common.IsFile(flags.arg) && !common.IsURL(flags.arg) {
 				logger.Error(common.ErrInvalidFile.Error())
 				return
 			}
 		}
-		switch cmd.Name() {
-		case CommandFile:
-			err = d.File(flags.Channel, flags.arg)
-		case CommandText:
-			err = d.Text(flags.Channel, flags.arg)
-		case CommandText + "TS":
-			err = d.TextTTS(flags.Channel, flags.arg)
-		}
-		if err != nil {
+		entry := NotifyOutboxEntry{Target: CommandDiscord, Kind: cmd.Name(), Arg: flags.arg, Options: notifyOptions(
+			"channel", flags.Channel, "format", flags.message.Format, "color", flags.message.Color, "thread", flags.thread, "edit", flags.edit)}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
 			logger.Error(err.Error())
 			return
 		}
-		printer.Printf(printer.SetNoneAsDefaultFormat(rootOutputFormat), d.Response)
+		printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), d.Sent())
 	}
 
+	var discordSubCmdBot = &cobra.Command{
+		Use:   CommandBot,
+		Short: "Run ops-cli commands sent from whitelisted channels",
+		Long: `Run ops-cli commands sent from whitelisted channels.
+Messages starting with ` + discordBotPrefix + ` are run and replied, the bot needs the Message Content intent enabled in the Developer Portal.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			if rootConfig != "" {
+				if err := ReadConfig(CommandDiscord, &flags); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+				if err := ReadConfig(CommandDiscord, &flags.bot); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+			}
+			if len(flags.bot.Allow) == 0 && flags.Channel != "" {
+				flags.bot.Allow = []string{flags.Channel}
+			}
+			if len(flags.bot.Allow) == 0 {
+				logger.Error(common.ErrInvalidFlag.Error(), common.NewField("allow", flags.bot.Allow))
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
+			var d Discord
+			if err := d.Init(flags.Token); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				return
+			}
+			flags.bot.API = d.API
+			ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+			defer cancel()
+			if err := flags.bot.Run(ctx); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Reply !ping host, !cert host and !dig name sent in channel 1234567890
+-t bot_token --allow 1234567890
+
+# The channel_id of the discord block is allowed if --allow is not set
+--commands cert,dig,ping,tcping,whois --timeout 1m --config ~/.config.toml`, CommandDiscord, CommandBot),
+	}
+	discordSubCmdBot.Flags().StringSliceVar(&flags.bot.Allow, "allow", nil, common.Usage("Channel IDs allowed to run commands, defaults to the channel"))
+	flags.bot.ChatOps.addFlags(discordSubCmdBot)
+
 	var discordSubCmdFile = &cobra.Command{
 		Use:   CommandFile,
 		Short: "Send file to Discord",
@@ -88,6 +170,18 @@ func initDiscord() *cobra.Command {
 		Use:   CommandText,
 		Short: "Send text to Discord",
 		Run:   run,
+		Example: common.Examples(`# Send text
+-t token -c channel_id -a 'Hello World!'
+
+# Send output of a command from stdin as an embed with a yellow bar
+-t token -c channel_id -a - --template alert.tmpl --var host=db1 --color warning < df.txt
+
+# Send an embed object in JSON
+-t token -c channel_id --format embed -a '{"title":"db1","description":"disk full"}'
+
+# Post into a thread, then edit the message with the id printed
+-t token -c channel_id --thread thread_id -a 'backup started'
+-t token -c channel_id --edit message_id -a 'backup finished'`, CommandDiscord, CommandText),
 	}
 
 	var discordSubCmdTextTS = &cobra.Command{
@@ -98,15 +192,24 @@ func initDiscord() *cobra.Command {
 
 	discordCmd.PersistentFlags().StringVarP(&flags.Token, "token", "t", "", common.Usage("Token"))
 	discordCmd.PersistentFlags().StringVarP(&flags.Channel, "channel-id", "c", "", common.Usage("Channel ID"))
-	discordCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument"))
+	discordCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads text from stdin"))
+	flags.message.addFlags(discordCmd, []string{notifyFormatPlain, notifyFormatMarkdown, notifyFormatEmbed}, true)
+	addReplyFlags(discordCmd, &flags.thread, &flags.edit, "Send into the thread of this ID")
+
+	flags.NotifyQueue.addFlags(discordCmd)
 
-	discordCmd.AddCommand(discordSubCmdFile, discordSubCmdText, discordSubCmdTextTS)
+	discordCmd.AddCommand(discordSubCmdBot, discordSubCmdFile, flags.NotifyQueue.flushCommand(CommandDiscord, setup, send), discordSubCmdText, discordSubCmdTextTS)
 	return discordCmd
 }
 
 type Discord struct {
 	API      *discordgo.Session
 	Response *discordgo.Message
+	/* Format is plain, markdown (default) or embed, the text of embed is the description or the embed JSON. */
+	Format string
+	Color  string
+	/* Thread is the ID of a thread channel, messages are sent there instead of the channel. */
+	Thread string
 }
 
 func (d *Discord) Init(token string) error {
@@ -132,7 +235,7 @@ func (d *Discord) File(channel, arg string) error {
 	}
 	filename := filepath.Base(arg)
 	defer f.Close()
-	d.Response, err = d.API.ChannelFileSend(channel, filename, f)
+	d.Response, err = d.API.ChannelFileSend(d.channel(channel), filename, f)
 	if err != nil {
 		logger.Debug(err.Error(),
 			common.NewField("channel", channel),
@@ -145,7 +248,22 @@ func (d *Discord) File(channel, arg string) error {
 
 func (d *Discord) Text(channel, arg string) error {
 	var err error
-	d.Response, err = d.API.ChannelMessageSend(channel, arg)
+	switch d.Format {
+	case "", notifyFormatPlain, notifyFormatMarkdown:
+		if d.Color == "" {
+			d.Response, err = d.API.ChannelMessageSend(d.channel(channel), arg)
+			break
+		}
+		fallthrough
+	case notifyFormatEmbed:
+		var embed *discordgo.MessageEmbed
+		if embed, err = d.embed(arg); err != nil {
+			return err
+		}
+		d.Response, err = d.API.ChannelMessageSendEmbed(d.channel(channel), embed)
+	default:
+		return errNotifyFormat(CommandDiscord, d.Format)
+	}
 	if err != nil {
 		logger.Debug(err.Error(),
 			common.NewField("channel", channel),
@@ -157,7 +275,7 @@ func (d *Discord) Text(channel, arg string) error {
 
 func (d *Discord) TextTTS(channel, arg string) error {
 	var err error
-	d.Response, err = d.API.ChannelMessageSendTTS(channel, arg)
+	d.Response, err = d.API.ChannelMessageSendTTS(d.channel(channel), arg)
 	if err != nil {
 		logger.Debug(err.Error(),
 			common.NewField("channel", channel),
@@ -166,3 +284,151 @@ func (d *Discord) TextTTS(channel, arg string) error {
 	}
 	return err
 }
+
+/* Edit replaces the content of message id with arg, the format is kept as in Text. */
+func (d *Discord) Edit(channel, id, arg string) error {
+	edit := discordgo.NewMessageEdit(d.channel(channel), id)
+	switch d.Format {
+	case "", notifyFormatPlain, notifyFormatMarkdown:
+		if d.Color == "" {
+			edit.Content = &arg
+			break
+		}
+		fallthrough
+	case notifyFormatEmbed:
+		embed, err := d.embed(arg)
+		if err != nil {
+			return err
+		}
+		edit.Embeds = []*discordgo.MessageEmbed{embed}
+	default:
+		return errNotifyFormat(CommandDiscord, d.Format)
+	}
+	var err error
+	d.Response, err = d.API.ChannelMessageEditComplex(edit)
+	if err != nil {
+		logger.Debug(err.Error(),
+			common.NewField("channel", edit.Channel),
+			common.NewField("id", id),
+		)
+	}
+	return err
+}
+
+/* Sent returns the IDs of the last sent or edited message. */
+func (d *Discord) Sent() NotifySent {
+	if d.Response == nil {
+		return NotifySent{}
+	}
+	return NotifySent{ID: d.Response.ID, Channel: d.Response.ChannelID, Thread: d.Thread}
+}
+
+func (d *Discord) channel(channel string) string {
+	if d.Thread != "" {
+		return d.Thread
+	}
+	return channel
+}
+
+/* DiscordNotifier adapts Discord to Notifier, fields are read from the discord config block. */
+type DiscordNotifier struct {
+	Token   string `json:"token"`
+	Channel string `json:"channel_id"`
+	Format  string `json:"format"`
+	Color   string `json:"color"`
+	api     Discord
+}
+
+func (n *DiscordNotifier) setup() error {
+	n.api.Format, n.api.Color = n.Format, n.Color
+	return n.api.Init(n.Token)
+}
+
+func (n *DiscordNotifier) Text(msg string) error { return n.api.Text(n.Channel, msg) }
+
+func (n *DiscordNotifier) File(path string) error { return n.api.File(n.Channel, path) }
+
+func (n *DiscordNotifier) Image(path string) error { return n.api.File(n.Channel, path) }
+
+/* embed decodes arg if it is an embed object, otherwise arg is the description. */
+func (d *Discord) embed(arg string) (*discordgo.MessageEmbed, error) {
+	embed := &discordgo.MessageEmbed{Description: arg}
+	if d.Format == notifyFormatEmbed && strings.HasPrefix(strings.TrimSpace(arg), "{") {
+		embed = new(discordgo.MessageEmbed)
+		if err := json.Unmarshal([]byte(arg), embed); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(arg))
+			return nil, err
+		}
+	}
+	if d.Color != "" {
+		_, color, err := notifyColor(d.Color)
+		if err != nil {
+			return nil, err
+		}
+		embed.Color = color
+	}
+	return embed, nil
+}
+
+/* DiscordBot runs ops-cli commands sent with discordBotPrefix in channels of Allow, and replies the output in a code block. */
+type DiscordBot struct {
+	ChatOps
+	API   *discordgo.Session `json:"-"`
+	Allow []string           `json:"allow"`
+}
+
+const (
+	discordBotPrefix = "!"
+	/* discordMaxText keeps the reply under 2000 characters, the limit of a message. */
+	discordMaxText = 1900
+)
+
+/* Run connects to the gateway and handles messages until ctx is done, messages over Concurrency are dropped. */
+func (b *DiscordBot) Run(ctx context.Context) error {
+	b.API.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentMessageContent
+	remove := b.API.AddHandler(func(_ *discordgo.Session, m *discordgo.MessageCreate) {
+		b.Go(func() { b.Handle(ctx, m.Message) })
+	})
+	defer remove()
+	if err := b.API.Open(); err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	defer b.API.Close()
+	logger.Info("listening", common.NewField("allow", b.Allow))
+	<-ctx.Done()
+	return nil
+}
+
+/* Handle replies to a message starting with discordBotPrefix, messages of bots and other channels are ignored. */
+func (b *DiscordBot) Handle(ctx context.Context, m *discordgo.Message) {
+	text, ok := strings.CutPrefix(m.Content, discordBotPrefix)
+	if !ok || m.Author == nil || m.Author.Bot {
+		return
+	}
+	if !slices.Contains(b.Allow, m.ChannelID) {
+		logger.Warn("channel is not allowed", common.NewField("channel", m.ChannelID), common.NewField("text", m.Content))
+		return
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	logger.Info(m.Content, common.NewField("channel", m.ChannelID), common.NewField("user", m.Author.Username))
+	if _, err := b.API.ChannelMessageSendReply(m.ChannelID, b.Dispatch(ctx, fields[0], fields[1:]), m.Reference()); err != nil {
+		logger.Warn(err.Error(), common.NewField("channel", m.ChannelID))
+	}
+}
+
+/* Dispatch runs ops-cli command with args and returns the reply in markdown. */
+func (b *DiscordBot) Dispatch(ctx context.Context, command string, args []string) string {
+	if command == "help" {
+		return b.Help(discordBotPrefix)
+	}
+	out, err := b.Exec(ctx, command, args)
+	if err != nil {
+		return err.Error() + "\n\n" + b.Help(discordBotPrefix)
+	}
+	/* A fence in the output would close the code block. */
+	return "```\n" + strings.ReplaceAll(truncateText(out, discordMaxText), "```", "`\u200b``") + "\n```"
+}
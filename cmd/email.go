@@ -0,0 +1,330 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initEmail() *cobra.Command {
+	var flags struct {
+		Email
+		NotifyQueue
+		arg     string
+		message NotifyMessage
+	}
+	var emailCmd = &cobra.Command{
+		GroupID: getGroupID(CommandEmail),
+		Use:     CommandEmail,
+		Short:   "Send message by email",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandEmail, &flags); err != nil {
+				return err
+			}
+		}
+		if flags.message.Format != "" {
+			flags.Format = flags.message.Format
+		}
+		return flags.setup()
+	}
+	send := func(entry NotifyOutboxEntry) error { return notifySend(&flags.Email, entry.Kind, entry.Arg) }
+
+	run := func(cmd *cobra.Command, _ []string) {
+		if flags.arg == "" && (cmd.Name() != CommandText || flags.message.Template == "") {
+			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
+			return
+		}
+		var err error
+		if err = setup(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if cmd.Name() == CommandText {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
+		if cmd.Name() != CommandText {
+			if !common.IsFile(flags.arg) {
+				logger.Error(common.ErrInvalidFile.Error())
+				return
+			}
+		}
+		entry := NotifyOutboxEntry{Target: CommandEmail, Kind: cmd.Name(), Arg: flags.arg}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
+	var emailSubCmdFile = &cobra.Command{
+		Use:   CommandFile,
+		Short: "Send file as attachment",
+		Run:   run,
+		Example: common.Examples(`# Send file
+--to ops@example.com -s "Daily report" -a /tmp/report.csv --config ~/.config.toml`, CommandEmail, CommandFile),
+	}
+
+	var emailSubCmdText = &cobra.Command{
+		Use:   CommandText,
+		Short: "Send text",
+		Run:   run,
+		Example: common.Examples(`# Send text with STARTTLS on port 587
+--host smtp.example.com --user bot@example.com --auth secret --from bot@example.com --to ops@example.com -a "Hello World!"
+
+# Implicit TLS on port 465, the subject defaults to the first line of the message
+--host smtp.example.com --port 465 --tls tls --to ops@example.com -a "disk full" --config ~/.config.toml
+
+# Send a HTML report rendered from JSON on stdin
+--to ops@example.com -s "Daily report" -a - --template report.html.tmpl --format html --config ~/.config.toml < report.json`, CommandEmail, CommandText),
+	}
+
+	emailCmd.PersistentFlags().StringVar(&flags.Host, "host", "", common.Usage("SMTP server (required)"))
+	emailCmd.PersistentFlags().IntVarP(&flags.Port, "port", "p", 587, common.Usage("SMTP port"))
+	emailCmd.PersistentFlags().StringVar(&flags.User, "user", "", common.Usage("Username"))
+	emailCmd.PersistentFlags().StringVar(&flags.Password, "auth", "", common.Usage("Password"))
+	emailCmd.PersistentFlags().StringVar(&flags.From, "from", "", common.Usage("Sender, defaults to user"))
+	emailCmd.PersistentFlags().StringSliceVar(&flags.To, "to", nil, common.Usage("Recipients (required)"))
+	emailCmd.PersistentFlags().StringVarP(&flags.Subject, "subject", "s", "", common.Usage("Subject"))
+	emailCmd.PersistentFlags().StringVar(&flags.TLS, "tls", emailTLSStartTLS, common.Usage("TLS mode (starttls/opportunistic/tls/none), opportunistic sends in plaintext if STARTTLS is not offered"))
+	emailCmd.PersistentFlags().BoolVarP(&flags.Insecure, "insecure", "k", false, common.Usage("Skip TLS certificate verification"))
+	emailCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads text from stdin"))
+	flags.message.addFlags(emailCmd, []string{notifyFormatPlain, notifyFormatHTML}, false)
+	flags.NotifyQueue.addFlags(emailCmd)
+
+	emailCmd.AddCommand(emailSubCmdFile, flags.NotifyQueue.flushCommand(CommandEmail, setup, send), emailSubCmdText)
+	return emailCmd
+}
+
+/* Email sends mails over SMTP, TLS is starttls, opportunistic (starttls if offered), tls or none. */
+type Email struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	User     string   `json:"user"`
+	Password string   `json:"auth"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject"`
+	TLS      string   `json:"tls"`
+	Insecure bool     `json:"insecure"`
+	/* Format is plain (default) or html. */
+	Format string `json:"format"`
+}
+
+const (
+	emailTLSStartTLS      = "starttls"
+	emailTLSOpportunistic = "opportunistic"
+	emailTLSImplicit      = "tls"
+	emailTLSNone          = "none"
+)
+
+func (e *Email) setup() error {
+	if e.Host == "" || len(e.To) == 0 {
+		logger.Debug(common.ErrInvalidArg.Error(), common.DefaultField(e.Host))
+		return fmt.Errorf("%w: host and to are required", common.ErrInvalidArg)
+	}
+	if e.Port == 0 {
+		e.Port = 587
+	}
+	if e.From == "" {
+		e.From = e.User
+	}
+	if e.Format != "" && e.Format != notifyFormatPlain && e.Format != notifyFormatHTML {
+		return errNotifyFormat(CommandEmail, e.Format)
+	}
+	switch e.TLS {
+	case "":
+		e.TLS = emailTLSStartTLS
+	case emailTLSStartTLS, emailTLSOpportunistic, emailTLSImplicit, emailTLSNone:
+	default:
+		return fmt.Errorf("%w: tls %s", common.ErrInvalidArg, e.TLS)
+	}
+	return nil
+}
+
+func (e *Email) Text(msg string) error {
+	return e.send(msg, "", nil)
+}
+
+/* File sends path as attachment. */
+func (e *Email) File(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(path))
+		return err
+	}
+	return e.send(filepath.Base(path), filepath.Base(path), content)
+}
+
+/* Image attaches a local image, an URL is sent as text. */
+func (e *Email) Image(path string) error {
+	if common.IsFile(path) {
+		return e.File(path)
+	}
+	return e.Text(path)
+}
+
+/* send writes a text/plain or text/html message, or multipart/mixed if there is an attachment. */
+func (e *Email) send(text, filename string, attachment []byte) error {
+	subject := e.Subject
+	contentType := "text/plain; charset=utf-8"
+	if e.Format == notifyFormatHTML {
+		contentType = "text/html; charset=utf-8"
+	}
+	if subject == "" {
+		subject, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+		if len([]rune(subject)) > 78 {
+			subject = string([]rune(subject)[:75]) + "..."
+		}
+	}
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	host, _ := os.Hostname()
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%x@%s>\r\n", id, host)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+
+	writeText := func(w *bytes.Buffer) {
+		qp := quotedprintable.NewWriter(w)
+		_, _ = qp.Write([]byte(text))
+		qp.Close()
+	}
+	if attachment == nil {
+		fmt.Fprintf(&msg, "Content-Type: %s\r\n", contentType)
+		fmt.Fprintf(&msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeText(&msg)
+	} else {
+		w := multipart.NewWriter(&msg)
+		fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		var buf bytes.Buffer
+		writeText(&buf)
+		_, _ = part.Write(buf.Bytes())
+		part, _ = w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {http.DetectContentType(attachment)},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+		})
+		encoded := base64.StdEncoding.EncodeToString(attachment)
+		for len(encoded) > 76 {
+			_, _ = part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, _ = part.Write([]byte(encoded + "\r\n"))
+		w.Close()
+	}
+	return e.deliver(msg.Bytes())
+}
+
+func (e *Email) deliver(msg []byte) error {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	/* #nosec G402 -- InsecureSkipVerify is only set by --insecure. */
+	config := &tls.Config{ServerName: e.Host, InsecureSkipVerify: e.Insecure, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if e.TLS == emailTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, config)
+	} else {
+		conn, err = dialer.DialContext(common.Context, "tcp", addr)
+	}
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(addr))
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		logger.Debug(err.Error(), common.DefaultField(addr))
+		return err
+	}
+	defer c.Close()
+	switch ok, _ := c.Extension("STARTTLS"); {
+	case ok && (e.TLS == emailTLSStartTLS || e.TLS == emailTLSOpportunistic):
+		if err = c.StartTLS(config); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(addr))
+			return err
+		}
+	case e.TLS == emailTLSStartTLS:
+		/* The extension may be stripped on the way, mails are not sent in plaintext unless opportunistic. */
+		logger.Debug(common.ErrResponse.Error(), common.DefaultField(addr))
+		return fmt.Errorf("%w: %s does not offer STARTTLS, use --tls opportunistic to send in plaintext", common.ErrResponse, addr)
+	}
+	if ok, _ := c.Extension("AUTH"); ok && e.User != "" {
+		if err = c.Auth(smtp.PlainAuth("", e.User, e.Password, e.Host)); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(e.User))
+			return err
+		}
+	}
+	if err = c.Mail(e.From); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(e.From))
+		return err
+	}
+	for _, v := range e.To {
+		if err = c.Rcpt(v); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(v))
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	if err = w.Close(); err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,455 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/miekg/dns"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/spf13/cobra"
+)
+
+func initExporter() *cobra.Command {
+	var s Serve
+	var e Exporter
+	var exporterCmd = &cobra.Command{
+		GroupID: getGroupID(CommandExporter),
+		Use:     CommandExporter,
+		Args:    cobra.NoArgs,
+		Short:   "Serve system metrics and blackbox probes in Prometheus format",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := s.ListenAndServe(&e); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Serve /metrics like node_exporter
+-l :9100
+
+# Probe a port, a site, a certificate and a record like blackbox_exporter
+curl 'http://127.0.0.1:9100/probe?module=tcp&target=db1:5432'
+curl 'http://127.0.0.1:9100/probe?module=http&target=https://example.com'
+curl 'http://127.0.0.1:9100/probe?module=tls&target=example.com:443'
+curl 'http://127.0.0.1:9100/probe?module=dns&target=example.com&record=MX&server=1.1.1.1'`, CommandExporter),
+	}
+	exporterCmd.Flags().StringVarP(&s.Addr, "listen", "l", ":9100", common.Usage("Listen address"))
+	exporterCmd.Flags().StringVar(&s.Auth, "auth", "", common.Usage("Require basic auth, user:password"))
+	exporterCmd.Flags().StringVar(&s.Cert, "cert", "", common.Usage("TLS certificate file"))
+	exporterCmd.Flags().StringVar(&s.Key, "key", "", common.Usage("TLS private key file"))
+	exporterCmd.Flags().DurationVar(&e.Timeout, "timeout", 10*time.Second, common.Usage("Maximum timeout of probes, a shorter scrape timeout of Prometheus takes precedence"))
+	return exporterCmd
+}
+
+/* exporterModules are the modules of /probe. */
+var exporterModules = []string{exporterModuleDNS, exporterModuleHTTP, exporterModuleICMP, exporterModuleTCP, exporterModuleTLS}
+
+const (
+	exporterModuleDNS  = "dns"
+	exporterModuleHTTP = "http"
+	exporterModuleICMP = "icmp"
+	exporterModuleTCP  = "tcp"
+	exporterModuleTLS  = "tls"
+
+	exporterContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+/* Exporter serves /metrics of the host with the names of node_exporter, and /probe with the names of blackbox_exporter. */
+type Exporter struct {
+	Timeout time.Duration
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var m ExporterMetrics
+	switch r.URL.Path {
+	case "/":
+		fmt.Fprintf(w, "%s exporter\n\n/metrics\n/probe?module=%s&target=\n", common.RepoName, strings.Join(exporterModules, "|"))
+		return
+	case "/metrics":
+		e.Collect(r.Context(), &m)
+	case "/probe":
+		module, target := r.URL.Query().Get("module"), r.URL.Query().Get("target")
+		if !slices.Contains(exporterModules, module) || target == "" {
+			http.Error(w, fmt.Sprintf("module must be one of %s, and target is required", strings.Join(exporterModules, "/")), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), e.timeout(r))
+		defer cancel()
+		e.Probe(ctx, &m, module, target, r.URL.Query())
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", exporterContentType)
+	_, _ = w.Write(m.Bytes())
+}
+
+/* timeout is Timeout, or the scrape timeout of Prometheus minus a margin if it is shorter. */
+func (e *Exporter) timeout(r *http.Request) time.Duration {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if v, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64); err == nil && v > 0 {
+		if scrape := time.Duration(v*float64(time.Second)) - 500*time.Millisecond; scrape > 0 && scrape < timeout {
+			timeout = scrape
+		}
+	}
+	return timeout
+}
+
+/* Collect adds metrics of CPU, filesystems, load, memory and network, a failed collector is reported by node_scrape_collector_success. */
+func (e *Exporter) Collect(ctx context.Context, m *ExporterMetrics) {
+	collectors := []struct {
+		name    string
+		collect func(context.Context, *ExporterMetrics) error
+	}{
+		{"cpu", e.collectCPU},
+		{"filesystem", e.collectFilesystem},
+		{"loadavg", e.collectLoad},
+		{"meminfo", e.collectMemory},
+		{"netdev", e.collectNetwork},
+		{"time", e.collectTime},
+	}
+	for _, c := range collectors {
+		success := 1.0
+		if err := c.collect(ctx, m); err != nil {
+			logger.Debug(err.Error(), common.NewField("collector", c.name))
+			success = 0
+		}
+		m.Add("node_scrape_collector_success", "Whether a collector succeeded.", "gauge", success, "collector", c.name)
+	}
+}
+
+func (e *Exporter) collectCPU(ctx context.Context, m *ExporterMetrics) error {
+	times, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	const help = "Seconds the CPUs spent in each mode."
+	for _, v := range times {
+		id := strings.TrimPrefix(v.CPU, "cpu")
+		for _, mode := range []struct {
+			name  string
+			value float64
+		}{
+			{"idle", v.Idle}, {"iowait", v.Iowait}, {"irq", v.Irq}, {"nice", v.Nice},
+			{"softirq", v.Softirq}, {"steal", v.Steal}, {"system", v.System}, {"user", v.User},
+		} {
+			m.Add("node_cpu_seconds_total", help, "counter", mode.value, "cpu", id, "mode", mode.name)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) collectFilesystem(ctx context.Context, m *ExporterMetrics) error {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return err
+	}
+	/* A bind mount or a mount over another is listed again, the same series must not be written twice. */
+	seen := make(map[[2]string]bool)
+	for _, v := range partitions {
+		key := [2]string{v.Device, v.Mountpoint}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		usage, err := disk.UsageWithContext(ctx, v.Mountpoint)
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(v.Mountpoint))
+			continue
+		}
+		labels := []string{"device", v.Device, "fstype", v.Fstype, "mountpoint", v.Mountpoint}
+		m.Add("node_filesystem_size_bytes", "Filesystem size in bytes.", "gauge", float64(usage.Total), labels...)
+		m.Add("node_filesystem_avail_bytes", "Filesystem space available to non-root users in bytes.", "gauge", float64(usage.Free), labels...)
+		m.Add("node_filesystem_files", "Filesystem total file nodes.", "gauge", float64(usage.InodesTotal), labels...)
+		m.Add("node_filesystem_files_free", "Filesystem total free file nodes.", "gauge", float64(usage.InodesFree), labels...)
+	}
+	return nil
+}
+
+func (e *Exporter) collectLoad(ctx context.Context, m *ExporterMetrics) error {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	m.Add("node_load1", "1m load average.", "gauge", avg.Load1)
+	m.Add("node_load5", "5m load average.", "gauge", avg.Load5)
+	m.Add("node_load15", "15m load average.", "gauge", avg.Load15)
+	return nil
+}
+
+func (e *Exporter) collectMemory(ctx context.Context, m *ExporterMetrics) error {
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	m.Add("node_memory_MemTotal_bytes", "Memory information field MemTotal_bytes.", "gauge", float64(v.Total))
+	m.Add("node_memory_MemAvailable_bytes", "Memory information field MemAvailable_bytes.", "gauge", float64(v.Available))
+	m.Add("node_memory_MemFree_bytes", "Memory information field MemFree_bytes.", "gauge", float64(v.Free))
+	m.Add("node_memory_Buffers_bytes", "Memory information field Buffers_bytes.", "gauge", float64(v.Buffers))
+	m.Add("node_memory_Cached_bytes", "Memory information field Cached_bytes.", "gauge", float64(v.Cached))
+	m.Add("node_memory_SwapTotal_bytes", "Memory information field SwapTotal_bytes.", "gauge", float64(v.SwapTotal))
+	m.Add("node_memory_SwapFree_bytes", "Memory information field SwapFree_bytes.", "gauge", float64(v.SwapFree))
+	return nil
+}
+
+func (e *Exporter) collectNetwork(ctx context.Context, m *ExporterMetrics) error {
+	counters, err := psnet.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	for _, v := range counters {
+		for _, c := range []struct {
+			name  string
+			value uint64
+		}{
+			{"receive_bytes", v.BytesRecv}, {"receive_packets", v.PacketsRecv}, {"receive_errs", v.Errin}, {"receive_drop", v.Dropin},
+			{"transmit_bytes", v.BytesSent}, {"transmit_packets", v.PacketsSent}, {"transmit_errs", v.Errout}, {"transmit_drop", v.Dropout},
+		} {
+			m.Add("node_network_"+c.name+"_total", "Network device statistic "+c.name+".", "counter", float64(c.value), "device", v.Name)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) collectTime(ctx context.Context, m *ExporterMetrics) error {
+	m.Add("node_time_seconds", "System time in seconds since epoch.", "gauge", float64(time.Now().UnixNano())/1e9)
+	boot, err := host.BootTimeWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	m.Add("node_boot_time_seconds", "Node boot time, in unixtime.", "gauge", float64(boot))
+	return nil
+}
+
+/* Probe runs module against target and adds probe_success, probe_duration_seconds and the metrics of module. */
+func (e *Exporter) Probe(ctx context.Context, m *ExporterMetrics, module, target string, query map[string][]string) {
+	get := func(key string) string {
+		if v := query[key]; len(v) != 0 {
+			return v[0]
+		}
+		return ""
+	}
+	startTime := time.Now()
+	done := make(chan error, 1)
+	var probe ExporterMetrics
+	go func() {
+		switch module {
+		case exporterModuleDNS:
+			done <- e.probeDNS(ctx, &probe, target, get("record"), get("server"))
+		case exporterModuleHTTP:
+			done <- e.probeHTTP(ctx, &probe, target)
+		case exporterModuleICMP:
+			done <- e.probeICMP(ctx, &probe, target)
+		case exporterModuleTCP:
+			done <- e.probeTCP(ctx, &probe, target)
+		case exporterModuleTLS:
+			done <- e.probeTLS(ctx, &probe, target)
+		}
+	}()
+	var err error
+	select {
+	case err = <-done:
+		m.metrics = append(m.metrics, probe.metrics...)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	success := 1.0
+	if err != nil {
+		logger.Debug(err.Error(), common.NewField("module", module), common.NewField("target", target))
+		success = 0
+	}
+	m.Add("probe_success", "Displays whether or not the probe was a success", "gauge", success)
+	m.Add("probe_duration_seconds", "Returns how long the probe took to complete in seconds", "gauge", time.Since(startTime).Seconds())
+}
+
+func (e *Exporter) probeDNS(ctx context.Context, m *ExporterMetrics, target, record, server string) error {
+	if record == "" {
+		record = "A"
+	}
+	typ, ok := dns.StringToType[strings.ToUpper(record)]
+	if !ok {
+		return fmt.Errorf("%w: record %s", common.ErrInvalidArg, record)
+	}
+	startTime := time.Now()
+	answers, err := new(DigList).Request(ctx, typ, target, UDP, server)
+	m.Add("probe_dns_lookup_time_seconds", "Returns the time taken for probe dns lookup in seconds", "gauge", time.Since(startTime).Seconds())
+	if err != nil {
+		return err
+	}
+	m.Add("probe_dns_answer_rrs", "Returns number of entries in the answer resource record list", "gauge", float64(len(answers)))
+	if len(answers) == 0 {
+		return fmt.Errorf("%w: no %s record", common.ErrResponse, record)
+	}
+	return nil
+}
+
+func (e *Exporter) probeHTTP(ctx context.Context, m *ExporterMetrics, target string) error {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	deadline, _ := ctx.Deadline()
+	p := HTTPProbe{Config: common.HTTPConfig{Method: http.MethodGet, Timeout: time.Until(deadline)}, MaxRedirects: 10}
+	results, err := p.Probe(ctx, target)
+	if len(results) == 0 {
+		return err
+	}
+	last := results[len(results)-1]
+	var dnsTime, connect, tlsTime, processing float64
+	for _, v := range results {
+		dnsTime += v.DNS
+		connect += v.Connect
+		tlsTime += v.TLS
+		processing += v.TTFB - v.DNS - v.Connect - v.TLS
+	}
+	const help = "Duration of http request by phase, summed over all redirects"
+	m.Add("probe_http_duration_seconds", help, "gauge", dnsTime/1000, "phase", "resolve")
+	m.Add("probe_http_duration_seconds", help, "gauge", connect/1000, "phase", "connect")
+	m.Add("probe_http_duration_seconds", help, "gauge", tlsTime/1000, "phase", "tls")
+	m.Add("probe_http_duration_seconds", help, "gauge", processing/1000, "phase", "processing")
+	m.Add("probe_http_status_code", "Response HTTP status code", "gauge", float64(last.Status))
+	m.Add("probe_http_content_length", "Length of http content response", "gauge", float64(last.Size))
+	m.Add("probe_http_redirects", "The number of redirects", "gauge", float64(len(results)-1))
+	ssl := 0.0
+	if last.TLSVersion != "" {
+		ssl = 1
+	}
+	m.Add("probe_http_ssl", "Indicates if SSL was used for the final redirect", "gauge", ssl)
+	if err != nil {
+		return err
+	}
+	if last.Status < http.StatusOK || last.Status >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: status %d", common.ErrResponse, last.Status)
+	}
+	return nil
+}
+
+func (e *Exporter) probeICMP(ctx context.Context, m *ExporterMetrics, target string) error {
+	deadline, _ := ctx.Deadline()
+	p := Ping{IPv6: strings.Contains(target, ":"), TTL: 64, Timeout: time.Until(deadline)}
+	conn, err := p.Listen()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	p.Conn = conn
+	rtt, err := p.Echo(target)
+	if err != nil {
+		return err
+	}
+	m.Add("probe_icmp_duration_seconds", "Duration of icmp request by phase", "gauge", rtt.Seconds(), "phase", "rtt")
+	return nil
+}
+
+func (e *Exporter) probeTCP(ctx context.Context, m *ExporterMetrics, target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	t := TCPing{Protocal: TCP, Timeout: time.Until(deadline)}
+	p := t.Probe(0, host, port)
+	if p.Error != "" {
+		return fmt.Errorf("%w: %s", common.ErrResponse, p.Error)
+	}
+	m.Add("probe_tcp_duration_seconds", "Duration of the tcp connection in seconds", "gauge", p.Time/1000)
+	return nil
+}
+
+func (e *Exporter) probeTLS(ctx context.Context, m *ExporterMetrics, target string) error {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "443")
+	}
+	cert, err := new(Cert).CheckHost(ctx, target)
+	if err != nil {
+		return err
+	}
+	expiry, err := time.Parse(time.RFC3339, cert.ExpiryTime)
+	if err != nil {
+		return err
+	}
+	m.Add("probe_ssl_earliest_cert_expiry", "Returns last SSL chain expiry in unixtime", "gauge", float64(expiry.Unix()))
+	return nil
+}
+
+/* ExporterMetrics is a list of samples written in the Prometheus text format, samples of a name are grouped under one HELP and TYPE. */
+type ExporterMetrics struct {
+	metrics []exporterMetric
+}
+
+type exporterMetric struct {
+	name, help, typ string
+	labels          []string
+	value           float64
+}
+
+/* Add adds a sample, labels are pairs of name and value. */
+func (m *ExporterMetrics) Add(name, help, typ string, value float64, labels ...string) {
+	m.metrics = append(m.metrics, exporterMetric{name: name, help: help, typ: typ, labels: labels, value: value})
+}
+
+func (m *ExporterMetrics) Bytes() []byte {
+	var buf bytes.Buffer
+	var names []string
+	for _, v := range m.metrics {
+		if !slices.Contains(names, v.name) {
+			names = append(names, v.name)
+		}
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, name := range names {
+		header := true
+		for _, v := range m.metrics {
+			if v.name != name {
+				continue
+			}
+			if header {
+				fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, strings.ReplaceAll(v.help, "\n", `\n`), name, v.typ)
+				header = false
+			}
+			buf.WriteString(name)
+			for j := 0; j+1 < len(v.labels); j += 2 {
+				sep := ","
+				if j == 0 {
+					sep = "{"
+				}
+				fmt.Fprintf(&buf, `%s%s="%s"`, sep, v.labels[j], escaper.Replace(v.labels[j+1]))
+			}
+			if len(v.labels) > 1 {
+				buf.WriteString("}")
+			}
+			fmt.Fprintf(&buf, " %s\n", strconv.FormatFloat(v.value, 'g', -1, 64))
+		}
+	}
+	return buf.Bytes()
+}
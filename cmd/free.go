@@ -109,7 +109,7 @@ func (Free) String(header []string, data [][]string) {
 	/* tablewriter.ALIGN_RIGHT */
 	printer.SetTableAlign(2)
 	printer.SetTablePadding("\t ")
-	if rootOutputFormat != "" && rootOutputFormat != common.TableFormat {
+	if !printer.IsTableFormat(rootOutputFormat) {
 		printer.Printf(rootOutputFormat, data)
 		return
 	}
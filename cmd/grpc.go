@@ -0,0 +1,720 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initGRPC() *cobra.Command {
+	var flags struct {
+		headers []string
+		data    string
+	}
+	var g GRPC
+	/* setup validates target and fills the metadata of g. */
+	setup := func(target string) error {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			logger.Error(err.Error(), common.DefaultField(target))
+			return err
+		}
+		headers, err := parseHeaders(flags.headers)
+		if err != nil {
+			logger.Error(err.Error(), common.DefaultField(flags.headers))
+			return err
+		}
+		g.Target = target
+		g.Config.Headers = headers
+		return nil
+	}
+	var grpcCmd = &cobra.Command{
+		GroupID: getGroupID(CommandGRPC),
+		Use:     CommandGRPC,
+		Short:   "gRPC health check and reflection client",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	var grpcSubCmdHealth = &cobra.Command{
+		Use:   CommandHealth + " [host:port] [service]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "Check grpc.health.v1.Health of a server or service",
+		Run: func(_ *cobra.Command, args []string) {
+			if err := setup(args[0]); err != nil {
+				printer.Error(err)
+				return
+			}
+			var service string
+			if len(args) == 2 {
+				service = args[1]
+			}
+			result, err := g.Health(common.Context, service)
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(args))
+				printer.Error(err)
+				return
+			}
+			result.String()
+		},
+		Example: common.Examples(`# Check the overall health of a plaintext server
+health 127.0.0.1:50051
+
+# Check a service over TLS
+health api.example.com:443 helloworld.Greeter --tls`, CommandGRPC),
+	}
+
+	var grpcSubCmdList = &cobra.Command{
+		Use:   CommandList + " [host:port] [service]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "List services, or methods of a service, by server reflection",
+		Run: func(_ *cobra.Command, args []string) {
+			if err := setup(args[0]); err != nil {
+				printer.Error(err)
+				return
+			}
+			var result []string
+			var err error
+			if len(args) == 1 {
+				result, err = g.ListServices(common.Context)
+			} else {
+				result, err = g.ListMethods(common.Context, args[1])
+			}
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(args))
+				printer.Error(err)
+				return
+			}
+			if !printer.IsTableFormat(rootOutputFormat) {
+				printer.Printf(rootOutputFormat, result)
+				return
+			}
+			printer.Printf("%s\n", strings.Join(result, "\n"))
+		},
+		Example: common.Examples(`# List services
+list 127.0.0.1:50051
+
+# List methods of a service
+list 127.0.0.1:50051 helloworld.Greeter`, CommandGRPC),
+	}
+
+	var grpcSubCmdDescribe = &cobra.Command{
+		Use:   CommandDescribe + " [host:port] [symbol]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "Describe services, methods, messages or enums by server reflection",
+		Run: func(_ *cobra.Command, args []string) {
+			if err := setup(args[0]); err != nil {
+				printer.Error(err)
+				return
+			}
+			symbols := args[1:]
+			if len(symbols) == 0 {
+				var err error
+				if symbols, err = g.ListServices(common.Context); err != nil {
+					logger.Error(err.Error(), common.DefaultField(args))
+					printer.Error(err)
+					return
+				}
+			}
+			var result []any
+			var text []string
+			for _, symbol := range symbols {
+				v, s, err := g.Describe(common.Context, symbol)
+				if err != nil {
+					logger.Error(err.Error(), common.DefaultField(symbol))
+					printer.Error(err)
+					return
+				}
+				result = append(result, v)
+				text = append(text, s)
+			}
+			if !printer.IsTableFormat(rootOutputFormat) {
+				printer.Printf(rootOutputFormat, result)
+				return
+			}
+			printer.Printf("%s", strings.Join(text, "\n"))
+		},
+		Example: common.Examples(`# Describe all services
+describe 127.0.0.1:50051
+
+# Describe a service, method or message
+describe 127.0.0.1:50051 helloworld.Greeter
+describe 127.0.0.1:50051 helloworld.Greeter.SayHello
+describe 127.0.0.1:50051 helloworld.HelloRequest --output json`, CommandGRPC),
+	}
+
+	var grpcSubCmdCall = &cobra.Command{
+		Use:   CommandCall + " [host:port] [service/method]",
+		Args:  cobra.ExactArgs(2),
+		Short: "Invoke a method with JSON input by server reflection",
+		Run: func(_ *cobra.Command, args []string) {
+			if err := setup(args[0]); err != nil {
+				printer.Error(err)
+				return
+			}
+			var data io.Reader = strings.NewReader(flags.data)
+			switch {
+			case flags.data == "@-":
+				data = os.Stdin
+			case strings.HasPrefix(flags.data, "@"):
+				f, err := os.Open(flags.data[1:])
+				if err != nil {
+					logger.Error(err.Error(), common.DefaultField(flags.data))
+					printer.Error(err)
+					return
+				}
+				defer f.Close()
+				data = f
+			}
+			result, err := g.Call(common.Context, args[1], data)
+			for _, v := range result {
+				printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), v)
+			}
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(args))
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Call a unary method
+call 127.0.0.1:50051 helloworld.Greeter/SayHello -d '{"name":"ops"}'
+
+# Send every JSON object of a file to a client streaming method, with metadata
+call 127.0.0.1:50051 routeguide.RouteGuide/RecordRoute -d @points.json -H 'authorization: Bearer token'`,
+			CommandGRPC),
+	}
+	grpcSubCmdCall.Flags().StringVarP(&flags.data, "data", "d", "", common.Usage("Request messages in JSON, @file reads from file and @- from stdin"))
+
+	grpcCmd.PersistentFlags().BoolVar(&g.TLS, "tls", false, common.Usage("Connect over TLS"))
+	grpcCmd.PersistentFlags().BoolVarP(&g.Config.Insecure, "insecure", "k", false, common.Usage("Connect over TLS and skip certificate verification"))
+	grpcCmd.PersistentFlags().StringVar(&g.Config.CACert, "cacert", "", common.Usage("Connect over TLS and verify the server with the CA certificate file"))
+	grpcCmd.PersistentFlags().StringArrayVarP(&flags.headers, "headers", "H", nil, common.Usage("Metadata, 'Key: Value' or JSON object, can be repeated"))
+	grpcCmd.PersistentFlags().DurationVarP(&g.Config.Timeout, "timeout", "t", 10*time.Second, common.Usage("Timeout of each RPC"))
+	grpcCmd.PersistentFlags().IntVar(&g.MaxRecvSize, "max-recv-size", grpcMaxRecvSize, common.Usage("Largest response message in bytes"))
+	grpcCmd.AddCommand(grpcSubCmdHealth, grpcSubCmdList, grpcSubCmdDescribe, grpcSubCmdCall)
+	return grpcCmd
+}
+
+/* GRPC speaks gRPC over the HTTP/2 support of net/http, messages are encoded by reflection. */
+type GRPC struct {
+	/* Target is host:port. */
+	Target string
+	TLS    bool
+	/* Config provides the metadata, timeout and TLS options. */
+	Config common.HTTPConfig
+	/* MaxRecvSize is the largest response message in bytes, defaults to grpcMaxRecvSize. */
+	MaxRecvSize int
+
+	client     *http.Client
+	reflection string
+}
+
+const (
+	grpcHealthMethod      = "/grpc.health.v1.Health/Check"
+	grpcReflection        = "grpc.reflection.v1.ServerReflection"
+	grpcReflectionV1Alpha = "grpc.reflection.v1alpha.ServerReflection"
+)
+
+var grpcHealthStatus = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+var grpcCodes = []string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound",
+	"AlreadyExists", "PermissionDenied", "ResourceExhausted", "FailedPrecondition",
+	"Aborted", "OutOfRange", "Unimplemented", "Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+const (
+	grpcCodeResourceExhausted = 8
+	grpcCodeUnimplemented     = 12
+)
+
+/* grpcMaxRecvSize is the default limit of a response message, the same as grpc-go. */
+const grpcMaxRecvSize = 4 << 20
+
+/* GRPCStatus is a non-OK status returned by the server. */
+type GRPCStatus struct {
+	Code    int
+	Message string
+}
+
+func (s *GRPCStatus) Error() string {
+	code := strconv.Itoa(s.Code)
+	if s.Code >= 0 && s.Code < len(grpcCodes) {
+		code = grpcCodes[s.Code]
+	}
+	return fmt.Sprintf("rpc error: code = %s desc = %s", code, s.Message)
+}
+
+func (g *GRPC) secure() bool {
+	return g.TLS || g.Config.Insecure || g.Config.CACert != ""
+}
+
+func (g *GRPC) httpClient() (*http.Client, error) {
+	if g.client != nil {
+		return g.client, nil
+	}
+	client, err := g.Config.Client()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := client.Transport.(*http.Transport); ok {
+		t.Proxy = nil
+		t.Protocols = new(http.Protocols)
+		if g.secure() {
+			t.Protocols.SetHTTP2(true)
+		} else {
+			/* h2c with prior knowledge. */
+			t.Protocols.SetUnencryptedHTTP2(true)
+		}
+	}
+	g.client = client
+	return client, nil
+}
+
+/* Invoke sends requests to method (/package.Service/Method) and returns the response messages. */
+func (g *GRPC) Invoke(ctx context.Context, method string, requests [][]byte) ([][]byte, error) {
+	client, err := g.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	for _, v := range requests {
+		/* Uncompressed flag and big-endian length prefix. */
+		body.WriteByte(0)
+		_ = binary.Write(&body, binary.BigEndian, uint32(len(v)))
+		body.Write(v)
+	}
+	scheme := "http"
+	if g.secure() {
+		scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+g.Target+method, &body)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(method))
+		return nil, err
+	}
+	if g.Config.Headers != "" {
+		header := make(map[string]string)
+		if err = Encoder.JSONMarshaler(g.Config.Headers, &header); err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", common.UserAgent)
+	if g.Config.Timeout > 0 {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(g.Config.Timeout.Milliseconds(), 10)+"m")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(method))
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Debug(resp.Status, common.DefaultField(method))
+		return nil, fmt.Errorf("%w: %s", common.ErrStatusCode, resp.Status)
+	}
+	limit := g.MaxRecvSize
+	if limit <= 0 {
+		limit = grpcMaxRecvSize
+	}
+	var responses [][]byte
+	prefix := make([]byte, 5)
+	for {
+		if _, err = io.ReadFull(resp.Body, prefix); err != nil {
+			break
+		}
+		if prefix[0] != 0 {
+			return nil, fmt.Errorf("%w: compressed message", common.ErrResponse)
+		}
+		/* The length is sent by the server, check it before allocating. */
+		size := binary.BigEndian.Uint32(prefix[1:])
+		if uint64(size) > uint64(limit) {
+			logger.Debug(common.ErrResponse.Error(), common.NewField("size", size), common.NewField("max", limit))
+			return responses, fmt.Errorf("%w: %w", common.ErrResponse, &GRPCStatus{
+				Code:    grpcCodeResourceExhausted,
+				Message: fmt.Sprintf("received message larger than max (%d vs. %d)", size, limit),
+			})
+		}
+		message := make([]byte, size)
+		if _, err = io.ReadFull(resp.Body, message); err != nil {
+			break
+		}
+		responses = append(responses, message)
+	}
+	if !errors.Is(err, io.EOF) {
+		logger.Debug(err.Error(), common.DefaultField(method))
+		return responses, err
+	}
+
+	/* Trailers-only responses carry the status in headers. */
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		logger.Debug(common.ErrResponse.Error(), common.DefaultField(method))
+		return responses, fmt.Errorf("%w: missing grpc-status", common.ErrResponse)
+	}
+	if code != 0 {
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+		return responses, &GRPCStatus{Code: code, Message: message}
+	}
+	return responses, nil
+}
+
+/* GRPCHealth is the result of grpc.health.v1.Health/Check, Time is in milliseconds. */
+type GRPCHealth struct {
+	Target  string  `json:"target" yaml:"target"`
+	Service string  `json:"service" yaml:"service"`
+	Status  string  `json:"status" yaml:"status"`
+	Time    float64 `json:"time" yaml:"time"`
+}
+
+func (g *GRPC) Health(ctx context.Context, service string) (*GRPCHealth, error) {
+	var req []byte
+	if service != "" {
+		req = common.ProtoAppendBytes(nil, 1, []byte(service))
+	}
+	start := time.Now()
+	resp, err := g.Invoke(ctx, grpcHealthMethod, [][]byte{req})
+	if err != nil {
+		return nil, err
+	}
+	result := &GRPCHealth{
+		Target:  g.Target,
+		Service: service,
+		Status:  grpcHealthStatus[0],
+		Time:    float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if len(resp) == 0 {
+		return nil, common.ErrResponse
+	}
+	fields, err := common.ProtoDecode(resp[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range fields {
+		if v.Number != 1 {
+			continue
+		}
+		result.Status = strconv.FormatUint(v.Varint, 10)
+		if v.Varint < uint64(len(grpcHealthStatus)) {
+			result.Status = grpcHealthStatus[v.Varint]
+		}
+	}
+	return result, nil
+}
+
+func (h GRPCHealth) String() {
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, h)
+		return
+	}
+	header := []string{"Target", "Service", "Status", "Time"}
+	data := [][]string{{h.Target, h.Service, h.Status, strconv.FormatFloat(h.Time, 'f', 2, 64) + "ms"}}
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	printer.Printf(printer.SetTableAsDefaultFormat(rootOutputFormat), header, data)
+}
+
+/* reflect sends a ServerReflectionRequest with field number set to value, v1 is tried before v1alpha. */
+func (g *GRPC) reflect(ctx context.Context, number int, value string) ([]common.ProtoField, error) {
+	req := common.ProtoAppendBytes(nil, number, []byte(value))
+	var resp [][]byte
+	var err error
+	for _, service := range []string{grpcReflection, grpcReflectionV1Alpha} {
+		if g.reflection != "" && g.reflection != service {
+			continue
+		}
+		resp, err = g.Invoke(ctx, "/"+service+"/ServerReflectionInfo", [][]byte{req})
+		var status *GRPCStatus
+		if errors.As(err, &status) && status.Code == grpcCodeUnimplemented && g.reflection == "" {
+			continue
+		}
+		g.reflection = service
+		break
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 {
+		return nil, common.ErrResponse
+	}
+	fields, err := common.ProtoDecode(resp[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range fields {
+		/* error_response */
+		if v.Number != 7 {
+			continue
+		}
+		errorFields, err := common.ProtoDecode(v.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		status := &GRPCStatus{}
+		for _, e := range errorFields {
+			switch e.Number {
+			case 1:
+				status.Code = int(e.Varint)
+			case 2:
+				status.Message = string(e.Bytes)
+			}
+		}
+		return nil, status
+	}
+	return fields, nil
+}
+
+func (g *GRPC) ListServices(ctx context.Context) ([]string, error) {
+	fields, err := g.reflect(ctx, 7, "*")
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, v := range fields {
+		/* list_services_response */
+		if v.Number != 6 {
+			continue
+		}
+		list, err := common.ProtoDecode(v.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			service, err := common.ProtoDecode(e.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range service {
+				if s.Number == 1 {
+					services = append(services, string(s.Bytes))
+				}
+			}
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+func (g *GRPC) ListMethods(ctx context.Context, service string) ([]string, error) {
+	registry, err := g.Registry(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	s := registry.Service(service)
+	if s == nil {
+		return nil, fmt.Errorf("%w: %s is not a service", common.ErrInvalidArg, service)
+	}
+	var methods []string
+	for _, v := range s.Methods {
+		methods = append(methods, s.Name+"."+v.Name)
+	}
+	return methods, nil
+}
+
+/* Registry loads the file defining symbol and its dependencies by reflection. */
+func (g *GRPC) Registry(ctx context.Context, symbol string) (*common.ProtoRegistry, error) {
+	registry := common.NewProtoRegistry()
+	/* file_containing_symbol, then file_by_filename for missing dependencies. */
+	number, value := 4, symbol
+	var pending []string
+	for {
+		fields, err := g.reflect(ctx, number, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range fields {
+			/* file_descriptor_response */
+			if v.Number != 4 {
+				continue
+			}
+			files, err := common.ProtoDecode(v.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range files {
+				f, err := common.ParseProtoFile(e.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				registry.Add(f)
+				pending = append(pending, f.Dependencies...)
+			}
+		}
+		for len(pending) != 0 && registry.Files[pending[0]] != nil {
+			pending = pending[1:]
+		}
+		if len(pending) == 0 {
+			return registry, nil
+		}
+		number, value, pending = 3, pending[0], pending[1:]
+	}
+}
+
+/* grpcSplitMethod splits package.Service/Method or package.Service.Method. */
+func grpcSplitMethod(method string) (string, string, bool) {
+	method = strings.TrimPrefix(method, "/")
+	if i := strings.LastIndexAny(method, "/."); i > 0 && i < len(method)-1 {
+		return method[:i], method[i+1:], true
+	}
+	return "", "", false
+}
+
+/* Describe returns the definition of symbol, and its text in proto syntax. */
+func (g *GRPC) Describe(ctx context.Context, symbol string) (any, string, error) {
+	symbol = strings.TrimPrefix(symbol, ".")
+	registry, err := g.Registry(ctx, strings.Replace(symbol, "/", ".", 1))
+	if err != nil {
+		return nil, "", err
+	}
+	var sb strings.Builder
+	if s := registry.Service(symbol); s != nil {
+		fmt.Fprintf(&sb, "service %s {\n", s.Name)
+		for _, m := range s.Methods {
+			fmt.Fprintf(&sb, "  %s\n", grpcMethodString(m))
+		}
+		sb.WriteString("}\n")
+		return s, sb.String(), nil
+	}
+	if m := registry.Message(symbol); m != nil {
+		fmt.Fprintf(&sb, "message %s {\n", m.Name)
+		for _, f := range m.Fields {
+			label := ""
+			if f.Repeated {
+				label = "repeated "
+			}
+			fmt.Fprintf(&sb, "  %s%s %s = %d;\n", label, f.TypeName, f.Name, f.Number)
+		}
+		sb.WriteString("}\n")
+		return m, sb.String(), nil
+	}
+	if e := registry.Enum(symbol); e != nil {
+		fmt.Fprintf(&sb, "enum %s {\n", e.Name)
+		for _, v := range e.Values {
+			fmt.Fprintf(&sb, "  %s = %d;\n", v.Name, v.Number)
+		}
+		sb.WriteString("}\n")
+		return e, sb.String(), nil
+	}
+	if service, method, ok := grpcSplitMethod(symbol); ok {
+		if s := registry.Service(service); s != nil {
+			for _, m := range s.Methods {
+				if m.Name == method {
+					return m, grpcMethodString(m) + "\n", nil
+				}
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("%w: symbol %s not found", common.ErrInvalidArg, symbol)
+}
+
+func grpcMethodString(m common.ProtoMethod) string {
+	stream := func(ok bool) string {
+		if ok {
+			return "stream "
+		}
+		return ""
+	}
+	return fmt.Sprintf("rpc %s(%s%s) returns (%s%s);",
+		m.Name, stream(m.ClientStreaming), m.Input, stream(m.ServerStreaming), m.Output)
+}
+
+/* Call invokes method with every JSON object of data as a request, an empty data sends an empty message. */
+func (g *GRPC) Call(ctx context.Context, method string, data io.Reader) ([]map[string]any, error) {
+	service, name, ok := grpcSplitMethod(method)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", common.ErrInvalidArg, method)
+	}
+	registry, err := g.Registry(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	s := registry.Service(service)
+	if s == nil {
+		return nil, fmt.Errorf("%w: %s is not a service", common.ErrInvalidArg, service)
+	}
+	var m *common.ProtoMethod
+	for i := range s.Methods {
+		if s.Methods[i].Name == name {
+			m = &s.Methods[i]
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%w: method %s not found in %s", common.ErrInvalidArg, name, service)
+	}
+
+	var requests [][]byte
+	decoder := json.NewDecoder(data)
+	for {
+		var raw json.RawMessage
+		if err = decoder.Decode(&raw); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			logger.Debug(err.Error())
+			return nil, err
+		}
+		req, err := registry.Marshal(m.Input, raw)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	if len(requests) == 0 {
+		requests = append(requests, nil)
+	}
+
+	resp, err := g.Invoke(ctx, "/"+s.Name+"/"+m.Name, requests)
+	var result []map[string]any
+	for _, v := range resp {
+		out, err := registry.Unmarshal(m.Output, v)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, out)
+	}
+	return result, err
+}
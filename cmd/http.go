@@ -0,0 +1,271 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initHTTP() *cobra.Command {
+	var flags struct {
+		method, data         string
+		headers              []string
+		insecure, noRedirect bool
+		maxRedirects         int
+		timeout              time.Duration
+	}
+	var httpCmd = &cobra.Command{
+		GroupID: getGroupID(CommandHTTP),
+		Use:     CommandHTTP,
+		Short:   "HTTP diagnostic tools",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	var httpSubCmdProbe = &cobra.Command{
+		Use:   CommandProbe + " [url]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Show DNS, connect, TLS, TTFB and total time of a request",
+		Run: func(_ *cobra.Command, args []string) {
+			if !common.IsURL(args[0]) {
+				logger.Error(common.ErrInvalidURL.Error(), common.DefaultField(args[0]))
+				printer.Error(common.ErrInvalidURL)
+				return
+			}
+			headers, err := parseHeaders(flags.headers)
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(flags.headers))
+				printer.Error(err)
+				return
+			}
+			p := HTTPProbe{
+				Config: common.HTTPConfig{
+					Method:   flags.method,
+					Body:     flags.data,
+					Headers:  headers,
+					Insecure: flags.insecure,
+					Timeout:  flags.timeout,
+				},
+				MaxRedirects: flags.maxRedirects,
+			}
+			if flags.noRedirect {
+				p.MaxRedirects = 0
+			}
+			result, err := p.Probe(common.Context, args[0])
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(args[0]))
+				printer.Error(err)
+			}
+			if len(result) != 0 {
+				p.String(result)
+			}
+		},
+		Example: common.Examples(`# Show timing of a request
+https://www.google.com
+
+# Follow no redirects
+http://google.com --no-redirect
+
+# Send a POST request with headers and print JSON
+https://httpbin.org/post -m POST -d '{"a":1}' -H 'Content-Type: application/json' --output json`,
+			CommandHTTP, CommandProbe),
+	}
+	httpSubCmdProbe.Flags().StringVarP(&flags.method, "method", "m", http.MethodGet, common.Usage("Request method"))
+	httpSubCmdProbe.Flags().StringVarP(&flags.data, "data", "d", "", common.Usage("Request body"))
+	httpSubCmdProbe.Flags().StringArrayVarP(&flags.headers, "headers", "H", nil, common.Usage("Headers, 'Key: Value' or JSON object, can be repeated"))
+	httpSubCmdProbe.Flags().BoolVarP(&flags.insecure, "insecure", "k", false, common.Usage("Skip TLS certificate verification"))
+	httpSubCmdProbe.Flags().BoolVar(&flags.noRedirect, "no-redirect", false, common.Usage("Do not follow redirects"))
+	httpSubCmdProbe.Flags().IntVar(&flags.maxRedirects, "max-redirects", 10, common.Usage("Maximum number of redirects to follow"))
+	httpSubCmdProbe.Flags().DurationVarP(&flags.timeout, "timeout", "t", 15*time.Second, common.Usage("Timeout of each request"))
+
+	httpCmd.AddCommand(httpSubCmdProbe)
+	return httpCmd
+}
+
+type HTTPProbe struct {
+	Config       common.HTTPConfig
+	MaxRedirects int
+}
+
+/* HTTPProbeResult is a request of the redirect chain, times are in milliseconds. */
+type HTTPProbeResult struct {
+	URL        string  `json:"url" yaml:"url"`
+	RemoteAddr string  `json:"remote_addr,omitempty" yaml:"remote_addr,omitempty"`
+	Proto      string  `json:"proto" yaml:"proto"`
+	TLSVersion string  `json:"tls_version,omitempty" yaml:"tls_version,omitempty"`
+	Status     int     `json:"status" yaml:"status"`
+	Size       int64   `json:"size" yaml:"size"`
+	Reused     bool    `json:"reused" yaml:"reused"`
+	DNS        float64 `json:"dns" yaml:"dns"`
+	Connect    float64 `json:"connect" yaml:"connect"`
+	TLS        float64 `json:"tls" yaml:"tls"`
+	TTFB       float64 `json:"ttfb" yaml:"ttfb"`
+	Total      float64 `json:"total" yaml:"total"`
+}
+
+/* Probe requests uri and follows redirects itself, so that every hop is traced. */
+func (h *HTTPProbe) Probe(ctx context.Context, uri string) ([]HTTPProbeResult, error) {
+	client, err := h.Config.Client()
+	if err != nil {
+		return nil, err
+	}
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	defer client.CloseIdleConnections()
+
+	var results []HTTPProbeResult
+	config := h.Config
+	if config.Method == "" {
+		config.Method = http.MethodGet
+	}
+	for i := 0; ; i++ {
+		result, location, err := h.request(ctx, client, config, uri)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+		if location == "" || i >= h.MaxRedirects {
+			return results, nil
+		}
+		next, err := url.Parse(location)
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(location))
+			return results, err
+		}
+		current, _ := url.Parse(uri)
+		uri = current.ResolveReference(next).String()
+		switch result.Status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+			if config.Method != http.MethodHead {
+				config.Method = http.MethodGet
+			}
+			config.Body = ""
+		}
+	}
+}
+
+func (h *HTTPProbe) request(ctx context.Context, client *http.Client, config common.HTTPConfig, uri string) (HTTPProbeResult, string, error) {
+	result := HTTPProbeResult{URL: uri}
+	var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+		ConnectStart: func(string, string) {
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone:          func(string, string, error) { connectDone = time.Now() },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			result.Reused = info.Reused
+			if info.Conn != nil {
+				result.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+	}
+	req, err := config.NewRequest(httptrace.WithClientTrace(ctx, trace), uri)
+	if err != nil {
+		return result, "", err
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", common.UserAgent)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(uri))
+		return result, "", err
+	}
+	defer resp.Body.Close()
+	result.Size, err = io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(uri))
+		return result, "", err
+	}
+	end := time.Now()
+
+	result.Proto = resp.Proto
+	result.Status = resp.StatusCode
+	if resp.TLS != nil {
+		result.TLSVersion = tls.VersionName(resp.TLS.Version)
+	}
+	ms := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return float64(to.Sub(from).Microseconds()) / 1000
+	}
+	result.DNS = ms(dnsStart, dnsDone)
+	result.Connect = ms(connectStart, connectDone)
+	result.TLS = ms(tlsStart, tlsDone)
+	result.TTFB = ms(start, firstByte)
+	result.Total = ms(start, end)
+
+	var location string
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		location = resp.Header.Get("Location")
+	}
+	return result, location, nil
+}
+
+func (h *HTTPProbe) String(results []HTTPProbeResult) {
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, results)
+		return
+	}
+	ms := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) + "ms" }
+	header := []string{"URL", "Remote", "Proto", "Status", "Size", "DNS", "Connect", "TLS", "TTFB", "Total"}
+	var data [][]string
+	var total float64
+	for _, v := range results {
+		proto := v.Proto
+		if v.TLSVersion != "" {
+			proto += " (" + v.TLSVersion + ")"
+		}
+		remote := v.RemoteAddr
+		if v.Reused {
+			remote += " (reused)"
+		}
+		data = append(data, []string{
+			v.URL, remote, proto, strconv.Itoa(v.Status), common.ByteSize(v.Size),
+			ms(v.DNS), ms(v.Connect), ms(v.TLS), ms(v.TTFB), ms(v.Total),
+		})
+		total += v.Total
+	}
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	format := printer.SetTableAsDefaultFormat(rootOutputFormat)
+	printer.Printf(format, header, data)
+	if format == common.TableFormat && len(results) > 1 {
+		printer.Printf("\n%d redirects, %s in total\n", len(results)-1, ms(total))
+	}
+}
@@ -17,9 +17,13 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/line/line-bot-sdk-go/v7/linebot"
@@ -32,7 +36,11 @@ func initLINE() *cobra.Command {
 		Secret string `json:"secret"`
 		Token  string `json:"access_token"`
 		ID     string `json:"id"`
-		arg    string
+		NotifyQueue
+		arg     string
+		message NotifyMessage
+		server  LINEServer
+		serve   Serve
 	}
 	var lineCmd = &cobra.Command{
 		GroupID: getGroupID(CommandLINE),
@@ -43,31 +51,56 @@ func initLINE() *cobra.Command {
 		DisableFlagsInUseLine: true,
 	}
 
+	var l LINE
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandLINE, &flags); err != nil {
+				return err
+			}
+		}
+		l = LINE{Format: flags.message.Format}
+		return l.Init(flags.Secret, flags.Token)
+	}
+	send := func(entry NotifyOutboxEntry) error {
+		var err error
+		switch entry.Kind {
+		case CommandText:
+			return l.Text(flags.ID, entry.Arg)
+		case CommandPhoto:
+			input := linebot.NewImageMessage(entry.Arg, entry.Arg)
+			l.Response, err = l.API.PushMessage(flags.ID, input).Do()
+		case CommandVideo:
+			input := linebot.NewVideoMessage(entry.Arg, entry.Arg)
+			l.Response, err = l.API.PushMessage(flags.ID, input).Do()
+		default:
+			return fmt.Errorf("%w: LINE can not send %s", common.ErrInvalidFile, entry.Kind)
+		}
+		return err
+	}
+
 	run := func(cmd *cobra.Command, args []string) {
-		if flags.arg == "" {
+		if flags.arg == "" && (cmd.Name() != CommandText || flags.message.Template == "") {
 			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
 			return
 		}
 		var err error
-		if rootConfig != "" {
-			if err = ReadConfig(CommandLINE, &flags); err != nil {
+		if err = setup(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if cmd.Name() == CommandText {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
 				logger.Error(err.Error())
 				return
 			}
 		}
-		var l LINE
-		if err = l.Init(flags.Secret, flags.Token); err != nil {
-			logger.Error(err.Error())
-			return
-		}
 		if cmd.Name() != CommandText {
 			if !common.IsFile(flags.arg) && !common.IsURL(flags.arg) {
 				logger.Error(common.ErrInvalidFile.Error())
 				return
 			}
 		}
-		switch cmd.Name() {
-		case CommandID:
+		if cmd.Name() == CommandID {
 			l.Response, err = l.API.SetWebhookEndpointURL(args[0]).Do()
 			if err != nil {
 				logger.Warn(err.Error())
@@ -76,17 +109,9 @@ func initLINE() *cobra.Command {
 			}
 			l.GetID()
 			return
-		case CommandText:
-			input := linebot.NewTextMessage(flags.arg)
-			l.Response, err = l.API.PushMessage(flags.ID, input).Do()
-		case CommandPhoto:
-			input := linebot.NewImageMessage(flags.arg, flags.arg)
-			l.Response, err = l.API.PushMessage(flags.ID, input).Do()
-		case CommandVideo:
-			input := linebot.NewVideoMessage(flags.arg, flags.arg)
-			l.Response, err = l.API.PushMessage(flags.ID, input).Do()
 		}
-		if err != nil {
+		entry := NotifyOutboxEntry{Target: CommandLINE, Kind: cmd.Name(), Arg: flags.arg}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
 			logger.Error(err.Error())
 			return
 		}
@@ -97,7 +122,10 @@ func initLINE() *cobra.Command {
 		Use:   CommandText,
 		Short: "Send message to LINE",
 		Example: common.Examples(`# Send text to LINE chat
--s secret -t token --id GroupID -a 'Hello LINE'`, CommandLINE, CommandText),
+-s secret -t token --id GroupID -a 'Hello LINE'
+
+# Send a Flex Message container in JSON from stdin
+-s secret -t token --id GroupID -a - --format blocks < bubble.json`, CommandLINE, CommandText),
 		Run: run,
 	}
 
@@ -113,6 +141,54 @@ https://callback_url`, CommandLINE, CommandID),
 		Run: run,
 	}
 
+	var lineSubCmdServe = &cobra.Command{
+		Use:   CommandServe,
+		Short: "Run ops-cli commands sent to the bot from whitelisted chats",
+		Long: `Run ops-cli commands sent to the bot from whitelisted chats.
+Point the Webhook URL of the channel to this server, messages starting with / are run and replied with the reply token.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			if rootConfig != "" {
+				if err := ReadConfig(CommandLINE, &flags); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+				if err := ReadConfig(CommandLINE, &flags.server); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+			}
+			if len(flags.server.Allow) == 0 && flags.ID != "" {
+				flags.server.Allow = []string{flags.ID}
+			}
+			if len(flags.server.Allow) == 0 {
+				logger.Error(common.ErrInvalidFlag.Error(), common.NewField("allow", flags.server.Allow))
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
+			var l LINE
+			if err := l.Init(flags.Secret, flags.Token); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				return
+			}
+			flags.server.API = l.API
+			if err := flags.serve.ListenAndServe(&flags.server); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Reply /dig example.com sent from the chat of the line block
+--config ~/.config.toml
+
+# Allow more chats and commands, serve TLS
+-l :8443 --cert cert.pem --key key.pem --allow Cxxxxxxxx,Uxxxxxxxx --commands dig,cert,whois --config ~/.config.toml`, CommandLINE, CommandServe),
+	}
+	lineSubCmdServe.Flags().StringSliceVar(&flags.server.Allow, "allow", nil, common.Usage("User, group or room IDs allowed to run commands, defaults to --id"))
+	lineSubCmdServe.Flags().StringVarP(&flags.serve.Addr, "listen", "l", ":8080", common.Usage("Listen address"))
+	lineSubCmdServe.Flags().StringVar(&flags.serve.Cert, "cert", "", common.Usage("TLS certificate file"))
+	lineSubCmdServe.Flags().StringVar(&flags.serve.Key, "key", "", common.Usage("TLS private key file"))
+	flags.server.ChatOps.addFlags(lineSubCmdServe)
+
 	var lineSubCmdPhoto = &cobra.Command{
 		Use:   CommandPhoto,
 		Short: "Send photo to LINE",
@@ -131,16 +207,21 @@ https://callback_url`, CommandLINE, CommandID),
 
 	lineCmd.PersistentFlags().StringVarP(&flags.Secret, "secret", "s", "", common.Usage("Channel Secret"))
 	lineCmd.PersistentFlags().StringVarP(&flags.Token, "token", "t", "", common.Usage("Channel Access Token"))
-	lineCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Function Argument"))
+	lineCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Function Argument, - reads text from stdin"))
+	flags.message.addFlags(lineCmd, []string{notifyFormatPlain, notifyFormatBlocks}, false)
 	lineCmd.PersistentFlags().StringVar(&flags.ID, "id", "", common.Usage("UserID/GroupID/RoomID"))
 
-	lineCmd.AddCommand(lineSubCmdID, lineSubCmdPhoto, lineSubCmdText, lineSubCmdVideo)
+	flags.NotifyQueue.addFlags(lineCmd)
+
+	lineCmd.AddCommand(flags.NotifyQueue.flushCommand(CommandLINE, setup, send), lineSubCmdID, lineSubCmdPhoto, lineSubCmdServe, lineSubCmdText, lineSubCmdVideo)
 	return lineCmd
 }
 
 type LINE struct {
 	API      *linebot.Client
 	Response *linebot.BasicResponse
+	/* Format is plain (default) or blocks, the text of blocks is a Flex Message container in JSON. */
+	Format string
 }
 
 func (l *LINE) Init(secret, token string) error {
@@ -157,6 +238,29 @@ func (l *LINE) Init(secret, token string) error {
 	return err
 }
 
+func (l *LINE) Text(id, arg string) error {
+	var input linebot.SendingMessage
+	switch l.Format {
+	case "", notifyFormatPlain:
+		input = linebot.NewTextMessage(arg)
+	case notifyFormatBlocks:
+		container, err := linebot.UnmarshalFlexMessageJSON([]byte(arg))
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(arg))
+			return err
+		}
+		input = linebot.NewFlexMessage(common.RepoName, container)
+	default:
+		return errNotifyFormat(CommandLINE, l.Format)
+	}
+	var err error
+	l.Response, err = l.API.PushMessage(id, input).Do()
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(id))
+	}
+	return err
+}
+
 func (l *LINE) GetID() {
 	var err error
 	http.HandleFunc("/", func(_ http.ResponseWriter, r *http.Request) {
@@ -166,17 +270,8 @@ func (l *LINE) GetID() {
 		}
 		for i := range events {
 			if events[i].Type == linebot.EventTypeMessage && events[i].Message.(*linebot.TextMessage).Text == CommandID {
-				switch s := events[i].Source; s.Type {
-				case linebot.EventSourceTypeGroup:
-					printer.Printf(s.GroupID)
-					os.Exit(0)
-				case linebot.EventSourceTypeRoom:
-					printer.Printf(s.RoomID)
-					os.Exit(0)
-				case linebot.EventSourceTypeUser:
-					printer.Printf(s.UserID)
-					os.Exit(0)
-				}
+				printer.Printf(lineSourceID(events[i].Source))
+				os.Exit(0)
 			}
 		}
 	})
@@ -195,3 +290,126 @@ func (l *LINE) GetID() {
 		logger.Fatal(err.Error())
 	}
 }
+
+/* LINENotifier adapts LINE to Notifier, fields are read from the line config block. */
+type LINENotifier struct {
+	Secret string `json:"secret"`
+	Token  string `json:"access_token"`
+	ID     string `json:"id"`
+	Format string `json:"format"`
+	api    LINE
+}
+
+func (n *LINENotifier) setup() error {
+	n.api.Format = n.Format
+	return n.api.Init(n.Secret, n.Token)
+}
+
+func (n *LINENotifier) Text(msg string) error { return n.api.Text(n.ID, msg) }
+
+/* Plain sends msg as text if Format is blocks, which expects a Flex Message. */
+func (n *LINENotifier) Plain(msg string) error {
+	api := n.api
+	api.Format = notifyFormatPlain
+	return api.Text(n.ID, msg)
+}
+
+/* File is not supported, the Messaging API only pushes media by URL. */
+func (n *LINENotifier) File(path string) error {
+	logger.Debug(common.ErrInvalidFile.Error(), common.DefaultField(path))
+	return fmt.Errorf("%w: LINE can not send files", common.ErrInvalidFile)
+}
+
+func (n *LINENotifier) Image(path string) error {
+	if !common.IsURL(path) {
+		logger.Debug(common.ErrInvalidURL.Error(), common.DefaultField(path))
+		return common.ErrInvalidURL
+	}
+	return n.push(linebot.NewImageMessage(path, path))
+}
+
+func (n *LINENotifier) push(message linebot.SendingMessage) error {
+	var err error
+	n.api.Response, err = n.api.API.PushMessage(n.ID, message).Do()
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(n.ID))
+	}
+	return err
+}
+
+/* LINEServer runs ops-cli commands sent from chats in Allow to the webhook, and replies the output. */
+type LINEServer struct {
+	ChatOps
+	Allow []string        `json:"allow"`
+	API   *linebot.Client `json:"-"`
+}
+
+/* lineMaxText keeps the reply under 5000 characters, the limit of a text message. */
+const lineMaxText = 4900
+
+/* ServeHTTP verifies the signature of the webhook, and replies messages starting with /, up to Concurrency at once. */
+func (s *LINEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	events, err := s.API.ParseRequest(r)
+	if err != nil {
+		logger.Warn(err.Error(), common.NewField("remote", r.RemoteAddr))
+		if errors.Is(err, linebot.ErrInvalidSignature) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, event := range events {
+		if event.Type != linebot.EventTypeMessage || event.Source == nil {
+			continue
+		}
+		message, ok := event.Message.(*linebot.TextMessage)
+		if !ok || !strings.HasPrefix(message.Text, "/") {
+			continue
+		}
+		id := lineSourceID(event.Source)
+		if !slices.Contains(s.Allow, id) {
+			logger.Warn("chat is not allowed", common.NewField("chat", id), common.NewField("text", message.Text))
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(message.Text, "/"))
+		if len(fields) == 0 {
+			continue
+		}
+		logger.Info(message.Text, common.NewField("chat", id), common.NewField("user", event.Source.UserID))
+		token := event.ReplyToken
+		s.Go(func() {
+			if _, err := s.API.ReplyMessage(token, linebot.NewTextMessage(s.Dispatch(common.Context, fields[0], fields[1:]))).Do(); err != nil {
+				logger.Warn(err.Error(), common.NewField("chat", id))
+			}
+		})
+	}
+}
+
+/* Dispatch runs ops-cli command with args and returns the reply in plain text. */
+func (s *LINEServer) Dispatch(ctx context.Context, command string, args []string) string {
+	if command == "help" {
+		return s.Help("/")
+	}
+	out, err := s.Exec(ctx, command, args)
+	if err != nil {
+		return err.Error() + "\n\n" + s.Help("/")
+	}
+	return truncateText(out, lineMaxText)
+}
+
+/* lineSourceID returns the ID of the group, room or user a message is sent from. */
+func lineSourceID(source *linebot.EventSource) string {
+	switch source.Type {
+	case linebot.EventSourceTypeGroup:
+		return source.GroupID
+	case linebot.EventSourceTypeRoom:
+		return source.RoomID
+	}
+	return source.UserID
+}
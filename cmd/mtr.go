@@ -25,8 +25,10 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gizak/termui/v3"
@@ -41,9 +43,13 @@ import (
 func initMTR() *cobra.Command {
 	var flags struct {
 		output   string
+		report   bool
 		count    int
 		interval time.Duration
 		timeout  time.Duration
+
+		asn, geo  bool
+		databases []string
 	}
 	var mtrCmd = &cobra.Command{
 		GroupID: getGroupID(CommandMTR),
@@ -53,6 +59,14 @@ func initMTR() *cobra.Command {
 		ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		},
+		Example: common.Examples(`# Start the interactive UI
+1.1.1.1
+
+# Print a report after 10 cycles
+1.1.1.1 --report
+
+# Print a markdown report with ASN of each hop
+1.1.1.1 --report -c 5 --asn --output markdown`, CommandMTR),
 		Run: func(_ *cobra.Command, args []string) {
 			if !common.IsDomain(args[0]) && !common.IsIP(args[0]) {
 				logger.Info(common.ErrInvalidArg.Error(), common.DefaultField(args))
@@ -60,15 +74,35 @@ func initMTR() *cobra.Command {
 				return
 			}
 
+			/* --output was the file of mtr before it became the output format, a value which is not a format is still the file. */
+			if flags.output == "" && rootOutputFormat != "" && !slices.Contains(mtrOutputFormats, rootOutputFormat) {
+				printer.Error(errors.New("flag --output of a file name has been deprecated, use --output-file"))
+				flags.output, rootOutputFormat = rootOutputFormat, ""
+			}
+
 			if flags.interval < 50*time.Millisecond {
 				flags.interval = 50 * time.Millisecond
 			}
 
+			if flags.report && flags.count <= 0 {
+				flags.count = 10
+			}
+
 			var m MTR
+			m.Report = flags.report
 			m.trace.Host = args[0]
 			m.trace.Interval = flags.interval
 			m.trace.Timeout = flags.timeout
 			m.trace.Count = flags.count
+			if flags.asn || flags.geo {
+				m.trace.Lookup = &HopLookup{DNS: true, ASN: flags.asn, Geo: flags.geo, Databases: flags.databases}
+				if err := m.trace.Lookup.Open(); err != nil {
+					logger.Info(err.Error())
+					printer.Error(err)
+					return
+				}
+			}
+			m.DNS = m.trace.Lookup != nil
 			err := m.init()
 			if err != nil {
 				logger.Info(err.Error())
@@ -76,6 +110,19 @@ func initMTR() *cobra.Command {
 				return
 			}
 
+			if m.Report {
+				ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+				defer cancel()
+				err = m.Run(ctx)
+				if err != nil && !errors.Is(err, common.ErrResponse) && !errors.Is(err, context.Canceled) {
+					logger.Info(err.Error())
+					printer.Error(err)
+					return
+				}
+				m.PrintReport()
+				return
+			}
+
 			if err := termui.Init(); err != nil {
 				logger.Info(err.Error())
 				printer.Error(err)
@@ -96,10 +143,10 @@ func initMTR() *cobra.Command {
 			info.WrapText = false
 			infoString := fmt.Sprintf("%s -> %s", m.LocalHostname, m.RemoteHostname)
 
-			/* Keys: (q)uit. */
+			/* Keys: (p)ause (r)eset (d)isplay (n)DNS (j)itter (q)uit. */
 			keys := widgets.NewParagraph()
 			keys.Border = false
-			keys.Text = "Keys: (q)uit"
+			keysString := "Keys: (p)ause (r)eset (d)isplay (n)DNS (j)itter (q)uit"
 
 			/* Packets               Pings */
 			title1 := widgets.NewParagraph()
@@ -126,25 +173,35 @@ func initMTR() *cobra.Command {
 				info.Text = infoString + spaces + fmt.Sprintf("%v", time.Now().Local().Format(time.RFC3339))
 				info.SetRect(0, 2, w, 1)
 
+				m.mu.Lock()
+				m.TerminalWidth = w
+				paused, display, statHeader := m.Paused, m.Display, m.header()
+				m.mu.Unlock()
+				keys.Text = keysString
+				if paused {
+					keys.Text += "    [paused]"
+				}
 				keys.SetRect(0, 3, w, 2)
 
-				n = w - len(mtrStatHeader)
+				n = w - len(statHeader)
 				spaces = strings.Repeat(" ", n)
-				title1.Text = spaces + t1String
+				title1.Text = ""
+				if display == mtrDisplayStatistics {
+					title1.Text = spaces + t1String
+				}
 				title1.SetRect(0, 4, w, 3)
 
-				n = w - len(titl2String) - len(mtrStatHeader) - 2
+				n = w - len(titl2String) - len(statHeader) - 2
 				spaces = strings.Repeat(" ", n)
-				title2.Text = titl2String + spaces + mtrStatHeader
+				title2.Text = titl2String + spaces + statHeader
 				title2.SetRect(0, 5, w, 4)
-				m.TerminalWidth = w
 			}
 			setRect()
 
 			table := widgets.NewTable()
 			table.Border = false
 			table.RowSeparator = false
-			table.Rows = m.Statistics
+			table.Rows = m.Rows()
 
 			uiEvents := termui.PollEvents()
 			ticker := time.NewTicker(10 * time.Millisecond).C
@@ -160,13 +217,32 @@ func initMTR() *cobra.Command {
 						case "q", "<C-c>":
 							termui.Close()
 							os.Exit(0)
+						case "p":
+							m.TogglePause()
+						case "r":
+							m.Reset()
+						case "d":
+							m.ToggleDisplay()
+						case "n":
+							m.ToggleDNS()
+						case "j":
+							m.ToggleJitter()
 						}
 					case <-ticker:
 						termui.Clear()
 						setRect()
-						table.SetRect(0, 5, m.TerminalWidth, 36)
-						table.Rows = m.Statistics
-						table.ColumnWidths = []int{m.TerminalWidth}
+						view := m.view()
+						if view.display == mtrDisplaySparkline {
+							if group := m.SparklineGroup(view.width); group != nil {
+								_, h := termui.TerminalDimensions()
+								group.SetRect(0, 5, view.width, h)
+								termui.Render(header, info, keys, title1, title2, group)
+								continue
+							}
+						}
+						table.SetRect(0, 5, view.width, 36)
+						table.Rows = m.Rows()
+						table.ColumnWidths = []int{view.width}
 						termui.Render(header, info, keys, title1, title2, table)
 					}
 				}
@@ -174,9 +250,13 @@ func initMTR() *cobra.Command {
 			err = m.Run(ctx)
 			if errors.Is(err, common.ErrResponse) {
 				if flags.count != -1 && flags.output != "" {
+					m.mu.Lock()
+					m.Display = mtrDisplayStatistics
+					m.mu.Unlock()
+					m.Summary()
 					var buf bytes.Buffer
 					buf.WriteString(header.Text + "\n" + info.Text + "\n" + keys.Text + "\n" + title1.Text + "\n" + title2.Text + "\n")
-					for _, i := range m.Statistics {
+					for _, i := range m.Rows() {
 						buf.WriteString(i[0] + "\n")
 					}
 					wrErr := os.WriteFile(flags.output, buf.Bytes(), FileModeRAll)
@@ -191,23 +271,55 @@ func initMTR() *cobra.Command {
 			}
 		},
 	}
-	mtrCmd.Flags().StringVarP(&flags.output, "output", "o", "", common.Usage("Specify output file name"))
-	mtrCmd.Flags().IntVarP(&flags.count, "count", "c", -1, common.Usage("Specify ping counts"))
+	mtrCmd.Flags().StringVarP(&flags.output, "output-file", "o", "", common.Usage("Specify output file name"))
+	mtrCmd.Flags().BoolVarP(&flags.report, "report", "r", false, common.Usage("Run count cycles without the UI and print a report"))
+	mtrCmd.Flags().IntVarP(&flags.count, "count", "c", -1, common.Usage("Specify ping counts, report mode defaults to 10"))
 	mtrCmd.Flags().DurationVarP(&flags.interval, "interval", "i", 100*time.Millisecond, common.Usage("Specify interval"))
 	mtrCmd.Flags().DurationVarP(&flags.timeout, "timeout", "t", 800*time.Millisecond, common.Usage("Specify timeout"))
+	mtrCmd.Flags().BoolVar(&flags.asn, "asn", false, common.Usage("Show PTR, origin ASN and organization of each hop"))
+	mtrCmd.Flags().BoolVar(&flags.geo, "geo", false, common.Usage("Show city and country of each hop"))
+	mtrCmd.Flags().StringSliceVar(&flags.databases, "db", nil, common.Usage("Offline MaxMind (.mmdb) or ip2asn (.tsv) database, skip online lookups"))
 	return mtrCmd
 }
 
 type MTR struct {
 	IPv6           bool
+	Report         bool
 	LocalHostname  string
 	RemoteHostname string
 	TerminalWidth  int
 	Statistics     [][]string
 
+	/* Interactive UI state. */
+	Paused  bool
+	DNS     bool
+	Jitter  bool
+	Display int
+
+	/* mu guards TerminalWidth, Statistics, the UI state and the lookup of trace, which the UI, Run and Summary share. */
+	mu    sync.Mutex
+	reset bool
 	trace Traceroute
 }
 
+/* mtrOutputFormats are the values of --output which are formats rather than the deprecated file name. */
+var mtrOutputFormats = []string{common.CSVFormat, common.JSONFormat, common.MarkdownFormat, common.NDJSONFormat, common.NoneFormat, common.TableFormat, common.YamlFormat}
+
+/* mtrView is a snapshot of the UI state, so that drawing does not hold the lock. */
+type mtrView struct {
+	width   int
+	display int
+	jitter  bool
+	dns     bool
+	lookup  *HopLookup
+}
+
+func (m *MTR) view() mtrView {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return mtrView{width: m.TerminalWidth, display: m.Display, jitter: m.Jitter, dns: m.DNS, lookup: m.trace.Lookup}
+}
+
 func (m *MTR) init() error {
 	var err error
 	hostname, err := os.Hostname()
@@ -263,18 +375,38 @@ func (m *MTR) Run(ctx context.Context) error {
 
 	reply := make([]byte, 1500)
 
-	go func() {
-		for {
-			if len(m.trace.Stat) != 0 {
-				m.Summary()
+	if !m.Report {
+		go func() {
+			ticker := time.NewTicker(50 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					m.Summary()
+				}
 			}
-		}
-	}()
+		}()
+	}
 	for round := 0; ; round++ {
+		for m.paused() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		m.mu.Lock()
+		if m.reset {
+			m.trace.ResetStats()
+			m.reset = false
+		}
+		m.mu.Unlock()
 		if err = m.trace.Connect(ctx, reply); err != nil {
 			return err
 		}
-		if round == m.trace.Count {
+		if round+1 == m.trace.Count {
 			return common.ErrResponse
 		}
 		time.Sleep(time.Second)
@@ -287,36 +419,329 @@ func (m *MTR) Run(ctx context.Context) error {
 	}
 }
 
+/* MTRHop is the statistics of a hop, times are in milliseconds. */
+type MTRHop struct {
+	Hop   int      `json:"hop" yaml:"hop"`
+	Host  string   `json:"host" yaml:"host"`
+	Loss  float64  `json:"loss" yaml:"loss"`
+	Sent  int      `json:"sent" yaml:"sent"`
+	Last  float64  `json:"last" yaml:"last"`
+	Avg   float64  `json:"avg" yaml:"avg"`
+	Best  float64  `json:"best" yaml:"best"`
+	Worst float64  `json:"worst" yaml:"worst"`
+	StDev float64  `json:"stdev" yaml:"stdev"`
+	Info  *HopInfo `json:"info,omitempty" yaml:"info,omitempty"`
+}
+
+/* stat returns average and standard deviation of the round trip times. */
+func (m *MTR) stat(v ICMPStat) (time.Duration, time.Duration) {
+	if v.Receive == 0 || len(v.Rtts) == 0 {
+		return 0, 0
+	}
+	avg := v.Avg / time.Duration(v.Receive)
+	var temp float64
+	for _, vv := range v.Rtts {
+		temp += math.Pow(float64(vv-avg), 2)
+	}
+	variance := temp / float64(len(v.Rtts))
+	return avg, time.Duration(math.Sqrt(variance))
+}
+
+/* Hops returns the statistics of every hop. */
+func (m *MTR) Hops() []MTRHop {
+	ms := func(d time.Duration) float64 {
+		return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+	}
+	lookup := m.view().lookup
+	var hops []MTRHop
+	for _, v := range m.trace.Stats() {
+		if len(v.Rtts) == 0 {
+			continue
+		}
+		avg, mdev := m.stat(v)
+		hop := MTRHop{
+			Hop:   v.Hop,
+			Host:  v.DstIP,
+			Loss:  math.Round(float64(v.Loss*100)/float64(v.Send)*10) / 10,
+			Sent:  v.Send,
+			Last:  ms(v.Rtts[len(v.Rtts)-1]),
+			Avg:   ms(avg),
+			Best:  ms(v.Min),
+			Worst: ms(v.Max),
+			StDev: ms(mdev),
+		}
+		if lookup != nil && v.DstIP != "*" {
+			info := lookup.Resolve(v.DstIP)
+			hop.Info = &info
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+/* PrintReport prints the statistics like `mtr --report`. */
+func (m *MTR) PrintReport() {
+	hops := m.Hops()
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, hops)
+		return
+	}
+	header := []string{"Host", "Loss%", "Snt", "Last", "Avg", "Best", "Wrst", "StDev"}
+	var data [][]string
+	for _, v := range hops {
+		host := v.Host
+		if v.Info != nil {
+			host = strings.TrimSpace(host + " " + v.Info.String())
+		}
+		data = append(data, []string{
+			fmt.Sprintf("%d. %s", v.Hop, host),
+			fmt.Sprintf("%.1f%%", v.Loss),
+			strconv.Itoa(v.Sent),
+			fmt.Sprintf("%.1f", v.Last),
+			fmt.Sprintf("%.1f", v.Avg),
+			fmt.Sprintf("%.1f", v.Best),
+			fmt.Sprintf("%.1f", v.Worst),
+			fmt.Sprintf("%.1f", v.StDev),
+		})
+	}
+	format := printer.SetTableAsDefaultFormat(rootOutputFormat)
+	if format == common.TableFormat {
+		printer.Printf("Start: %s\n", common.TimeNow.Format(time.RFC3339))
+		header[0] = "HOST: " + m.LocalHostname
+	}
+	printer.SetTableAlign(0)
+	printer.SetTablePadding(IndentTwoSpaces)
+	printer.Printf(format, header, data)
+}
+
+/* Reset clears the statistics before the next round. */
+func (m *MTR) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reset = true
+}
+
+func (m *MTR) paused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Paused
+}
+
+/* TogglePause stops or continues sending probes. */
+func (m *MTR) TogglePause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Paused = !m.Paused
+}
+
+/* ToggleDisplay switches to the next display mode. */
+func (m *MTR) ToggleDisplay() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Display = (m.Display + 1) % mtrDisplayModes
+}
+
+/* ToggleJitter switches the statistics between latency and jitter. */
+func (m *MTR) ToggleJitter() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Jitter = !m.Jitter
+}
+
+/* ToggleDNS shows or hides the PTR of each hop, the lookup is opened before it is published to Summary. */
+func (m *MTR) ToggleDNS() {
+	if m.view().lookup == nil {
+		lookup := &HopLookup{DNS: true}
+		if err := lookup.Open(); err != nil {
+			logger.Debug(err.Error())
+			return
+		}
+		m.mu.Lock()
+		if m.trace.Lookup == nil {
+			m.trace.Lookup = lookup
+		}
+		m.mu.Unlock()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.DNS = !m.DNS
+}
+
+/* Rows returns the rows of the last Summary. */
+func (m *MTR) Rows() [][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Statistics
+}
+
+/* header returns the column titles of the current display mode, the caller holds the lock. */
+func (m *MTR) header() string {
+	switch {
+	case m.Display == mtrDisplayHeatmap:
+		return fmt.Sprintf("%-*s", len(mtrStatHeader), "Latency heatmap")
+	case m.Display == mtrDisplaySparkline:
+		return fmt.Sprintf("%-*s", len(mtrStatHeader), "Latency sparkline")
+	case m.Jitter:
+		return mtrJitterHeader
+	}
+	return mtrStatHeader
+}
+
+/* host returns the hop number, IP and the enabled lookup results. */
+func (m *MTR) host(view mtrView, v ICMPStat) string {
+	host := fmt.Sprintf("%d. %s", v.Hop, v.DstIP)
+	if view.lookup == nil || v.DstIP == "*" {
+		return host
+	}
+	info := view.lookup.Get(v.DstIP)
+	if !view.dns {
+		info.PTR = ""
+	}
+	if s := info.String(); s != "" {
+		host += " " + s
+	}
+	return host
+}
+
+/* jitter returns the last, mean, worst and interarrival (RFC 3550) jitter of the replies. */
+func (m *MTR) jitter(rtts []time.Duration) (time.Duration, time.Duration, time.Duration, time.Duration) {
+	var last, sum, worst, inter, prev time.Duration
+	var n int
+	for _, v := range rtts {
+		if v == 0 {
+			continue
+		}
+		if prev != 0 {
+			d := v - prev
+			if d < 0 {
+				d = -d
+			}
+			last = d
+			sum += d
+			n++
+			if d > worst {
+				worst = d
+			}
+			inter += (d - inter) / 16
+		}
+		prev = v
+	}
+	if n == 0 {
+		return 0, 0, 0, 0
+	}
+	return last, sum / time.Duration(n), worst, inter
+}
+
+/* heatmap draws the latest replies as colored bars, lost packets are red question marks. */
+func (m *MTR) heatmap(v ICMPStat, width int) string {
+	const bars = "▁▂▃▄▅▆▇█"
+	rtts := v.Rtts
+	if len(rtts) > width {
+		rtts = rtts[len(rtts)-width:]
+	}
+	avg, _ := m.stat(v)
+	var out strings.Builder
+	for _, rtt := range rtts {
+		if rtt == 0 {
+			out.WriteString("[?](fg:red)")
+			continue
+		}
+		level := 0
+		if v.Max > v.Min {
+			level = int(float64(rtt-v.Min) / float64(v.Max-v.Min) * 7)
+		}
+		color := "green"
+		switch {
+		case avg != 0 && rtt > 2*avg:
+			color = "red"
+		case avg != 0 && rtt*4 > avg*5:
+			color = "yellow"
+		}
+		out.WriteString(fmt.Sprintf("[%s](fg:%s)", string([]rune(bars)[level]), color))
+	}
+	return out.String()
+}
+
+/* SparklineGroup returns the latency history of every hop, or nil if there is no data yet. */
+func (m *MTR) SparklineGroup(width int) *widgets.SparklineGroup {
+	view := m.view()
+	var lines []*widgets.Sparkline
+	for _, v := range m.trace.Stats() {
+		rtts := v.Rtts
+		if len(rtts) > width {
+			rtts = rtts[len(rtts)-width:]
+		}
+		line := widgets.NewSparkline()
+		avg, _ := m.stat(v)
+		line.Title = fmt.Sprintf("%s  avg %s  max %s", m.host(view, v), m.trim(avg.String()), m.trim(v.Max.String()))
+		line.LineColor = termui.ColorGreen
+		for _, rtt := range rtts {
+			ms := float64(rtt) / float64(time.Millisecond)
+			line.Data = append(line.Data, ms)
+			if ms > line.MaxVal {
+				line.MaxVal = ms
+			}
+		}
+		if line.MaxVal == 0 {
+			line.MaxVal = 1
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	group := widgets.NewSparklineGroup(lines...)
+	group.Border = false
+	return group
+}
+
+/* Summary renders the statistics of every hop into Statistics, it keeps the last rows until there are new statistics. */
 func (m *MTR) Summary() {
+	hops := m.trace.Stats()
+	if len(hops) == 0 {
+		return
+	}
+	view := m.view()
 	var rows [][]string
-	for _, v := range m.trace.Stat {
-		var avg time.Duration
-		if v.Receive == 0 {
-			avg = 0
-		} else {
-			avg = v.Avg / time.Duration(v.Receive)
+	for _, v := range hops {
+		if len(v.Rtts) == 0 {
+			continue
+		}
+		host := m.host(view, v)
+		width := view.width - len(mtrStatHeader) - 3
+		if width < 19 {
+			width = 19
 		}
-		var temp float64
-		for _, vv := range v.Rtts {
-			temp += math.Pow(float64(vv-avg), 2)
+		if r := []rune(host); len(r) > width {
+			host = string(r[:width])
 		}
-		variance := temp / float64(len(v.Rtts))
-		mdev := time.Duration(math.Sqrt(variance))
 
-		host := fmt.Sprintf("%d. %s", v.Hop, v.DstIP)
-		if len(v.Rtts)-1 < 0 {
-			time.Sleep(time.Second)
+		var stats string
+		switch {
+		case view.display != mtrDisplayStatistics:
+			stats = m.heatmap(v, len(mtrStatHeader))
+		case view.jitter:
+			last, avg, worst, inter := m.jitter(v.Rtts)
+			stats = fmt.Sprintf("%5s%% %5s  %5s %5s %5s %5s %5s",
+				fmt.Sprintf("%.1f", float64(v.Loss*100)/float64(v.Send)),
+				strconv.Itoa(v.Send),
+				m.trim(v.Rtts[len(v.Rtts)-1].String()),
+				m.trim(last.String()), m.trim(avg.String()),
+				m.trim(worst.String()), m.trim(inter.String()))
+		default:
+			avg, mdev := m.stat(v)
+			stats = fmt.Sprintf("%5s%% %5s  %5s %5s %5s %5s %5s",
+				fmt.Sprintf("%.1f", float64(v.Loss*100)/float64(v.Send)),
+				strconv.Itoa(v.Send),
+				m.trim(v.Rtts[len(v.Rtts)-1].String()),
+				m.trim(avg.String()), m.trim(v.Min.String()),
+				m.trim(v.Max.String()), m.trim(mdev.String()))
 		}
-		stats := fmt.Sprintf("%5s%% %5s  %5s %5s %5s %5s %5s",
-			fmt.Sprintf("%.1f", float64(v.Loss*100)/float64(v.Send)),
-			strconv.Itoa(v.Send),
-			m.trim(v.Rtts[len(v.Rtts)-1].String()),
-			m.trim(avg.String()), m.trim(v.Min.String()),
-			m.trim(v.Max.String()), m.trim(mdev.String()))
-		spaces := strings.Repeat(" ", m.TerminalWidth-19-len(mtrStatHeader)-3)
 
-		rows = append(rows, []string{fmt.Sprintf("%-19s", host) + spaces + stats})
+		rows = append(rows, []string{fmt.Sprintf("%-*s", width, host) + stats})
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.Statistics = rows
 }
 
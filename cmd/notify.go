@@ -0,0 +1,1000 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	tgBot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/slack-go/slack"
+	"github.com/spf13/cobra"
+)
+
+func initNotify() *cobra.Command {
+	var flags struct {
+		to      []string
+		arg     string
+		message NotifyMessage
+		queue   NotifyQueue
+	}
+	var notifyCmd = &cobra.Command{
+		GroupID: getGroupID(CommandNotify),
+		Use:     CommandNotify,
+		Short:   "Send message to several IM backends at once",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	run := func(cmd *cobra.Command, _ []string) {
+		if (flags.arg == "" && flags.message.Template == "") || len(flags.to) == 0 || rootConfig == "" {
+			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
+			printer.Error(common.ErrInvalidFlag)
+			return
+		}
+		var err error
+		if cmd.Name() == CommandText {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				return
+			}
+		} else if !common.IsFile(flags.arg) && !common.IsURL(flags.arg) {
+			logger.Error(common.ErrInvalidFile.Error())
+			return
+		}
+		notifiers, results := flags.queue.notifiers(flags.to)
+		results = append(results, Notify(notifiers, cmd.Name(), flags.arg)...)
+		sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+
+		var failed int
+		for _, v := range results {
+			if v.Error != "" {
+				failed++
+				logger.Error(v.Error, common.NewField("target", v.Target))
+			}
+		}
+		if !printer.IsTableFormat(rootOutputFormat) {
+			printer.Printf(rootOutputFormat, results)
+		} else {
+			header := []string{"Target", "Status", "Error"}
+			var data [][]string
+			for _, v := range results {
+				status := "ok"
+				if v.Error != "" {
+					status = "failed"
+				}
+				data = append(data, []string{v.Target, status, v.Error})
+			}
+			/* tablewriter.ALIGN_LEFT */
+			printer.SetTableAlign(3)
+			printer.SetTablePadding(IndentTwoSpaces)
+			printer.Printf(printer.SetTableAsDefaultFormat(rootOutputFormat), header, data)
+		}
+		if failed != 0 {
+			printer.Error(fmt.Errorf("%w: %d of %d notifications failed", common.ErrResponse, failed, len(results)))
+		}
+	}
+
+	var notifySubCmdFile = &cobra.Command{
+		Use:   CommandFile,
+		Short: "Send file to every target",
+		Run:   run,
+		Example: common.Examples(`# Send file to the channels of the oncall group
+--to oncall -a /tmp/report.csv --config ~/.config.toml`, CommandNotify, CommandFile),
+	}
+
+	var notifySubCmdPhoto = &cobra.Command{
+		Use:   CommandPhoto,
+		Short: "Send photo to every target",
+		Run:   run,
+		Example: common.Examples(`# Send photo to Slack and Discord
+--to slack+discord -a ~/graph.png --config ~/.config.toml`, CommandNotify, CommandPhoto),
+	}
+
+	var notifySubCmdText = &cobra.Command{
+		Use:   CommandText,
+		Short: "Send text to every target",
+		Run:   run,
+		Example: common.Examples(`# Groups are defined in the notify block of the config,
+# e.g. oncall = "slack+telegram", backends read their own blocks,
+# and slack.ops reads the ops table inside the slack block.
+--to oncall -a 'disk usage of db1 is over 90%' --config ~/.config.toml
+--to telegram,slack.ops -a 'deploy finished' --config ~/.config.toml
+
+# Render a template with variables, the format of each backend is set in its block
+--to oncall --template deploy.tmpl --var version=v1.2.0 --var env=prod --config ~/.config.toml`, CommandNotify, CommandText),
+	}
+
+	notifyCmd.PersistentFlags().StringSliceVar(&flags.to, "to", nil, common.Usage("Groups or backends (discord/email/line/pagerduty/slack/teams/telegram/webhook), joined by + or ,"))
+	notifyCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads text from stdin"))
+	flags.message.addFlags(notifyCmd, nil, false)
+	flags.queue.addFlags(notifyCmd)
+
+	notifiers := make(map[string]Notifier)
+	notifySubCmdFlush := flags.queue.flushCommand(CommandNotify, func() error {
+		if rootConfig == "" {
+			return common.ErrInvalidFlag
+		}
+		return nil
+	}, func(entry NotifyOutboxEntry) error {
+		n, ok := notifiers[entry.Target]
+		if !ok {
+			var err error
+			if n, err = NewNotifier(entry.Target); err != nil {
+				return err
+			}
+			notifiers[entry.Target] = n
+		}
+		return notifySend(n, entry.Kind, entry.Arg)
+	})
+
+	notifyCmd.AddCommand(notifySubCmdFile, notifySubCmdFlush, notifySubCmdPhoto, notifySubCmdText)
+	return notifyCmd
+}
+
+/* Notifier is implemented by every IM backend, path is a local file or an URL. */
+type Notifier interface {
+	Text(msg string) error
+	File(path string) error
+	Image(path string) error
+}
+
+/* plainNotifier sends text without the markup of its format, for generated text like alerts which quote URLs and errors. */
+type plainNotifier interface {
+	Plain(msg string) error
+}
+
+/* notifierSetup is a Notifier which connects after its fields are read from the config. */
+type notifierSetup interface {
+	Notifier
+	setup() error
+}
+
+var notifierBackends = map[string]func() notifierSetup{
+	CommandDiscord:   func() notifierSetup { return new(DiscordNotifier) },
+	CommandEmail:     func() notifierSetup { return new(Email) },
+	CommandLINE:      func() notifierSetup { return new(LINENotifier) },
+	CommandPagerDuty: func() notifierSetup { return new(PagerDuty) },
+	CommandSlack:     func() notifierSetup { return new(SlackNotifier) },
+	CommandTeams:     func() notifierSetup { return new(Teams) },
+	CommandTelegram:  func() notifierSetup { return new(TelegramNotifier) },
+	CommandWebhook:   func() notifierSetup { return new(Webhook) },
+}
+
+/* NewNotifier builds a backend from its config block, slack.ops reads the ops table inside the slack block. */
+func NewNotifier(target string) (Notifier, error) {
+	backend, name, _ := strings.Cut(target, ".")
+	newNotifier, ok := notifierBackends[backend]
+	if !ok {
+		logger.Debug(common.ErrInvalidArg.Error(), common.DefaultField(target))
+		return nil, fmt.Errorf("%w: unknown target %s", common.ErrInvalidArg, target)
+	}
+	values, err := common.ConfigTable(rootConfig, backend)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, backend)
+	}
+	if name != "" {
+		if values, ok = values[strings.ToLower(name)].(map[string]any); !ok {
+			logger.Debug(common.ErrConfigTable.Error(), common.DefaultField(target))
+			return nil, fmt.Errorf("%w: %s", common.ErrConfigTable, target)
+		}
+	}
+	n := newNotifier()
+	if err = Encoder.JSONMarshaler(values, n); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(target))
+		return nil, err
+	}
+	if err = n.setup(); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(target))
+		return nil, err
+	}
+	return n, nil
+}
+
+/* readNotifyChannels reads groups of the notify block, a value is a string or an array of targets, there are none without --config or the block. */
+func readNotifyChannels() (map[string]string, error) {
+	channels := make(map[string]string)
+	if rootConfig == "" {
+		return channels, nil
+	}
+	table, err := common.ConfigTable(rootConfig, CommandNotify)
+	if errors.Is(err, common.ErrConfigTable) {
+		return channels, nil
+	}
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(rootConfig))
+		return nil, err
+	}
+	for k, v := range table {
+		switch value := v.(type) {
+		case string:
+			channels[k] = value
+		case []any:
+			var targets []string
+			for _, t := range value {
+				targets = append(targets, fmt.Sprint(t))
+			}
+			channels[k] = strings.Join(targets, "+")
+		}
+	}
+	return channels, nil
+}
+
+/* ResolveNotifyTargets expands groups in channels recursively and removes duplicates. */
+func ResolveNotifyTargets(channels map[string]string, targets []string) []string {
+	var result []string
+	var expand func(string, []string)
+	expand = func(s string, seen []string) {
+		for _, v := range strings.FieldsFunc(s, func(r rune) bool { return r == '+' || r == ',' }) {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if group, ok := channels[v]; ok && !slices.Contains(seen, v) {
+				expand(group, append(seen, v))
+				continue
+			}
+			if !slices.Contains(result, v) {
+				result = append(result, v)
+			}
+		}
+	}
+	for _, v := range targets {
+		expand(v, nil)
+	}
+	return result
+}
+
+type NotifyResult struct {
+	Target string `json:"target" yaml:"target"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+/* Notify sends to all notifiers concurrently, kind is text, file or photo. */
+func Notify(notifiers map[string]Notifier, kind, arg string) []NotifyResult {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make([]NotifyResult, 0, len(notifiers))
+	for target, n := range notifiers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := notifySend(n, kind, arg)
+			result := NotifyResult{Target: target}
+			if err != nil {
+				logger.Debug(err.Error(), common.NewField("target", target))
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results
+}
+
+/* NotifySent is the message sent by an IM command, ID is the value of --edit, and of --thread to reply to it. */
+type NotifySent struct {
+	ID      string `json:"id" yaml:"id"`
+	Channel string `json:"channel" yaml:"channel"`
+	Thread  string `json:"thread,omitempty" yaml:"thread,omitempty"`
+}
+
+/* addReplyFlags adds --thread and --edit, thread is described by the backend. */
+func addReplyFlags(cmd *cobra.Command, thread, edit *string, usage string) {
+	cmd.PersistentFlags().StringVar(thread, "thread", "", common.Usage(usage))
+	cmd.PersistentFlags().StringVar(edit, "edit", "", common.Usage("Edit the sent message of this ID instead of sending a new one, text only"))
+}
+
+/* notifySend sends arg by n, kind is text, plain, file or photo. */
+func notifySend(n Notifier, kind, arg string) error {
+	switch kind {
+	case CommandFile:
+		return n.File(arg)
+	case CommandPhoto:
+		return n.Image(arg)
+	case notifyKindPlain:
+		if p, ok := n.(plainNotifier); ok {
+			return p.Plain(arg)
+		}
+		return n.Text(arg)
+	default:
+		return n.Text(arg)
+	}
+}
+
+/* notifyRequest sends the request of config and returns the response body, a status other than 2xx is an error. */
+func notifyRequest(config common.HTTPConfig, uri string) ([]byte, error) {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	client, err := config.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := config.Do(common.Context, client, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(uri))
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		logger.Debug(common.ErrStatusCode.Error(), common.DefaultField(uri), common.NewField("body", string(body)))
+		return body, &notifyStatusError{
+			code:       resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			err:        fmt.Errorf("%w: %s %s", common.ErrStatusCode, resp.Status, bytes.TrimSpace(body)),
+		}
+	}
+	return body, nil
+}
+
+/* notifyStatusError is returned by notifyRequest for a status other than 2xx. */
+type notifyStatusError struct {
+	code       int
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *notifyStatusError) Error() string { return e.err.Error() }
+
+func (e *notifyStatusError) Unwrap() error { return e.err }
+
+/* parseRetryAfter parses Retry-After in seconds or HTTP date. */
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+/* notifyJSON posts v as JSON, headers is the JSON object of extra headers. */
+func notifyJSON(uri, headers string, v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(v))
+		return nil, err
+	}
+	header := map[string]string{"Content-Type": "application/json"}
+	if headers != "" {
+		if err = json.Unmarshal([]byte(headers), &header); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(headers))
+			return nil, err
+		}
+	}
+	h, _ := json.Marshal(header)
+	return notifyRequest(common.HTTPConfig{Method: http.MethodPost, RawBody: body, Headers: string(h)}, uri)
+}
+
+const (
+	notifyFormatPlain    = "plain"
+	notifyFormatMarkdown = "markdown"
+	notifyFormatHTML     = "html"
+	notifyFormatBlocks   = "blocks"
+	notifyFormatEmbed    = "embed"
+
+	/* notifyKindPlain is text sent by Plain if the backend supports it. */
+	notifyKindPlain = "plain"
+)
+
+/* NotifyMessage builds the text of IM commands from -a, --template and --var, Format and Color are passed to the backend. */
+type NotifyMessage struct {
+	Template string
+	Vars     []string
+	Format   string
+	Color    string
+}
+
+/* addFlags adds --template and --var, and --format with --color if the backend supports any of formats. */
+func (m *NotifyMessage) addFlags(cmd *cobra.Command, formats []string, color bool) {
+	cmd.PersistentFlags().StringVar(&m.Template, "template", "", common.Usage("Go text/template file of the message, .Text is the input argument"))
+	cmd.PersistentFlags().StringSliceVar(&m.Vars, "var", nil, common.Usage("Template variables in key=value, -a - reads more from stdin as JSON"))
+	if len(formats) != 0 {
+		cmd.PersistentFlags().StringVar(&m.Format, "format", "", common.Usage("Message format ("+strings.Join(formats, "/")+")"))
+	}
+	if color {
+		cmd.PersistentFlags().StringVar(&m.Color, "color", "", common.Usage("Color (good/warning/danger/#rrggbb)"))
+	}
+}
+
+/* Render returns arg, or stdin if arg is -, executed by the template if there is one. */
+func (m NotifyMessage) Render(arg string, stdin io.Reader) (string, error) {
+	text := arg
+	data := make(map[string]any)
+	if arg == "-" {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			logger.Debug(err.Error())
+			return "", err
+		}
+		text = strings.TrimRight(string(b), "\r\n")
+		if m.Template != "" && json.Unmarshal(b, &data) == nil {
+			text = ""
+		} else {
+			data = make(map[string]any)
+		}
+	}
+	for _, v := range m.Vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			logger.Debug(common.ErrInvalidArg.Error(), common.DefaultField(v))
+			return "", fmt.Errorf("%w: %s", common.ErrInvalidArg, v)
+		}
+		data[key] = value
+	}
+	if m.Template == "" {
+		if text == "" {
+			return "", common.ErrInvalidFlag
+		}
+		return text, nil
+	}
+	if _, ok := data["Text"]; !ok {
+		data["Text"] = text
+	}
+	content, err := os.ReadFile(m.Template)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(m.Template))
+		return "", err
+	}
+	tmpl, err := template.New(filepath.Base(m.Template)).Funcs(notifyTemplateFuncs).Parse(string(content))
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(m.Template))
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(data))
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\r\n"), nil
+}
+
+var notifyTemplateFuncs = template.FuncMap{
+	"code": func(s any) string { return "```\n" + strings.TrimRight(fmt.Sprint(s), "\n") + "\n```" },
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"lower": func(s any) string { return strings.ToLower(fmt.Sprint(s)) },
+	"trim":  func(s any) string { return strings.TrimSpace(fmt.Sprint(s)) },
+	"upper": func(s any) string { return strings.ToUpper(fmt.Sprint(s)) },
+}
+
+/* notifyColor converts good, warning, danger or a hex color to #rrggbb and its value. */
+func notifyColor(color string) (string, int, error) {
+	switch strings.ToLower(color) {
+	case "good", "green":
+		color = "#2eb886"
+	case "warning", "yellow":
+		color = "#daa038"
+	case "danger", "red":
+		color = "#a30200"
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(color, "#")) != 6 {
+		logger.Debug(common.ErrInvalidArg.Error(), common.DefaultField(color))
+		return "", 0, fmt.Errorf("%w: color %s", common.ErrInvalidArg, color)
+	}
+	return "#" + strings.TrimPrefix(color, "#"), int(value), nil
+}
+
+/* errNotifyFormat is returned by backends which do not support format. */
+func errNotifyFormat(backend, format string) error {
+	logger.Debug(common.ErrInvalidArg.Error(), common.NewField("backend", backend), common.NewField("format", format))
+	return fmt.Errorf("%w: %s does not support format %s", common.ErrInvalidArg, backend, format)
+}
+
+const (
+	notifyMaxBackoff = 30 * time.Second
+	notifyMaxWait    = time.Minute
+)
+
+/* NotifyQueue retries failed sends, messages which still fail on a temporary error are queued into Outbox. */
+type NotifyQueue struct {
+	Retry  int           `json:"retry"`
+	Wait   time.Duration `json:"-"`
+	Outbox string        `json:"outbox"`
+}
+
+/* NotifyOutboxEntry is a line of the outbox, Target is the backend or backend.table of the notify command. */
+type NotifyOutboxEntry struct {
+	Target string    `json:"target" yaml:"target"`
+	Kind   string    `json:"kind" yaml:"kind"`
+	Arg    string    `json:"arg" yaml:"arg"`
+	Time   time.Time `json:"time" yaml:"time"`
+	Error  string    `json:"error,omitempty" yaml:"error,omitempty"`
+	/* Options are flags of the backend to resend with, e.g. the caption of Telegram. */
+	Options map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+	/* Status is sent, queued or dropped after a flush. */
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+/* notifiers builds the targets of groups and backends in to, wrapped by q, failed targets are returned as results. */
+func (q NotifyQueue) notifiers(to []string) (map[string]Notifier, []NotifyResult) {
+	var channels map[string]string
+	var channelsErr error
+	for _, v := range ResolveNotifyTargets(nil, to) {
+		backend, _, _ := strings.Cut(v, ".")
+		if _, ok := notifierBackends[backend]; !ok {
+			channels, channelsErr = readNotifyChannels()
+			break
+		}
+	}
+
+	notifiers := make(map[string]Notifier)
+	var results []NotifyResult
+	for _, target := range ResolveNotifyTargets(channels, to) {
+		n, err := NewNotifier(target)
+		if err != nil {
+			/* A group may be unknown because the config could not be read. */
+			if backend, _, _ := strings.Cut(target, "."); notifierBackends[backend] == nil && channelsErr != nil {
+				err = channelsErr
+			}
+			results = append(results, NotifyResult{Target: target, Error: err.Error()})
+			continue
+		}
+		notifiers[target] = q.wrap(target, n)
+	}
+	return notifiers, results
+}
+
+/* notifyOptions returns pairs of key and value as Options of NotifyOutboxEntry, empty values are skipped. */
+func notifyOptions(pairs ...string) map[string]string {
+	var options map[string]string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options[pairs[i]] = pairs[i+1]
+	}
+	return options
+}
+
+/* notifyOption returns the option key of entry, or value if entry has none. */
+func notifyOption(entry NotifyOutboxEntry, key, value string) string {
+	if v, ok := entry.Options[key]; ok {
+		return v
+	}
+	return value
+}
+
+func (q *NotifyQueue) addFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().IntVar(&q.Retry, "retry", 3, common.Usage("Retries on rate limits, 5xx and network errors"))
+	cmd.PersistentFlags().DurationVar(&q.Wait, "retry-wait", time.Second, common.Usage("First backoff of retries, doubled every retry, Retry-After takes precedence"))
+	cmd.PersistentFlags().StringVar(&q.Outbox, "outbox", "", common.Usage("Queue messages which still fail into this file, resend them by the flush subcommand"))
+}
+
+/* Send calls send with retries, entry is queued if it still fails on a temporary error. */
+func (q NotifyQueue) Send(entry NotifyOutboxEntry, send func() error) error {
+	err := q.retry(entry.Target, send)
+	if err == nil || q.Outbox == "" {
+		return err
+	}
+	if _, ok := notifyTemporary(err); !ok {
+		return err
+	}
+	entry.Time, entry.Error = time.Now(), err.Error()
+	if qerr := q.enqueue(entry); qerr != nil {
+		return errors.Join(err, qerr)
+	}
+	return fmt.Errorf("%w, queued into %s", err, q.Outbox)
+}
+
+/* wrap returns n which sends through q, target is the name in the outbox. */
+func (q NotifyQueue) wrap(target string, n Notifier) Notifier {
+	return queuedNotifier{Notifier: n, target: target, queue: q}
+}
+
+type queuedNotifier struct {
+	Notifier
+	target string
+	queue  NotifyQueue
+}
+
+func (n queuedNotifier) send(kind, arg string) error {
+	return n.queue.Send(NotifyOutboxEntry{Target: n.target, Kind: kind, Arg: arg}, func() error {
+		return notifySend(n.Notifier, kind, arg)
+	})
+}
+
+func (n queuedNotifier) Text(msg string) error { return n.send(CommandText, msg) }
+
+func (n queuedNotifier) Plain(msg string) error { return n.send(notifyKindPlain, msg) }
+
+func (n queuedNotifier) File(path string) error { return n.send(CommandFile, path) }
+
+func (n queuedNotifier) Image(path string) error { return n.send(CommandPhoto, path) }
+
+func (q NotifyQueue) retry(target string, send func() error) error {
+	backoff := q.Wait
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for i := 0; ; i++ {
+		err := send()
+		if err == nil || i >= q.Retry {
+			return err
+		}
+		wait, ok := notifyTemporary(err)
+		if !ok || wait > notifyMaxWait {
+			return err
+		}
+		if wait <= 0 {
+			wait = min(backoff<<i, notifyMaxBackoff)
+		}
+		logger.Warn(err.Error(), common.NewField("target", target), common.NewField("retry", i+1), common.NewField("wait", wait.String()))
+		select {
+		case <-common.Context.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+/* notifyTemporary reports whether err is worth a retry, and the wait time the server asked for. */
+func notifyTemporary(err error) (time.Duration, bool) {
+	var (
+		status       *notifyStatusError
+		slackLimit   *slack.RateLimitedError
+		slackStatus  slack.StatusCodeError
+		telegramErr  *tgBot.Error
+		discordLimit *discordgo.RateLimitError
+		discordErr   *discordgo.RESTError
+		lineErr      *linebot.APIError
+		smtpErr      *textproto.Error
+		netErr       net.Error
+	)
+	retryStatus := func(code int) bool {
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return 0, false
+	case errors.As(err, &status):
+		return status.retryAfter, retryStatus(status.code)
+	case errors.As(err, &slackLimit):
+		return slackLimit.RetryAfter, true
+	case errors.As(err, &slackStatus):
+		return 0, retryStatus(slackStatus.Code)
+	case errors.As(err, &telegramErr):
+		return time.Duration(telegramErr.RetryAfter) * time.Second, telegramErr.RetryAfter > 0 || retryStatus(telegramErr.Code)
+	case errors.As(err, &discordLimit):
+		return discordLimit.RetryAfter, true
+	case errors.As(err, &discordErr):
+		return 0, discordErr.Response != nil && retryStatus(discordErr.Response.StatusCode)
+	case errors.As(err, &lineErr):
+		return 0, retryStatus(lineErr.Code)
+	case errors.As(err, &smtpErr):
+		return 0, smtpErr.Code >= 400 && smtpErr.Code < 500
+	case errors.As(err, &netErr):
+		return 0, true
+	}
+	return 0, false
+}
+
+/* enqueue appends entry to the outbox, a line is written at once so concurrent commands can share the outbox. */
+func (q NotifyQueue) enqueue(entries ...NotifyOutboxEntry) error {
+	var buf bytes.Buffer
+	for _, v := range entries {
+		v.Status = ""
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if dir := filepath.Dir(q.Outbox); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(dir))
+			return err
+		}
+	}
+	f, err := os.OpenFile(q.Outbox, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(q.Outbox))
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+/*
+Flush resends the entries which target matches, entries failing on a temporary error stay in the outbox,
+the others are dropped. The outbox is renamed while flushing so commands still append to a new one.
+*/
+func (q NotifyQueue) Flush(match func(target string) bool, send func(NotifyOutboxEntry) error) ([]NotifyOutboxEntry, error) {
+	lock, err := os.OpenFile(q.Outbox+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(q.Outbox))
+		return nil, fmt.Errorf("%w, remove %s.lock if no flush is running", err, q.Outbox)
+	}
+	lock.Close()
+	defer os.Remove(q.Outbox + ".lock")
+
+	/* A leftover of an interrupted flush is read before the outbox is moved over it. */
+	flushing := q.Outbox + ".flushing"
+	entries, err := readOutbox(flushing)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Remove(flushing); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err = os.Rename(q.Outbox, flushing); err != nil && !os.IsNotExist(err) {
+		logger.Debug(err.Error(), common.DefaultField(q.Outbox))
+		return nil, err
+	}
+	queued, err := readOutbox(flushing)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 0 {
+		/* Keep the leftover in the flushing file until this flush is done. */
+		if err = (NotifyQueue{Outbox: flushing}).enqueue(entries...); err != nil {
+			return nil, err
+		}
+	}
+	entries = append(entries, queued...)
+
+	var results, remain []NotifyOutboxEntry
+	for _, v := range entries {
+		if !match(v.Target) {
+			remain = append(remain, v)
+			continue
+		}
+		err := q.retry(v.Target, func() error { return send(v) })
+		switch _, temporary := notifyTemporary(err); {
+		case err == nil:
+			v.Status, v.Error = "sent", ""
+		case temporary:
+			v.Status, v.Error = "queued", err.Error()
+			remain = append(remain, v)
+		default:
+			v.Status, v.Error = "dropped", err.Error()
+		}
+		results = append(results, v)
+	}
+	if len(remain) != 0 {
+		if err = q.enqueue(remain...); err != nil {
+			return results, err
+		}
+	}
+	return results, os.Remove(flushing)
+}
+
+/* readOutbox returns entries in path, a missing file has no entries. */
+func readOutbox(path string) ([]NotifyOutboxEntry, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(path))
+		return nil, err
+	}
+	var entries []NotifyOutboxEntry
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var v NotifyOutboxEntry
+		if err = json.Unmarshal(line, &v); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(string(line)))
+			return nil, fmt.Errorf("%w: %s", common.ErrConfigContent, path)
+		}
+		entries = append(entries, v)
+	}
+	return entries, nil
+}
+
+/* flushCommand returns the flush subcommand of backend, setup reads flags and config, send resends an entry. */
+func (q *NotifyQueue) flushCommand(backend string, setup func() error, send func(NotifyOutboxEntry) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   CommandFlush,
+		Short: "Resend messages queued in the outbox",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := setup(); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				return
+			}
+			if q.Outbox == "" {
+				logger.Error(common.ErrInvalidFlag.Error(), common.NewField("outbox", q.Outbox))
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
+			results, err := q.Flush(func(target string) bool { return backend == CommandNotify || target == backend }, send)
+			printNotifyOutbox(results)
+			if err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Resend messages which failed on rate limits or network errors
+--outbox ~/.ops-cli/outbox.jsonl --config ~/.config.toml`, backend, CommandFlush),
+	}
+}
+
+func printNotifyOutbox(results []NotifyOutboxEntry) {
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, results)
+		return
+	}
+	header := []string{"Time", "Target", "Kind", "Status", "Error"}
+	var data [][]string
+	for _, v := range results {
+		data = append(data, []string{v.Time.Local().Format(time.DateTime), v.Target, v.Kind, v.Status, v.Error})
+	}
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	printer.Printf(printer.SetTableAsDefaultFormat(rootOutputFormat), header, data)
+}
+
+/* ChatOps runs the ops-cli commands sent from chats, only Commands are allowed. */
+type ChatOps struct {
+	Commands []string      `json:"commands"`
+	Timeout  time.Duration `json:"-"`
+	/* Concurrency limits the commands running at once, defaults to chatOpsConcurrency. */
+	Concurrency int `json:"concurrency"`
+	/* Binary is the ops-cli to run, defaults to the running one. */
+	Binary string `json:"-"`
+
+	running atomic.Int32
+}
+
+const chatOpsConcurrency = 4
+
+/* chatOpsBusy is the reply to a command refused by Concurrency. */
+const chatOpsBusy = "Too many commands are running, try again later."
+
+func (c *ChatOps) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&c.Commands, "commands", []string{CommandCert, CommandDig, CommandPing, CommandTCPing, CommandWhois}, common.Usage("ops-cli commands allowed in chats"))
+	cmd.Flags().DurationVar(&c.Timeout, "timeout", 30*time.Second, common.Usage("Timeout of a command"))
+	cmd.Flags().IntVar(&c.Concurrency, "concurrency", chatOpsConcurrency, common.Usage("Commands running at once, more are refused"))
+}
+
+/* Go runs f in a goroutine if less than Concurrency of them are running, and reports whether it did. */
+func (c *ChatOps) Go(f func()) bool {
+	limit := c.Concurrency
+	if limit <= 0 {
+		limit = chatOpsConcurrency
+	}
+	if c.running.Add(1) > int32(limit) {
+		c.running.Add(-1)
+		logger.Warn(chatOpsBusy, common.NewField("concurrency", limit))
+		return false
+	}
+	go func() {
+		defer c.running.Add(-1)
+		f()
+	}()
+	return true
+}
+
+/* Help lists the allowed commands, prefix is how the chat invokes them. */
+func (c *ChatOps) Help(prefix string) string {
+	var help strings.Builder
+	help.WriteString("Commands:")
+	for _, v := range c.Commands {
+		help.WriteString("\n" + prefix + v + " args")
+	}
+	return help.String()
+}
+
+/* Exec runs Binary with command and args, and returns the combined output. */
+func (c *ChatOps) Exec(ctx context.Context, command string, args []string) (string, error) {
+	if !slices.Contains(c.Commands, command) {
+		logger.Debug(common.ErrInvalidArg.Error(), common.NewField("command", command))
+		return "", fmt.Errorf("%w: unknown command %s", common.ErrInvalidArg, command)
+	}
+	for _, v := range args {
+		if strings.HasPrefix(v, "--config") {
+			logger.Debug(common.ErrInvalidArg.Error(), common.DefaultField(args))
+			return "", fmt.Errorf("%w: --config is not allowed", common.ErrInvalidArg)
+		}
+		if chatOpsLocalPath(v) {
+			logger.Debug(common.ErrInvalidArg.Error(), common.DefaultField(v))
+			return "", fmt.Errorf("%w: local path %s is not allowed", common.ErrInvalidArg, v)
+		}
+	}
+	/* ping runs until it is interrupted without a count. */
+	if command == CommandPing && !slices.ContainsFunc(args, func(s string) bool { return strings.HasPrefix(s, "-c") || strings.HasPrefix(s, "--count") }) {
+		args = append([]string{"-c", "4"}, args...)
+	}
+	self := c.Binary
+	if self == "" {
+		var err error
+		if self, err = os.Executable(); err != nil {
+			logger.Debug(err.Error())
+			return "", err
+		}
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	/* #nosec G204 -- command is one of c.Commands and args are not passed to a shell. */
+	out, err := exec.CommandContext(ctx, self, append([]string{command}, args...)...).CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		text += "\n(timed out after " + timeout.String() + ")"
+	} else if err != nil && text == "" {
+		text = err.Error()
+	}
+	if text == "" {
+		text = "(no output)"
+	}
+	return text, nil
+}
+
+/* chatOpsLocalPath reports whether arg, the value of a flag or a @file reference resolves to a local path, like cert reading a file instead of a host. */
+func chatOpsLocalPath(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	if _, v, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(arg, "-") {
+		arg = v
+	}
+	return common.IsFile(arg) || (strings.HasPrefix(arg, "@") && common.IsFile(arg[1:]))
+}
+
+/* truncateText cuts text to n characters. */
+func truncateText(text string, n int) string {
+	if r := []rune(text); len(r) > n {
+		return string(r[:n]) + "\n..."
+	}
+	return text
+}
@@ -0,0 +1,222 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initPagerDuty() *cobra.Command {
+	var flags struct {
+		PagerDuty
+		NotifyQueue
+		arg string
+	}
+	var pagerdutyCmd = &cobra.Command{
+		GroupID: getGroupID(CommandPagerDuty),
+		Use:     CommandPagerDuty,
+		Short:   "Send events to PagerDuty",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandPagerDuty, &flags); err != nil {
+				return err
+			}
+		}
+		return flags.setup()
+	}
+	send := func(entry NotifyOutboxEntry) error {
+		switch entry.Kind {
+		case CommandAck, CommandResolve, CommandTrigger:
+			p := flags.PagerDuty
+			if key, ok := entry.Options["dedup_key"]; ok {
+				p.DedupKey = key
+			}
+			err := p.Event(entry.Kind, entry.Arg, nil)
+			flags.Response = p.Response
+			return err
+		}
+		/* Queued by the notify command. */
+		return notifySend(&flags.PagerDuty, entry.Kind, entry.Arg)
+	}
+
+	run := func(cmd *cobra.Command, _ []string) {
+		err := setup()
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if (cmd.Name() == CommandTrigger && flags.arg == "") || (cmd.Name() != CommandTrigger && flags.DedupKey == "") {
+			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
+			printer.Error(common.ErrInvalidFlag)
+			return
+		}
+		if cmd.Name() == CommandTrigger {
+			if flags.arg, err = (NotifyMessage{}).Render(flags.arg, os.Stdin); err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
+		entry := NotifyOutboxEntry{Target: CommandPagerDuty, Kind: cmd.Name(), Arg: flags.arg, Options: notifyOptions("dedup_key", flags.DedupKey)}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), flags.Response)
+	}
+
+	var pagerdutySubCmdAck = &cobra.Command{
+		Use:   CommandAck,
+		Short: "Acknowledge an alert by dedup key",
+		Run:   run,
+		Example: common.Examples(`# Acknowledge
+-t routing_key --dedup-key db1-disk`, CommandPagerDuty, CommandAck),
+	}
+
+	var pagerdutySubCmdResolve = &cobra.Command{
+		Use:   CommandResolve,
+		Short: "Resolve an alert by dedup key",
+		Run:   run,
+		Example: common.Examples(`# Resolve
+--dedup-key db1-disk --config ~/.config.toml`, CommandPagerDuty, CommandResolve),
+	}
+
+	var pagerdutySubCmdTrigger = &cobra.Command{
+		Use:   CommandTrigger,
+		Short: "Trigger an alert, the dedup key is printed",
+		Run:   run,
+		Example: common.Examples(`# Trigger
+-t routing_key -a "disk usage of db1 is over 90%" --severity critical --dedup-key db1-disk`, CommandPagerDuty, CommandTrigger),
+	}
+
+	pagerdutyCmd.PersistentFlags().StringVarP(&flags.RoutingKey, "routing-key", "t", "", common.Usage("Integration key of Events API v2 (required)"))
+	pagerdutyCmd.PersistentFlags().StringVar(&flags.Severity, "severity", "error", common.Usage("Severity (critical/error/warning/info)"))
+	pagerdutyCmd.PersistentFlags().StringVar(&flags.Source, "source", "", common.Usage("Source of the event, defaults to hostname"))
+	pagerdutyCmd.PersistentFlags().StringVar(&flags.DedupKey, "dedup-key", "", common.Usage("Deduplication key"))
+	pagerdutyCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Summary of the alert, - reads from stdin"))
+
+	flags.NotifyQueue.addFlags(pagerdutyCmd)
+
+	pagerdutyCmd.AddCommand(pagerdutySubCmdAck, flags.NotifyQueue.flushCommand(CommandPagerDuty, setup, send),
+		pagerdutySubCmdResolve, pagerdutySubCmdTrigger)
+	return pagerdutyCmd
+}
+
+/* PagerDuty sends Events API v2 events, URL defaults to the PagerDuty endpoint. */
+type PagerDuty struct {
+	RoutingKey string `json:"routing_key"`
+	Severity   string `json:"severity"`
+	Source     string `json:"source"`
+	DedupKey   string `json:"dedup_key"`
+	URL        string `json:"url"`
+
+	Response PagerDutyResponse `json:"-"`
+}
+
+/* pagerDutyMaxSummary is the longest summary accepted by Events API v2. */
+const pagerDutyMaxSummary = 1024
+
+type PagerDutyResponse struct {
+	Status   string `json:"status" yaml:"status"`
+	Message  string `json:"message" yaml:"message"`
+	DedupKey string `json:"dedup_key" yaml:"dedup_key"`
+}
+
+func (p *PagerDuty) setup() error {
+	if p.RoutingKey == "" {
+		logger.Debug(common.ErrInvalidToken.Error())
+		return common.ErrInvalidToken
+	}
+	if p.URL == "" {
+		p.URL = "https://events.pagerduty.com/v2/enqueue"
+	}
+	if p.Severity == "" {
+		p.Severity = "error"
+	}
+	if !slices.Contains([]string{"critical", "error", "warning", "info"}, p.Severity) {
+		return fmt.Errorf("%w: severity %s", common.ErrInvalidArg, p.Severity)
+	}
+	if p.Source == "" {
+		p.Source, _ = os.Hostname()
+	}
+	return nil
+}
+
+/* Text triggers an alert with msg as the summary. */
+func (p *PagerDuty) Text(msg string) error {
+	return p.Event(CommandTrigger, msg, nil)
+}
+
+/* File is not supported, events only link to images. */
+func (p *PagerDuty) File(path string) error {
+	logger.Debug(common.ErrInvalidFile.Error(), common.DefaultField(path))
+	return fmt.Errorf("%w: PagerDuty can not send files", common.ErrInvalidFile)
+}
+
+/* Image triggers an alert with the image, path has to be an URL. */
+func (p *PagerDuty) Image(path string) error {
+	if !common.IsURL(path) {
+		logger.Debug(common.ErrInvalidURL.Error(), common.DefaultField(path))
+		return common.ErrInvalidURL
+	}
+	return p.Event(CommandTrigger, path, []string{path})
+}
+
+/* Event sends action trigger, acknowledge or resolve, a trigger without dedup key opens a new alert. */
+func (p *PagerDuty) Event(action, summary string, images []string) error {
+	event := map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": action,
+	}
+	if p.DedupKey != "" {
+		event["dedup_key"] = p.DedupKey
+	}
+	if action == CommandTrigger {
+		/* Events longer than pagerDutyMaxSummary are rejected, truncateText appends a line of "...". */
+		summary = truncateText(summary, pagerDutyMaxSummary-len("\n..."))
+		payload := map[string]any{"summary": summary, "source": p.Source, "severity": p.Severity}
+		event["payload"] = payload
+		event["client"] = common.RepoName
+		var src []map[string]string
+		for _, v := range images {
+			src = append(src, map[string]string{"src": v})
+		}
+		if src != nil {
+			event["images"] = src
+		}
+	}
+	body, err := notifyJSON(p.URL, "", event)
+	if len(body) != 0 {
+		if err := json.Unmarshal(body, &p.Response); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(string(body)))
+		}
+	}
+	if err != nil && p.Response.Message != "" {
+		return fmt.Errorf("%w: %s", err, p.Response.Message)
+	}
+	return err
+}
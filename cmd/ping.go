@@ -346,6 +346,55 @@ func (p *Ping) summary(host string, t time.Duration) {
 	printer.Printf(out)
 }
 
+/* Echo sends one echo request to host and returns the round-trip time of its reply, Conn must be listened. */
+func (p *Ping) Echo(host string) (time.Duration, error) {
+	network, proto := "ip4", 1
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if p.IPv6 {
+		network, proto, typ = "ip6", 58, ipv6.ICMPTypeEchoRequest
+	}
+	addr, err := net.ResolveIPAddr(network, host)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(host))
+		return 0, err
+	}
+	id, seq := os.Getpid()&0xffff, int(time.Now().UnixNano()&0xffff)
+	b, err := (&icmp.Message{Type: typ, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte(common.RepoName)}}).Marshal(nil)
+	if err != nil {
+		logger.Debug(err.Error())
+		return 0, err
+	}
+	startTime := time.Now()
+	if _, err = p.Conn.WriteTo(b, addr); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(addr))
+		return 0, err
+	}
+	if err = p.Conn.SetReadDeadline(startTime.Add(p.Timeout)); err != nil {
+		logger.Debug(err.Error())
+		return 0, err
+	}
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := p.Conn.ReadFrom(reply)
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(addr))
+			return 0, err
+		}
+		result, err := icmp.ParseMessage(proto, reply[:n])
+		if err != nil || peer.String() != addr.String() {
+			continue
+		}
+		echo, ok := result.Body.(*icmp.Echo)
+		if !ok || echo.ID != id || echo.Seq != seq {
+			continue
+		}
+		switch result.Type {
+		case ipv4.ICMPTypeEchoReply, ipv6.ICMPTypeEchoReply:
+			return time.Since(startTime), nil
+		}
+	}
+}
+
 func ParseAnyIPv4Netip(input string) (netip.Addr, error) {
 	parts := strings.Split(input, ".")
 	switch len(parts) {
@@ -346,7 +346,7 @@ func (*Ps) String(header []string, data [][]string) {
 	printer.SetTableAlign(3)
 	printer.SetTablePadding(IndentTwoSpaces)
 	printer.SetTableFormatHeaders(true)
-	if rootOutputFormat != "" && rootOutputFormat != common.TableFormat {
+	if !printer.IsTableFormat(rootOutputFormat) {
 		printer.Printf(rootOutputFormat, data)
 		return
 	}
@@ -17,83 +17,265 @@ limitations under the License.
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/linzeyan/ops-cli/cmd/common"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func initRedis() *cobra.Command {
-	var flags struct {
-		Username string `json:"user"`
-		Password string `json:"auth"`
-		Host     string `json:"host"`
-		Port     string `json:"port"`
-		DB       int    `json:"db"`
-	}
+	var r Redis
+	var pipe string
 	var redisCmd = &cobra.Command{
-		Use:   CommandRedis,
+		Use:   CommandRedis + " [command]",
 		Short: "Opens a connection to a Redis server",
 		ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		},
 		Run: func(_ *cobra.Command, args []string) {
-			var r Redis
 			if rootConfig != "" {
-				if err := ReadConfig(CommandRedis, &flags); err != nil {
+				if err := ReadConfig(CommandRedis, &r); err != nil {
 					logger.Error(err.Error())
 					return
 				}
 			}
-			conn := r.Connection(flags.Host, flags.Port, flags.Username, flags.Password, flags.DB)
-			if conn == nil {
+			conn, err := r.Client()
+			if err != nil {
 				logger.Error(common.ErrFailedInitial.Error())
+				printer.Error(err)
 				return
 			}
-			if err := r.Do(conn, args); err != nil {
-				logger.Warn(err.Error())
+			defer conn.Close()
+			switch {
+			case pipe != "":
+				var in io.Reader = os.Stdin
+				if pipe != "-" {
+					f, err := os.Open(pipe)
+					if err != nil {
+						logger.Error(err.Error(), common.DefaultField(pipe))
+						printer.Error(err)
+						return
+					}
+					defer f.Close()
+					in = f
+				}
+				replies, errs, err := r.Pipe(common.Context, conn, in, os.Stderr)
+				if err != nil {
+					logger.Error(err.Error())
+					printer.Error(err)
+				}
+				printer.Printf("errors: %d, replies: %d\n", errs, replies)
+			case len(args) != 0:
+				if err := r.Do(conn, args); err != nil {
+					logger.Warn(err.Error())
+				}
+			default:
+				if err := r.Interactive(common.Context, conn, os.Stdin, os.Stdout); err != nil {
+					logger.Error(err.Error())
+					printer.Error(err)
+				}
 			}
 		},
+		Example: common.Examples(`# Run a command
+'set name Joe'
+get name
+
+# Start an interactive shell, up/down for history and tab to complete commands
+-h 10.0.0.1 -a password
+
+# Load commands from a file
+--pipe commands.txt
+
+# Connect to a cluster, or to the master of a sentinel group, over TLS
+--cluster --addrs 10.0.0.1:7000,10.0.0.2:7000 --tls --cacert ca.crt
+--sentinel mymaster --addrs 10.0.0.1:26379,10.0.0.2:26379`, CommandRedis),
 	}
 
-	redisCmd.Flags().StringVarP(&flags.Username, "user", "u", "", common.Usage("Username to authenticate the current connection"))
-	redisCmd.Flags().StringVarP(&flags.Password, "auth", "a", "", common.Usage("Password to use when connecting to the server"))
-	redisCmd.Flags().StringVarP(&flags.Host, "hostname", "h", "127.0.0.1", common.Usage("Server hostname"))
-	redisCmd.Flags().StringVarP(&flags.Port, "port", "p", "6379", common.Usage("Server port"))
-	redisCmd.Flags().IntVarP(&flags.DB, "db", "n", 0, common.Usage("Database number"))
+	redisCmd.PersistentFlags().StringVarP(&r.Username, "user", "u", "", common.Usage("Username to authenticate the current connection"))
+	redisCmd.PersistentFlags().StringVarP(&r.Password, "auth", "a", "", common.Usage("Password to use when connecting to the server"))
+	redisCmd.PersistentFlags().StringVarP(&r.Host, "hostname", "h", "127.0.0.1", common.Usage("Server hostname"))
+	redisCmd.PersistentFlags().StringVarP(&r.Port, "port", "p", "6379", common.Usage("Server port"))
+	redisCmd.PersistentFlags().IntVarP(&r.DB, "db", "n", 0, common.Usage("Database number"))
+	redisCmd.PersistentFlags().StringSliceVar(&r.Addrs, "addrs", nil, common.Usage("Addresses of cluster nodes or sentinels, default is hostname:port"))
+	redisCmd.PersistentFlags().BoolVarP(&r.Cluster, "cluster", "c", false, common.Usage("Connect to a cluster"))
+	redisCmd.PersistentFlags().StringVar(&r.Sentinel, "sentinel", "", common.Usage("Master name, connect to the master by sentinels"))
+	redisCmd.PersistentFlags().StringVar(&r.SentinelPassword, "sentinel-auth", "", common.Usage("Password of sentinels"))
+	redisCmd.PersistentFlags().BoolVar(&r.TLS, "tls", false, common.Usage("Establish a secure TLS connection"))
+	redisCmd.PersistentFlags().BoolVar(&r.Insecure, "insecure", false, common.Usage("Skip TLS certificate verification"))
+	redisCmd.PersistentFlags().StringVar(&r.CACert, "cacert", "", common.Usage("CA certificate file to verify the server"))
+	redisCmd.PersistentFlags().StringVar(&r.Cert, "cert", "", common.Usage("Client certificate file"))
+	redisCmd.PersistentFlags().StringVar(&r.Key, "key", "", common.Usage("Client private key file"))
+	redisCmd.Flags().StringVar(&pipe, "pipe", "", common.Usage("Send commands of a file, or stdin if -"))
+	redisCmd.Flags().Lookup("pipe").NoOptDefVal = "-"
+
+	var analysis RedisScanAnalysis
+	var redisSubCmdScanAnalysis = &cobra.Command{
+		Use:   CommandAnalysis,
+		Args:  cobra.NoArgs,
+		Short: "Find big keys, key prefixes and TTL distribution by SCAN",
+		Run: func(_ *cobra.Command, _ []string) {
+			if rootConfig != "" {
+				if err := ReadConfig(CommandRedis, &r); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+			}
+			conn, err := r.Client()
+			if err != nil {
+				logger.Error(common.ErrFailedInitial.Error())
+				printer.Error(err)
+				return
+			}
+			defer conn.Close()
+			ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+			defer cancel()
+			result, err := analysis.Run(ctx, conn)
+			if err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				if result == nil {
+					return
+				}
+			}
+			analysis.String(result)
+		},
+		Example: common.Examples(`# Analyze the keyspace
+scan-analysis -h 10.0.0.1
+
+# Rank the 20 keys with the most elements of every type, and group keys by two segments
+scan-analysis --by elements --top 20 --depth 2
+
+# Limit the load to 1000 keys per second and analyze matched keys only
+scan-analysis --rate 1000 --match 'session:*' --output json`, CommandRedis),
+	}
+	redisSubCmdScanAnalysis.Flags().Int64Var(&analysis.Count, "count", 1000, common.Usage("Keys returned by every SCAN"))
+	redisSubCmdScanAnalysis.Flags().IntVar(&analysis.Rate, "rate", 0, common.Usage("Maximum keys analyzed per second, 0 means unlimited"))
+	redisSubCmdScanAnalysis.Flags().StringVar(&analysis.Match, "match", "*", common.Usage("Analyze keys matching the pattern only"))
+	redisSubCmdScanAnalysis.Flags().StringVar(&analysis.By, "by", redisByMemory, common.Usage("Rank big keys by memory or elements"))
+	redisSubCmdScanAnalysis.Flags().IntVar(&analysis.Top, "top", 10, common.Usage("Big keys reported of every type, and prefixes reported"))
+	redisSubCmdScanAnalysis.Flags().StringVar(&analysis.Separator, "separator", ":", common.Usage("Separator of key segments"))
+	redisSubCmdScanAnalysis.Flags().IntVar(&analysis.Depth, "depth", 1, common.Usage("Segments of a key prefix"))
+	redisCmd.AddCommand(redisSubCmdScanAnalysis)
 	return redisCmd
 }
 
-type Redis struct{}
+type Redis struct {
+	Username string `json:"user"`
+	Password string `json:"auth"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	DB       int    `json:"db"`
+	/* Addrs are seeds of a cluster or sentinels, Host and Port are used if empty. */
+	Addrs            []string `json:"addrs"`
+	Cluster          bool     `json:"cluster"`
+	Sentinel         string   `json:"sentinel"`
+	SentinelPassword string   `json:"sentinel_auth"`
+	TLS              bool     `json:"tls"`
+	Insecure         bool     `json:"insecure"`
+	CACert           string   `json:"cacert"`
+	Cert             string   `json:"cert"`
+	Key              string   `json:"key"`
+}
 
-func (r *Redis) Connection(host, port, user, pass string, db int) *redis.Client {
-	if common.IsIP(host) || common.IsDomain(host) {
-		return redis.NewClient(&redis.Options{
-			Username: user,
-			Password: pass,
-			Addr:     net.JoinHostPort(host, port),
-			DB:       db,
-		})
+/* Client creates a single node, cluster or sentinel failover client. */
+func (r *Redis) Client() (redis.UniversalClient, error) {
+	addrs := r.Addrs
+	if len(addrs) == 0 {
+		if !common.IsIP(r.Host) && !common.IsDomain(r.Host) {
+			logger.Debug(common.ErrInvalidArg.Error(),
+				common.NewField("host", r.Host),
+				common.NewField("port", r.Port),
+				common.NewField("user", r.Username),
+				common.NewField("db", r.DB),
+			)
+			return nil, common.ErrInvalidArg
+		}
+		addrs = []string{net.JoinHostPort(r.Host, r.Port)}
 	}
-	logger.Debug(common.ErrInvalidArg.Error(),
-		common.NewField("host", host),
-		common.NewField("port", port),
-		common.NewField("user", user),
-		common.NewField("db", db),
-	)
-	return nil
+	tlsConfig, err := r.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case r.Sentinel != "":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       r.Sentinel,
+			SentinelAddrs:    addrs,
+			SentinelPassword: r.SentinelPassword,
+			Username:         r.Username,
+			Password:         r.Password,
+			DB:               r.DB,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case r.Cluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     addrs,
+			Username:  r.Username,
+			Password:  r.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+	return redis.NewClient(&redis.Options{
+		Username:  r.Username,
+		Password:  r.Password,
+		Addr:      addrs[0],
+		DB:        r.DB,
+		TLSConfig: tlsConfig,
+	}), nil
 }
 
-func (r *Redis) Do(rdb *redis.Client, commands []string) error {
+func (r *Redis) tlsConfig() (*tls.Config, error) {
+	if !r.TLS && !r.Insecure && r.CACert == "" && r.Cert == "" {
+		return nil, nil
+	}
+	client, err := common.HTTPConfig{Insecure: r.Insecure, CACert: r.CACert}.Client()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t, ok := client.Transport.(*http.Transport); ok {
+		config = t.TLSClientConfig
+	}
+	if r.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(r.Cert, r.Key)
+		if err != nil {
+			logger.Debug(err.Error(), common.NewField("cert", r.Cert), common.NewField("key", r.Key))
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (r *Redis) Do(rdb redis.UniversalClient, commands []string) error {
 	if len(commands) == 0 {
 		logger.Debug(common.ErrInvalidArg.Error(), common.NewField("commands", commands))
 		return nil
 	}
 	var args []string
 	if len(commands) == 1 {
-		args = strings.Fields(commands[0])
+		var err error
+		if args, err = redisSplitArgs(commands[0]); err != nil {
+			logger.Debug(err.Error(), common.NewField("commands", commands))
+			return err
+		}
 	} else {
 		args = commands
 	}
@@ -108,11 +290,596 @@ func (r *Redis) Do(rdb *redis.Client, commands []string) error {
 
 	switch data := out.(type) {
 	case []any:
-		for i := 0; i < len(data); i++ {
-			printer.Printf("%d) %s\n", i+1, data[i])
-		}
+		printer.Printf("%s\n", redisReply(data, nil))
 	default:
 		printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), out)
 	}
 	return err
 }
+
+/* Interactive reads commands from in and writes replies in the redis-cli format, a terminal gets a prompt, history and completion. */
+func (r *Redis) Interactive(ctx context.Context, rdb redis.UniversalClient, in io.Reader, out io.Writer) error {
+	var readLine func() (string, error)
+	var prompt func()
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			logger.Debug(err.Error())
+			return err
+		}
+		defer func() { _ = term.Restore(int(f.Fd()), state) }()
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{in, out}, "")
+		if commands, err := rdb.Command(ctx).Result(); err == nil {
+			t.AutoCompleteCallback = redisCompleter(commands)
+		}
+		readLine = t.ReadLine
+		prompt = func() { t.SetPrompt(r.prompt(rdb)) }
+		out = t
+	} else {
+		scanner := bufio.NewScanner(in)
+		readLine = func() (string, error) {
+			if scanner.Scan() {
+				return scanner.Text(), nil
+			}
+			if scanner.Err() != nil {
+				return "", scanner.Err()
+			}
+			return "", io.EOF
+		}
+		prompt = func() {}
+	}
+
+	/* selected is the client created by SELECT. */
+	var selected redis.UniversalClient
+	defer func() {
+		if selected != nil {
+			selected.Close()
+		}
+	}()
+	for {
+		prompt()
+		line, err := readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		args, err := redisSplitArgs(line)
+		if err != nil {
+			fmt.Fprintf(out, "(error) %s\r\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch strings.ToLower(args[0]) {
+		case "quit", "exit":
+			return nil
+		case "select":
+			/* Pooled connections have to be recreated for another database. */
+			if _, ok := rdb.(*redis.Client); ok && r.Sentinel == "" && len(args) == 2 {
+				db, err := strconv.Atoi(args[1])
+				if err != nil {
+					fmt.Fprintf(out, "(error) %s\r\n", common.ErrInvalidArg)
+					continue
+				}
+				current := r.DB
+				r.DB = db
+				next, err := r.Client()
+				if err == nil {
+					err = next.Ping(ctx).Err()
+				}
+				if err != nil {
+					r.DB = current
+					fmt.Fprintf(out, "(error) %s\r\n", err)
+					continue
+				}
+				if selected != nil {
+					selected.Close()
+				}
+				rdb, selected = next, next
+				fmt.Fprintf(out, "OK\r\n")
+				continue
+			}
+		}
+		v, err := rdb.Do(ctx, common.SliceStringToInterface(args)...).Result()
+		fmt.Fprintf(out, "%s\r\n", strings.ReplaceAll(redisReply(v, err), "\n", "\r\n"))
+	}
+}
+
+func (r *Redis) prompt(rdb redis.UniversalClient) string {
+	switch {
+	case r.Cluster:
+		return "cluster> "
+	case r.Sentinel != "":
+		return r.Sentinel + "> "
+	}
+	addr := net.JoinHostPort(r.Host, r.Port)
+	if c, ok := rdb.(*redis.Client); ok {
+		addr = c.Options().Addr
+	}
+	if r.DB != 0 {
+		addr += fmt.Sprintf("[%d]", r.DB)
+	}
+	return addr + "> "
+}
+
+/* Pipe sends every line of in as a command in batches, errors are written to out. */
+func (r *Redis) Pipe(ctx context.Context, rdb redis.UniversalClient, in io.Reader, out io.Writer) (int, int, error) {
+	const batch = 1000
+	var replies, errs int
+	pipe := rdb.Pipeline()
+	exec := func() error {
+		cmds, err := pipe.Exec(ctx)
+		if err != nil && !errors.Is(err, redis.Nil) && len(cmds) == 0 {
+			return err
+		}
+		for _, cmd := range cmds {
+			replies++
+			if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+				errs++
+				fmt.Fprintf(out, "(error) %s\n", err)
+			}
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 512*1024*1024)
+	for n := 0; scanner.Scan(); {
+		args, err := redisSplitArgs(scanner.Text())
+		if err != nil {
+			errs++
+			fmt.Fprintf(out, "(error) %s\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		pipe.Do(ctx, common.SliceStringToInterface(args)...)
+		if n++; n%batch == 0 {
+			if err = exec(); err != nil {
+				return replies, errs, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Debug(err.Error())
+		return replies, errs, err
+	}
+	return replies, errs, exec()
+}
+
+/* redisReply formats a reply like redis-cli. */
+func redisReply(v any, err error) string {
+	switch {
+	case errors.Is(err, redis.Nil):
+		return "(nil)"
+	case err != nil:
+		return "(error) " + err.Error()
+	}
+	switch data := v.(type) {
+	case nil:
+		return "(nil)"
+	case int64:
+		return fmt.Sprintf("(integer) %d", data)
+	case string:
+		return strconv.Quote(data)
+	case []any:
+		if len(data) == 0 {
+			return "(empty array)"
+		}
+		var sb strings.Builder
+		width := len(strconv.Itoa(len(data)))
+		for i, e := range data {
+			if i != 0 {
+				sb.WriteString("\n")
+			}
+			index := fmt.Sprintf("%*d) ", width, i+1)
+			lines := strings.Split(redisReply(e, nil), "\n")
+			sb.WriteString(index + lines[0])
+			for _, l := range lines[1:] {
+				sb.WriteString("\n" + strings.Repeat(" ", len(index)) + l)
+			}
+		}
+		return sb.String()
+	}
+	return fmt.Sprint(v)
+}
+
+/* redisSplitArgs splits a line like redis-cli, with double quotes escapes and single quotes. */
+func redisSplitArgs(line string) ([]string, error) {
+	var args []string
+	var sb strings.Builder
+	var quote rune
+	inArg, escape := false, false
+	for _, c := range line {
+		switch {
+		case escape:
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			}
+			sb.WriteRune(c)
+			escape = false
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				escape = true
+			} else if c == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		default:
+			sb.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escape {
+		return nil, fmt.Errorf("%w: unbalanced quotes", common.ErrInvalidArg)
+	}
+	if inArg {
+		args = append(args, sb.String())
+	}
+	return args, nil
+}
+
+/* redisCompleter completes the command name with tab. */
+func redisCompleter(commands map[string]*redis.CommandInfo) func(string, int, rune) (string, int, bool) {
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	return func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' || strings.ContainsAny(line[:pos], " \t") {
+			return "", 0, false
+		}
+		prefix := strings.ToLower(line[:pos])
+		var completed string
+		for _, v := range names {
+			if !strings.HasPrefix(v, prefix) {
+				continue
+			}
+			if completed == "" {
+				completed = v + " "
+				continue
+			}
+			/* Keep the common prefix of all matches. */
+			i := 0
+			for i < len(completed) && i < len(v) && completed[i] == v[i] {
+				i++
+			}
+			completed = completed[:i]
+		}
+		if completed == "" {
+			return "", 0, false
+		}
+		if line[:pos] != "" && line[:pos] == strings.ToUpper(line[:pos]) {
+			completed = strings.ToUpper(completed)
+		}
+		return completed + line[pos:], len(completed), true
+	}
+}
+
+const (
+	redisByMemory   = "memory"
+	redisByElements = "elements"
+)
+
+/* RedisScanAnalysis walks the keyspace with SCAN and aggregates TYPE, MEMORY USAGE, PTTL and element counts. */
+type RedisScanAnalysis struct {
+	Count int64
+	/* Rate is the maximum keys per second, 0 means unlimited. */
+	Rate  int
+	Match string
+	/* By ranks big keys by memory or elements. */
+	By        string
+	Top       int
+	Separator string
+	/* Depth is the number of segments of a prefix. */
+	Depth int
+}
+
+type RedisKeyspace struct {
+	Keys    int64             `json:"keys" yaml:"keys"`
+	Memory  int64             `json:"memory" yaml:"memory"`
+	Types   []RedisTypeStat   `json:"types" yaml:"types"`
+	BigKeys []RedisKeyStat    `json:"big_keys" yaml:"big_keys"`
+	Prefix  []RedisPrefixStat `json:"prefixes" yaml:"prefixes"`
+	TTL     []RedisTTLBucket  `json:"ttl" yaml:"ttl"`
+	prefix  map[string]*RedisPrefixStat
+	types   map[string]*RedisTypeStat
+	big     map[string][]RedisKeyStat
+}
+
+type RedisTypeStat struct {
+	Type     string `json:"type" yaml:"type"`
+	Keys     int64  `json:"keys" yaml:"keys"`
+	Memory   int64  `json:"memory" yaml:"memory"`
+	Elements int64  `json:"elements" yaml:"elements"`
+}
+
+/* RedisKeyStat is a key, TTL is in seconds and -1 means no TTL. */
+type RedisKeyStat struct {
+	Key      string `json:"key" yaml:"key"`
+	Type     string `json:"type" yaml:"type"`
+	Memory   int64  `json:"memory" yaml:"memory"`
+	Elements int64  `json:"elements" yaml:"elements"`
+	TTL      int64  `json:"ttl" yaml:"ttl"`
+}
+
+type RedisPrefixStat struct {
+	Prefix string `json:"prefix" yaml:"prefix"`
+	Keys   int64  `json:"keys" yaml:"keys"`
+	Memory int64  `json:"memory" yaml:"memory"`
+}
+
+type RedisTTLBucket struct {
+	TTL  string `json:"ttl" yaml:"ttl"`
+	Keys int64  `json:"keys" yaml:"keys"`
+}
+
+var redisTTLBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"no ttl", 0},
+	{"< 1m", time.Minute},
+	{"1m - 1h", time.Hour},
+	{"1h - 1d", 24 * time.Hour},
+	{"1d - 7d", 7 * 24 * time.Hour},
+	{">= 7d", math.MaxInt64},
+}
+
+/* Run analyzes every master of a cluster, or the connected server, partial result is returned on error. */
+func (a *RedisScanAnalysis) Run(ctx context.Context, rdb redis.UniversalClient) (*RedisKeyspace, error) {
+	if a.By != redisByMemory && a.By != redisByElements {
+		return nil, fmt.Errorf("%w: --by %s", common.ErrInvalidArg, a.By)
+	}
+	result := &RedisKeyspace{
+		prefix: make(map[string]*RedisPrefixStat),
+		types:  make(map[string]*RedisTypeStat),
+		big:    make(map[string][]RedisKeyStat),
+		TTL:    make([]RedisTTLBucket, len(redisTTLBuckets)),
+	}
+	for i, v := range redisTTLBuckets {
+		result.TTL[i].TTL = v.name
+	}
+	start := time.Now()
+	var err error
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return a.scan(ctx, client, result, start)
+		})
+	} else {
+		err = a.scan(ctx, rdb, result, start)
+	}
+	a.summarize(result)
+	return result, err
+}
+
+func (a *RedisScanAnalysis) scan(ctx context.Context, rdb redis.Cmdable, result *RedisKeyspace, start time.Time) error {
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, a.Match, a.Count).Result()
+		if err != nil {
+			logger.Debug(err.Error(), common.NewField("cursor", cursor))
+			return err
+		}
+		if err = a.inspect(ctx, rdb, keys, result); err != nil {
+			return err
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+		if a.Rate > 0 {
+			wait := time.Duration(result.Keys)*time.Second/time.Duration(a.Rate) - time.Since(start)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		} else if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+/* inspect pipelines TYPE, MEMORY USAGE and PTTL of keys, then the element counts. */
+func (a *RedisScanAnalysis) inspect(ctx context.Context, rdb redis.Cmdable, keys []string, result *RedisKeyspace) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	types := make([]*redis.StatusCmd, len(keys))
+	memory := make([]*redis.IntCmd, len(keys))
+	ttl := make([]*redis.DurationCmd, len(keys))
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			types[i] = pipe.Type(ctx, key)
+			memory[i] = pipe.MemoryUsage(ctx, key)
+			ttl[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) && types[0].Err() != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	elements := make([]*redis.IntCmd, len(keys))
+	_, _ = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			switch types[i].Val() {
+			case "string":
+				elements[i] = pipe.StrLen(ctx, key)
+			case "list":
+				elements[i] = pipe.LLen(ctx, key)
+			case "hash":
+				elements[i] = pipe.HLen(ctx, key)
+			case "set":
+				elements[i] = pipe.SCard(ctx, key)
+			case "zset":
+				elements[i] = pipe.ZCard(ctx, key)
+			case "stream":
+				elements[i] = pipe.XLen(ctx, key)
+			}
+		}
+		return nil
+	})
+
+	for i, key := range keys {
+		typ := types[i].Val()
+		/* Deleted between SCAN and TYPE. */
+		if typ == "" || typ == "none" {
+			continue
+		}
+		stat := RedisKeyStat{Key: key, Type: typ, Memory: memory[i].Val(), TTL: -1}
+		if elements[i] != nil {
+			stat.Elements = elements[i].Val()
+		}
+		if d := ttl[i].Val(); d > 0 {
+			stat.TTL = int64(d / time.Second)
+		}
+		a.add(result, stat, ttl[i].Val())
+	}
+	return nil
+}
+
+func (a *RedisScanAnalysis) add(result *RedisKeyspace, stat RedisKeyStat, ttl time.Duration) {
+	result.Keys++
+	result.Memory += stat.Memory
+
+	t := result.types[stat.Type]
+	if t == nil {
+		t = &RedisTypeStat{Type: stat.Type}
+		result.types[stat.Type] = t
+	}
+	t.Keys++
+	t.Memory += stat.Memory
+	t.Elements += stat.Elements
+
+	prefix := stat.Key
+	if segments := strings.Split(stat.Key, a.Separator); a.Separator != "" && len(segments) > a.Depth {
+		prefix = strings.Join(segments[:a.Depth], a.Separator) + a.Separator + "*"
+	}
+	p := result.prefix[prefix]
+	if p == nil {
+		p = &RedisPrefixStat{Prefix: prefix}
+		result.prefix[prefix] = p
+	}
+	p.Keys++
+	p.Memory += stat.Memory
+
+	for i, v := range redisTTLBuckets {
+		if (ttl < 0 && v.max == 0) || (ttl >= 0 && ttl < v.max) {
+			result.TTL[i].Keys++
+			break
+		}
+	}
+
+	/* Keep the top keys of every type only. */
+	big := append(result.big[stat.Type], stat)
+	sort.SliceStable(big, func(i, j int) bool { return a.less(big[j], big[i]) })
+	if len(big) > a.Top {
+		big = big[:a.Top]
+	}
+	result.big[stat.Type] = big
+}
+
+func (a *RedisScanAnalysis) less(x, y RedisKeyStat) bool {
+	if a.By == redisByElements {
+		return x.Elements < y.Elements
+	}
+	return x.Memory < y.Memory
+}
+
+func (a *RedisScanAnalysis) summarize(result *RedisKeyspace) {
+	result.Types, result.BigKeys, result.Prefix = nil, nil, nil
+	for _, v := range result.types {
+		result.Types = append(result.Types, *v)
+	}
+	sort.Slice(result.Types, func(i, j int) bool { return result.Types[i].Memory > result.Types[j].Memory })
+	for _, v := range result.Types {
+		result.BigKeys = append(result.BigKeys, result.big[v.Type]...)
+	}
+	for _, v := range result.prefix {
+		result.Prefix = append(result.Prefix, *v)
+	}
+	sort.Slice(result.Prefix, func(i, j int) bool {
+		if result.Prefix[i].Keys != result.Prefix[j].Keys {
+			return result.Prefix[i].Keys > result.Prefix[j].Keys
+		}
+		return result.Prefix[i].Prefix < result.Prefix[j].Prefix
+	})
+	if len(result.Prefix) > a.Top {
+		result.Prefix = result.Prefix[:a.Top]
+	}
+}
+
+func (a *RedisScanAnalysis) String(result *RedisKeyspace) {
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, result)
+		return
+	}
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	format := printer.SetTableAsDefaultFormat(rootOutputFormat)
+	percent := func(n, total int64) string {
+		if total == 0 {
+			return "0.00%"
+		}
+		return fmt.Sprintf("%.2f%%", float64(n)*100/float64(total))
+	}
+
+	printer.Printf("%d keys, %s in total\n\n", result.Keys, common.ByteSize(result.Memory))
+	var data [][]string
+	for _, v := range result.Types {
+		data = append(data, []string{v.Type, strconv.FormatInt(v.Keys, 10), common.ByteSize(v.Memory),
+			percent(v.Memory, result.Memory), strconv.FormatInt(v.Elements, 10)})
+	}
+	printer.Printf(format, []string{"Type", "Keys", "Memory", "Memory%", "Elements"}, data)
+
+	data = nil
+	for _, v := range result.BigKeys {
+		ttl := "-"
+		if v.TTL >= 0 {
+			ttl = (time.Duration(v.TTL) * time.Second).String()
+		}
+		data = append(data, []string{v.Type, v.Key, common.ByteSize(v.Memory), strconv.FormatInt(v.Elements, 10), ttl})
+	}
+	printer.Printf("\n")
+	printer.Printf(format, []string{"Type", "Big Key", "Memory", "Elements", "TTL"}, data)
+
+	data = nil
+	for _, v := range result.Prefix {
+		data = append(data, []string{v.Prefix, strconv.FormatInt(v.Keys, 10), percent(v.Keys, result.Keys), common.ByteSize(v.Memory)})
+	}
+	printer.Printf("\n")
+	printer.Printf(format, []string{"Prefix", "Keys", "Keys%", "Memory"}, data)
+
+	data = nil
+	for _, v := range result.TTL {
+		data = append(data, []string{v.TTL, strconv.FormatInt(v.Keys, 10), percent(v.Keys, result.Keys)})
+	}
+	printer.Printf("\n")
+	printer.Printf(format, []string{"TTL", "Keys", "Keys%"}, data)
+}
@@ -41,34 +41,43 @@ func root() *cobra.Command {
 		Use:   common.RepoName,
 		Short: "OPS useful tools",
 		RunE:  func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+		/* Exit with an error if the output format does not fit the data, the error is already printed. */
+		PersistentPostRunE: func(cmd *cobra.Command, _ []string) error {
+			err := printer.Err()
+			if err != nil {
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			}
+			return err
+		},
 
 		DisableFlagsInUseLine: true,
 	}
-	cmd.PersistentFlags().StringVar(&rootOutputFormat, "output", "", common.Usage("Output format, can be json/yaml"))
+	cmd.PersistentFlags().StringVar(&rootOutputFormat, "output", "", common.Usage("Output format, can be json/ndjson/yaml/csv/markdown"))
 	cmd.PersistentFlags().StringVar(&rootConfig, "config", "", common.Usage("Specify config path"))
 	cmd.PersistentFlags().StringVar(&rootVerbose, "verbose", "error", common.Usage("Specify log level (debug/info/warn/error/panic/fatal"))
 	cmd.PersistentFlags().BoolP("help", "", false, common.Usage("Help for this command"))
 
 	cmd.AddCommand(initArping())
+	cmd.AddCommand(initBench())
 	cmd.AddCommand(initCert(), initConvert())
-	cmd.AddCommand(initDate(), initDf(), initDig(), initDiscord(), initDoc(cmd), initDos2Unix())
-	cmd.AddCommand(initEncode(), initEncrypt())
+	cmd.AddCommand(initDate(), initDB(), initDf(), initDig(), initDiscord(), initDoc(cmd), initDos2Unix())
+	cmd.AddCommand(initEmail(), initEncode(), initEncrypt(), initExporter())
 	cmd.AddCommand(initFree())
-	cmd.AddCommand(initGeoip())
-	cmd.AddCommand(initHash())
+	cmd.AddCommand(initGeoip(), initGRPC())
+	cmd.AddCommand(initHash(), initHTTP())
 	cmd.AddCommand(initICP(), initIP())
 	cmd.AddCommand(initLINE())
 	cmd.AddCommand(initMTR())
-	cmd.AddCommand(initNetmask())
+	cmd.AddCommand(initNetmask(), initNotify())
 	cmd.AddCommand(initOTP())
-	cmd.AddCommand(initPing(), initPs())
+	cmd.AddCommand(initPagerDuty(), initPing(), initPs())
 	cmd.AddCommand(initQrcode())
 	cmd.AddCommand(initRandom(), initReadlink(), initRedis())
-	cmd.AddCommand(initSlack(), initSs(), initSSHKeyGen(), initSSL(), initStat(), initSystem())
-	cmd.AddCommand(initTCPing(), initTelegram(), initTraceroute(), initTree())
+	cmd.AddCommand(initServe(), initSlack(), initSs(), initSSHKeyGen(), initSSL(), initStat(), initSystem())
+	cmd.AddCommand(initTCPing(), initTeams(), initTelegram(), initTraceroute(), initTree())
 	cmd.AddCommand(initUpdate(), initURL())
 	cmd.AddCommand(initVersion())
-	cmd.AddCommand(initWhois(), initWsping())
+	cmd.AddCommand(initWatch(), initWebhook(), initWhois(), initWsping())
 	initalize := func() {
 		common.SetLoggerLevel(rootVerbose)
 	}
@@ -82,22 +91,34 @@ func Run() *cobra.Command {
 }
 
 var groupings = map[string]string{
-	CommandDiscord:  groupIM,
-	CommandLINE:     groupIM,
-	CommandSlack:    groupIM,
-	CommandTelegram: groupIM,
+	CommandDiscord:   groupIM,
+	CommandEmail:     groupIM,
+	CommandLINE:      groupIM,
+	CommandNotify:    groupIM,
+	CommandPagerDuty: groupIM,
+	CommandSlack:     groupIM,
+	CommandTeams:     groupIM,
+	CommandTelegram:  groupIM,
+	CommandWebhook:   groupIM,
 
 	CommandArping:     groupNetwork,
+	CommandBench:      groupNetwork,
+	CommandDB:         groupNetwork,
 	CommandDig:        groupNetwork,
+	CommandExporter:   groupNetwork,
 	CommandGeoip:      groupNetwork,
+	CommandGRPC:       groupNetwork,
+	CommandHTTP:       groupNetwork,
 	CommandIP:         groupNetwork,
 	CommandMTR:        groupNetwork,
 	CommandNetmask:    groupNetwork,
 	CommandPing:       groupNetwork,
+	CommandServe:      groupNetwork,
 	CommandSs:         groupNetwork,
 	CommandTCPing:     groupNetwork,
 	CommandTraceroute: groupNetwork,
 	CommandURL:        groupNetwork,
+	CommandWatch:      groupNetwork,
 	CommandWhois:      groupNetwork,
 	CommandWsping:     groupNetwork,
 }
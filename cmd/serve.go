@@ -0,0 +1,389 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initServe() *cobra.Command {
+	var flags struct {
+		upload bool
+	}
+	var s Serve
+	var serveCmd = &cobra.Command{
+		GroupID: getGroupID(CommandServe),
+		Use:     CommandServe,
+		Short:   "Serve files or echo requests over HTTP",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	var serveSubCmdFiles = &cobra.Command{
+		Use:   CommandFiles + " [dir]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Serve a directory with listing, range requests and uploads",
+		Run: func(_ *cobra.Command, args []string) {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			handler, err := s.FilesHandler(dir, flags.upload)
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(dir))
+				printer.Error(err)
+				return
+			}
+			if err = s.ListenAndServe(handler); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Share the current directory on this host
+files
+
+# Share the current directory on every interface
+files -l :8080
+
+# Allow uploads with basic auth over TLS, certificates are created by 'ssl generate'
+files /srv/share --upload --auth user:password --cert server.crt --key server.key
+
+# Upload files
+curl -T report.pdf http://127.0.0.1:8080/report.pdf
+curl -F file=@report.pdf http://127.0.0.1:8080/`, CommandServe),
+	}
+	serveSubCmdFiles.Flags().BoolVarP(&flags.upload, "upload", "u", false, common.Usage("Allow uploads with PUT and multipart POST, needs --auth unless listening on loopback"))
+
+	var serveSubCmdEcho = &cobra.Command{
+		Use:   CommandEcho,
+		Args:  cobra.NoArgs,
+		Short: "Print and reply every request as JSON",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := s.ListenAndServe(s.EchoHandler()); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Inspect webhook payloads
+echo -l :9000
+
+# Print every request as a JSON line
+echo --output ndjson`, CommandServe),
+	}
+
+	serveCmd.PersistentFlags().StringVarP(&s.Addr, "listen", "l", "127.0.0.1:8080", common.Usage("Listen address"))
+	serveCmd.PersistentFlags().StringVar(&s.Auth, "auth", "", common.Usage("Require basic auth, user:password"))
+	serveCmd.PersistentFlags().StringVar(&s.Cert, "cert", "", common.Usage("TLS certificate file"))
+	serveCmd.PersistentFlags().StringVar(&s.Key, "key", "", common.Usage("TLS private key file"))
+	serveCmd.AddCommand(serveSubCmdFiles, serveSubCmdEcho)
+	return serveCmd
+}
+
+type Serve struct {
+	Addr string
+	/* Auth is user:password of basic auth. */
+	Auth      string
+	Cert, Key string
+}
+
+/* ServeEcho is a request received by the echo server. */
+type ServeEcho struct {
+	Time       string              `json:"time" yaml:"time"`
+	RemoteAddr string              `json:"remote_addr" yaml:"remote_addr"`
+	Method     string              `json:"method" yaml:"method"`
+	Host       string              `json:"host" yaml:"host"`
+	URL        string              `json:"url" yaml:"url"`
+	Proto      string              `json:"proto" yaml:"proto"`
+	Headers    map[string][]string `json:"headers" yaml:"headers"`
+	Query      map[string][]string `json:"query,omitempty" yaml:"query,omitempty"`
+	/* Body is the JSON value of a JSON body, or the text of a UTF-8 body. */
+	Body any `json:"body,omitempty" yaml:"body,omitempty"`
+	/* BodyBase64 is a body which is not text, in base64. */
+	BodyBase64 string `json:"body_base64,omitempty" yaml:"body_base64,omitempty"`
+}
+
+/* serveEchoJSON is a JSON body, written as sent in JSON and as its value in YAML. */
+type serveEchoJSON json.RawMessage
+
+func (j serveEchoJSON) MarshalJSON() ([]byte, error) { return j, nil }
+
+func (j serveEchoJSON) MarshalYAML() (any, error) {
+	var v any
+	err := json.Unmarshal(j, &v)
+	return v, err
+}
+
+/* setBody keeps body as JSON, text or base64, so payloads stay readable. */
+func (e *ServeEcho) setBody(body []byte) {
+	switch {
+	case len(bytes.TrimSpace(body)) != 0 && json.Valid(body):
+		e.Body = serveEchoJSON(body)
+	case utf8.Valid(body):
+		e.Body = string(body)
+	default:
+		e.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+}
+
+const (
+	/* serveEchoMaxBody is the largest request body the echo server reads. */
+	serveEchoMaxBody = 10 << 20
+	/* serveMaxUpload is the largest upload request. */
+	serveMaxUpload = 1 << 30
+)
+
+/* serveLoopback reports whether addr listens on the loopback interface only. */
+func serveLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+/* ListenAndServe serves handler with auth and access log until interrupted. */
+func (s *Serve) ListenAndServe(handler http.Handler) error {
+	if (s.Cert == "") != (s.Key == "") {
+		return common.ErrInvalidFlag
+	}
+	server := &http.Server{
+		Addr:    s.Addr,
+		Handler: s.Handler(handler),
+
+		ReadHeaderTimeout: 3 * time.Second,
+		IdleTimeout:       300 * time.Second,
+	}
+	ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil {
+			logger.Debug(err.Error())
+		}
+	}()
+
+	var err error
+	if s.Cert != "" {
+		fmt.Fprintf(os.Stderr, "Listening on https://%s\n", s.Addr)
+		err = server.ListenAndServeTLS(s.Cert, s.Key)
+	} else {
+		fmt.Fprintf(os.Stderr, "Listening on http://%s\n", s.Addr)
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+/* Handler wraps h with basic auth and an access log on stderr. */
+func (s *Serve) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &serveRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			fmt.Fprintf(os.Stderr, "%s %s %s %s %d %v\n", start.Format(time.RFC3339),
+				r.RemoteAddr, r.Method, r.URL.RequestURI(), rec.status, time.Since(start))
+		}()
+		if s.Auth != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(s.Auth)) != 1 {
+				rec.Header().Set("WWW-Authenticate", `Basic realm="`+common.RepoName+`"`)
+				http.Error(rec, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(rec, r)
+	})
+}
+
+/*
+FilesHandler serves dir with directory listing and range requests, and accepts uploads if upload is true.
+Uploads need Auth, unless Addr is a loopback address.
+*/
+func (s *Serve) FilesHandler(dir string, upload bool) (http.Handler, error) {
+	if upload && s.Auth == "" && !serveLoopback(s.Addr) {
+		logger.Debug(common.ErrInvalidFlag.Error(), common.NewField("listen", s.Addr))
+		return nil, fmt.Errorf("%w: --upload on %s needs --auth, or listen on 127.0.0.1", common.ErrInvalidFlag, s.Addr)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(dir))
+		return nil, err
+	}
+	files := http.FileServerFS(root.FS())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			files.ServeHTTP(w, r)
+			return
+		case http.MethodPut, http.MethodPost:
+			if upload {
+				break
+			}
+			fallthrough
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		r.Body = http.MaxBytesReader(w, r.Body, serveMaxUpload)
+		var err error
+		if r.Method == http.MethodPut {
+			err = s.save(root, name, r.Body)
+		} else {
+			err = s.saveMultipart(root, name, r)
+		}
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(r.URL.Path))
+			status := http.StatusBadRequest
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}), nil
+}
+
+/* saveMultipart saves every file of the form into the directory dir of root. */
+func (s *Serve) saveMultipart(root *os.Root, dir string, r *http.Request) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		err = s.save(root, path.Join(dir, filepath.Base(part.FileName())), part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/*
+save writes r to a temporary file next to name and renames it to name after the whole body is written,
+so an interrupted upload leaves the existing file as it was. os.Root rejects names escaping the served directory.
+*/
+func (*Serve) save(root *os.Root, name string, r io.Reader) error {
+	if name == "" || name == "." {
+		return common.ErrIllegalPath
+	}
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+"."+rand.Text()+".upload")
+	f, err := root.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, FileModeRAll)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	/* os.Root has no Rename before Go 1.25, tmp is opened through root, so the directory of both names is in root. */
+	if err == nil {
+		err = os.Rename(filepath.Join(root.Name(), filepath.FromSlash(tmp)), filepath.Join(root.Name(), filepath.FromSlash(name)))
+	}
+	if err != nil {
+		if removeErr := root.Remove(tmp); removeErr != nil {
+			logger.Debug(removeErr.Error(), common.DefaultField(tmp))
+		}
+	}
+	return err
+}
+
+/* EchoHandler prints every request and replies it as JSON. */
+func (s *Serve) EchoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, serveEchoMaxBody))
+		if err != nil {
+			logger.Debug(err.Error())
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+		echo := ServeEcho{
+			Time:       time.Now().Format(time.RFC3339Nano),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Host:       r.Host,
+			URL:        r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Headers:    r.Header,
+			Query:      r.URL.Query(),
+		}
+		echo.setBody(body)
+		printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), echo)
+		out, err := Encoder.JSONEncode(echo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(out))
+	})
+}
+
+/* serveRecorder keeps the status code for the access log. */
+type serveRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *serveRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
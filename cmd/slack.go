@@ -19,12 +19,18 @@ package cmd
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"html"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/linzeyan/ops-cli/cmd/common"
 	"github.com/slack-go/slack"
@@ -35,7 +41,14 @@ func initSlack() *cobra.Command {
 	var flags struct {
 		Token   string `json:"token"`
 		Channel string `json:"channel_id"`
+		API     string `json:"api"`
+		NotifyQueue
 		arg     string
+		thread  string
+		edit    string
+		message NotifyMessage
+		server  SlackServer
+		serve   Serve
 	}
 	var slackCmd = &cobra.Command{
 		GroupID: getGroupID(CommandSlack),
@@ -46,40 +59,64 @@ func initSlack() *cobra.Command {
 		DisableFlagsInUseLine: true,
 	}
 
+	var s Slack
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandSlack, &flags); err != nil {
+				return err
+			}
+		}
+		s = Slack{Format: flags.message.Format, Color: flags.message.Color, Endpoint: flags.API}
+		return s.Init(flags.Token)
+	}
+	/* Entries of the outbox keep their channel, format and color, flags are used if they have none. */
+	send := func(entry NotifyOutboxEntry) error {
+		channel := notifyOption(entry, "channel", flags.Channel)
+		s.Format = notifyOption(entry, "format", flags.message.Format)
+		s.Color = notifyOption(entry, "color", flags.message.Color)
+		s.Thread = entry.Options["thread"]
+		switch {
+		case entry.Options["edit"] != "":
+			return s.Edit(channel, entry.Options["edit"], entry.Arg)
+		case entry.Kind == CommandText:
+			return s.Text(channel, entry.Arg)
+		}
+		return s.Photo(channel, entry.Arg)
+	}
+
 	run := func(cmd *cobra.Command, _ []string) {
-		if flags.arg == "" {
+		if flags.arg == "" && (cmd.Name() != CommandText || flags.message.Template == "") {
 			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
 			return
 		}
+		if flags.edit != "" && cmd.Name() != CommandText {
+			logger.Error(common.ErrInvalidArg.Error(), common.NewField("edit", flags.edit))
+			return
+		}
 		var err error
-		if rootConfig != "" {
-			if err = ReadConfig(CommandSlack, &flags); err != nil {
+		if err = setup(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if cmd.Name() == CommandText {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
 				logger.Error(err.Error())
 				return
 			}
 		}
-		var s Slack
-		if err = s.Init(flags.Token); err != nil {
-			logger.Error(err.Error())
-			return
-		}
 		if cmd.Name() != CommandText {
 			if !common.IsFile(flags.arg) && !common.IsURL(flags.arg) {
 				logger.Error(common.ErrInvalidFile.Error())
 				return
 			}
 		}
-		switch cmd.Name() {
-		case CommandFile:
-			err = s.Photo(flags.Channel, flags.arg)
-		case CommandPhoto:
-			err = s.Photo(flags.Channel, flags.arg)
-		case CommandText:
-			err = s.Text(flags.Channel, flags.arg)
-		}
-		if err != nil {
+		entry := NotifyOutboxEntry{Target: CommandSlack, Kind: cmd.Name(), Arg: flags.arg, Options: notifyOptions(
+			"channel", flags.Channel, "format", flags.message.Format, "color", flags.message.Color, "thread", flags.thread, "edit", flags.edit)}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
 			logger.Error(err.Error())
+			return
 		}
+		printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), s.Response)
 	}
 
 	var slackSubCmdFile = &cobra.Command{
@@ -90,12 +127,73 @@ func initSlack() *cobra.Command {
 -a "/tmp/a.txt" --config ~/.config.toml`, CommandSlack, CommandFile),
 	}
 
+	var slackSubCmdServe = &cobra.Command{
+		Use:   CommandServe,
+		Short: "Run ops-cli commands from slash commands and app mentions",
+		Long: `Run ops-cli commands from slash commands and app mentions.
+Point the Request URL of the slash command to /commands, and the Request URL of Event Subscriptions to /events,
+app mentions are replied in the thread and need the token with chat:write.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			if rootConfig != "" {
+				if err := ReadConfig(CommandSlack, &flags); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+				if err := ReadConfig(CommandSlack, &flags.server); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+			}
+			if len(flags.server.Allow) == 0 && flags.Channel != "" {
+				flags.server.Allow = []string{flags.Channel}
+			}
+			if flags.server.SigningSecret == "" || len(flags.server.Allow) == 0 {
+				logger.Error(common.ErrInvalidFlag.Error(), common.NewField("allow", flags.server.Allow))
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
+			if flags.Token != "" {
+				s = Slack{Endpoint: flags.API}
+				if err := s.Init(flags.Token); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+				flags.server.API = s.API
+			}
+			if err := flags.serve.ListenAndServe(&flags.server); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Reply /ops dig example.com in the channel of the slack block
+--signing-secret secret --config ~/.config.toml
+
+# Allow more channels and commands, serve TLS
+-l :8443 --cert cert.pem --key key.pem --allow C0123,C0456 --commands dig,cert,whois --config ~/.config.toml`, CommandSlack, CommandServe),
+	}
+	slackSubCmdServe.Flags().StringVar(&flags.server.SigningSecret, "signing-secret", "", common.Usage("Signing secret of the Slack app (required)"))
+	slackSubCmdServe.Flags().StringSliceVar(&flags.server.Allow, "allow", nil, common.Usage("Channel IDs allowed to run commands, defaults to the channel"))
+	slackSubCmdServe.Flags().StringVarP(&flags.serve.Addr, "listen", "l", ":8080", common.Usage("Listen address"))
+	slackSubCmdServe.Flags().StringVar(&flags.serve.Cert, "cert", "", common.Usage("TLS certificate file"))
+	slackSubCmdServe.Flags().StringVar(&flags.serve.Key, "key", "", common.Usage("TLS private key file"))
+	flags.server.ChatOps.addFlags(slackSubCmdServe)
+
 	var slackSubCmdText = &cobra.Command{
 		Use:   CommandText,
 		Short: "Send text to Slack",
 		Run:   run,
 		Example: common.Examples(`# Send text
--a "Hello World!"`, CommandSlack, CommandText),
+-a "Hello World!"
+
+# Send output of a command from stdin, rendered by a template like {{.host}}: {{code .Text}}, with a red bar
+-a - --template alert.tmpl --var host=db1 --color danger < df.txt
+
+# Send Block Kit JSON
+-a - --format blocks < blocks.json
+
+# Reply in the thread of a message, then update the reply with the ts printed
+-a "backup started" --thread 1700000000.000100 --config ~/.config.toml
+-a "backup finished" --edit 1700000000.000200 --config ~/.config.toml`, CommandSlack, CommandText),
 	}
 
 	var slackSubCmdPhoto = &cobra.Command{
@@ -108,14 +206,27 @@ func initSlack() *cobra.Command {
 
 	slackCmd.PersistentFlags().StringVarP(&flags.Token, "token", "t", "", common.Usage("Bot token (required)"))
 	slackCmd.PersistentFlags().StringVarP(&flags.Channel, "channel", "c", "", common.Usage("Channel ID"))
-	slackCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument"))
+	addReplyFlags(slackCmd, &flags.thread, &flags.edit, "Reply in the thread of this message ts")
+	slackCmd.PersistentFlags().StringVar(&flags.API, "api", "", common.Usage("Web API URL, defaults to https://slack.com/api/"))
+	slackCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads from stdin"))
+	flags.message.addFlags(slackCmd, []string{notifyFormatPlain, notifyFormatMarkdown, notifyFormatBlocks}, true)
+
+	flags.NotifyQueue.addFlags(slackCmd)
 
-	slackCmd.AddCommand(slackSubCmdFile, slackSubCmdText, slackSubCmdPhoto)
+	slackCmd.AddCommand(slackSubCmdFile, flags.NotifyQueue.flushCommand(CommandSlack, setup, send), slackSubCmdServe, slackSubCmdText, slackSubCmdPhoto)
 	return slackCmd
 }
 
 type Slack struct {
 	API *slack.Client
+	/* Format is plain, markdown (mrkdwn, default) or blocks (Block Kit JSON), Color sends an attachment. */
+	Format string
+	Color  string
+	/* Endpoint is the Web API URL ending with a slash, defaults to https://slack.com/api/. */
+	Endpoint string
+	/* Thread is the ts of the message to reply in its thread. */
+	Thread   string
+	Response NotifySent
 }
 
 func (s *Slack) Init(token string) error {
@@ -123,7 +234,11 @@ func (s *Slack) Init(token string) error {
 		logger.Debug(common.ErrInvalidToken.Error(), common.DefaultField(token))
 		return common.ErrInvalidToken
 	}
-	s.API = slack.New(token)
+	var options []slack.Option
+	if s.Endpoint != "" {
+		options = append(options, slack.OptionAPIURL(s.Endpoint))
+	}
+	s.API = slack.New(token, options...)
 	if s.API == nil {
 		logger.Debug(common.ErrFailedInitial.Error())
 		return common.ErrFailedInitial
@@ -132,15 +247,72 @@ func (s *Slack) Init(token string) error {
 }
 
 func (s *Slack) Text(channel, arg string) error {
-	input := slack.MsgOptionText(arg, false)
-	_, _, _, err := s.API.SendMessageContext(common.Context, channel, input)
+	input, err := s.message(arg)
+	if err != nil {
+		return err
+	}
+	options := []slack.MsgOption{input}
+	if s.Thread != "" {
+		options = append(options, slack.MsgOptionTS(s.Thread))
+	}
+	channel, ts, _, err := s.API.SendMessageContext(common.Context, channel, options...)
 	if err != nil {
 		logger.Debug(err.Error(),
 			common.DefaultField(channel),
 			common.NewField("slack.MsgOption", input),
 		)
+		return err
 	}
-	return err
+	s.Response = NotifySent{ID: ts, Channel: channel, Thread: s.Thread}
+	return nil
+}
+
+/* Edit replaces the message ts with arg. */
+func (s *Slack) Edit(channel, ts, arg string) error {
+	input, err := s.message(arg)
+	if err != nil {
+		return err
+	}
+	channel, ts, _, err = s.API.UpdateMessageContext(common.Context, channel, ts, input)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(channel), common.NewField("ts", ts))
+		return err
+	}
+	s.Response = NotifySent{ID: ts, Channel: channel, Thread: s.Thread}
+	return nil
+}
+
+func (s *Slack) message(arg string) (slack.MsgOption, error) {
+	switch s.Format {
+	case "", notifyFormatPlain, notifyFormatMarkdown:
+	case notifyFormatBlocks:
+		var blocks slack.Blocks
+		var wrapper struct {
+			Blocks slack.Blocks `json:"blocks"`
+		}
+		var err error
+		if strings.HasPrefix(strings.TrimSpace(arg), "[") {
+			err = json.Unmarshal([]byte(arg), &blocks)
+		} else {
+			err = json.Unmarshal([]byte(arg), &wrapper)
+			blocks = wrapper.Blocks
+		}
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(arg))
+			return nil, err
+		}
+		return slack.MsgOptionBlocks(blocks.BlockSet...), nil
+	default:
+		return nil, errNotifyFormat(CommandSlack, s.Format)
+	}
+	if s.Color != "" {
+		color, _, err := notifyColor(s.Color)
+		if err != nil {
+			return nil, err
+		}
+		return slack.MsgOptionAttachments(slack.Attachment{Color: color, Text: arg, MarkdownIn: []string{"text"}}), nil
+	}
+	return slack.MsgOptionText(arg, s.Format == notifyFormatPlain), nil
 }
 
 func (s *Slack) Photo(channel, arg string) error {
@@ -178,16 +350,18 @@ func (s *Slack) Photo(channel, arg string) error {
 		logger.Debug(err.Error())
 		return err
 	}
-	_, err = s.API.UploadFileContext(common.Context, slack.FileUploadParameters{
-		Filetype: "image/png",
-		Filename: filepath.Base(arg),
-		Channels: []string{channel},
-		File:     uploadFileKey,
+	file, err := s.API.UploadFileContext(common.Context, slack.FileUploadParameters{
+		Filetype:        "image/png",
+		Filename:        filepath.Base(arg),
+		Channels:        []string{channel},
+		File:            uploadFileKey,
+		ThreadTimestamp: s.Thread,
 	})
 	if err != nil {
 		logger.Debug(err.Error())
 		return err
 	}
+	s.Response = NotifySent{ID: file.ID, Channel: channel, Thread: s.Thread}
 	if uploadFileKey != "" {
 		if err := os.Remove(uploadFileKey); err != nil {
 			logger.Debug(err.Error(), common.DefaultField(uploadFileKey))
@@ -242,3 +416,209 @@ func (s *Slack) remoteFile(arg string) (string, error) {
 	base64Image := base64.StdEncoding.EncodeToString(content)
 	return base64Image, err
 }
+
+/* SlackNotifier adapts Slack to Notifier, fields are read from the slack config block. */
+type SlackNotifier struct {
+	Token   string `json:"token"`
+	Channel string `json:"channel_id"`
+	Format  string `json:"format"`
+	Color   string `json:"color"`
+	API     string `json:"api"`
+	api     Slack
+}
+
+func (n *SlackNotifier) setup() error {
+	n.api.Format, n.api.Color, n.api.Endpoint = n.Format, n.Color, n.API
+	return n.api.Init(n.Token)
+}
+
+func (n *SlackNotifier) Text(msg string) error { return n.api.Text(n.Channel, msg) }
+
+/* Plain sends msg as text if Format is blocks, which expects JSON. */
+func (n *SlackNotifier) Plain(msg string) error {
+	api := n.api
+	api.Format = notifyFormatPlain
+	return api.Text(n.Channel, msg)
+}
+
+func (n *SlackNotifier) File(path string) error { return n.api.Photo(n.Channel, path) }
+
+func (n *SlackNotifier) Image(path string) error { return n.api.Photo(n.Channel, path) }
+
+/* SlackServer runs ops-cli commands from slash commands and app mentions signed by SigningSecret in channels of Allow. */
+type SlackServer struct {
+	ChatOps
+	SigningSecret string        `json:"signing_secret"`
+	Allow         []string      `json:"allow"`
+	API           *slack.Client `json:"-"`
+}
+
+/* slackMaxText keeps the reply under 4000 characters, the limit of text Slack shows in full. */
+const slackMaxText = 3900
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (s *SlackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := s.verify(r)
+	if err != nil {
+		logger.Warn(err.Error(), common.NewField("remote", r.RemoteAddr))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/commands":
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.command(w, r)
+	case "/events":
+		s.event(w, r, body)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+/* verify checks the signature and timestamp of the request and returns the body. */
+func (s *SlackServer) verify(r *http.Request) ([]byte, error) {
+	verifier, err := slack.NewSecretsVerifier(r.Header, s.SigningSecret)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = verifier.Write(body); err != nil {
+		return nil, err
+	}
+	return body, verifier.Ensure()
+}
+
+/* command acknowledges a slash command at once, the output is posted to the response_url. */
+func (s *SlackServer) command(w http.ResponseWriter, r *http.Request) {
+	command, err := slack.SlashCommandParse(r)
+	if err != nil {
+		logger.Warn(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reply := func(msg slack.WebhookMessage) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(msg)
+	}
+	if !slices.Contains(s.Allow, command.ChannelID) {
+		logger.Warn("channel is not allowed", common.NewField("channel", command.ChannelID), common.NewField("user", command.UserName))
+		reply(slack.WebhookMessage{ResponseType: slack.ResponseTypeEphemeral, Text: "This channel is not allowed to run commands."})
+		return
+	}
+	fields := strings.Fields(command.Text)
+	if len(fields) == 0 || fields[0] == "help" || !slices.Contains(s.Commands, fields[0]) {
+		reply(slack.WebhookMessage{ResponseType: slack.ResponseTypeEphemeral, Text: s.Help(command.Command + " ")})
+		return
+	}
+	logger.Info(command.Text, common.NewField("channel", command.ChannelID), common.NewField("user", command.UserName))
+	started := s.Go(func() {
+		msg := &slack.WebhookMessage{ResponseType: slack.ResponseTypeInChannel, Text: s.run(fields)}
+		if err := slack.PostWebhookContext(common.Context, command.ResponseURL, msg); err != nil {
+			logger.Warn(err.Error(), common.NewField("channel", command.ChannelID))
+		}
+	})
+	if !started {
+		reply(slack.WebhookMessage{ResponseType: slack.ResponseTypeEphemeral, Text: chatOpsBusy})
+		return
+	}
+	/* in_channel without text shows the slash command to the channel. */
+	reply(slack.WebhookMessage{ResponseType: slack.ResponseTypeInChannel})
+}
+
+/* event answers url_verification, and replies app mentions in the thread. */
+func (s *SlackServer) event(w http.ResponseWriter, r *http.Request, body []byte) {
+	var payload struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Event     struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			User     string `json:"user"`
+			BotID    string `json:"bot_id"`
+			Channel  string `json:"channel"`
+			TS       string `json:"ts"`
+			ThreadTS string `json:"thread_ts"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		logger.Warn(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if payload.Type == "url_verification" {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(payload.Challenge))
+		return
+	}
+	/* Slack retries an event not acknowledged in 3 seconds, the first delivery is already running. */
+	event := payload.Event
+	if r.Header.Get("X-Slack-Retry-Num") != "" || payload.Type != "event_callback" || event.Type != "app_mention" || event.BotID != "" {
+		return
+	}
+	if !slices.Contains(s.Allow, event.Channel) {
+		logger.Warn("channel is not allowed", common.NewField("channel", event.Channel), common.NewField("user", event.User))
+		return
+	}
+	fields := slackFields(event.Text)
+	if s.API == nil {
+		logger.Warn(common.ErrInvalidToken.Error(), common.NewField("channel", event.Channel))
+		return
+	}
+	logger.Info(event.Text, common.NewField("channel", event.Channel), common.NewField("user", event.User))
+	thread := event.ThreadTS
+	if thread == "" {
+		thread = event.TS
+	}
+	s.Go(func() {
+		text := s.Help("@" + common.RepoName + " ")
+		if len(fields) != 0 && fields[0] != "help" {
+			text = s.run(fields)
+		}
+		_, _, err := s.API.PostMessageContext(common.Context, event.Channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(thread))
+		if err != nil {
+			logger.Warn(err.Error(), common.NewField("channel", event.Channel))
+		}
+	})
+}
+
+/* slackLink matches the mentions and links Slack wraps in < and >, the label follows |. */
+var slackLink = regexp.MustCompile(`<([^<>|]*)(?:\|([^<>]*))?>`)
+
+/*
+slackFields splits the text of a message into words, mentions of users are dropped, links are unwrapped
+to their label, and &amp;, &lt; and &gt; are unescaped.
+*/
+func slackFields(text string) []string {
+	text = slackLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := slackLink.FindStringSubmatch(s)
+		switch {
+		case strings.HasPrefix(m[1], "@"):
+			return " "
+		case m[2] != "":
+			return m[2]
+		}
+		return m[1]
+	})
+	fields := strings.Fields(text)
+	for i, v := range fields {
+		fields[i] = html.UnescapeString(v)
+	}
+	return fields
+}
+
+/* run executes fields and returns the output in a code block. */
+func (s *SlackServer) run(fields []string) string {
+	out, err := s.Exec(common.Context, fields[0], fields[1:])
+	if err != nil {
+		return slackEscaper.Replace(err.Error())
+	}
+	return "```\n" + slackEscaper.Replace(truncateText(out, slackMaxText)) + "\n```"
+}
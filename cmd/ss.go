@@ -135,7 +135,7 @@ func (*Ss) String(data [][]string) {
 	header := []string{"Proto", "Local Address", "Foreign Address", "State", "PID/Program name"}
 	printer.SetTableAlign(3)
 	printer.SetTablePadding("\t")
-	if rootOutputFormat != "" && rootOutputFormat != common.TableFormat {
+	if !printer.IsTableFormat(rootOutputFormat) {
 		printer.Printf(rootOutputFormat, data)
 		return
 	}
@@ -17,9 +17,18 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
 	"github.com/linzeyan/ops-cli/cmd/common"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -27,6 +36,7 @@ import (
 	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
 	"github.com/spf13/cobra"
 )
 
@@ -111,12 +121,37 @@ func initSystem() *cobra.Command {
 
 		DisableFlagsInUseLine: true,
 	}
+	var top SystemTop
+	var systemSubCmdTop = &cobra.Command{
+		Use:   CommandTop,
+		Short: "Display a live dashboard of cpu, memory, load, disk io, network and processes",
+		Run: func(_ *cobra.Command, _ []string) {
+			if top.Interval < 100*time.Millisecond || (top.Sort != systemTopSortCPU && top.Sort != systemTopSortRSS) {
+				logger.Error(common.ErrInvalidArg.Error(), common.NewField("interval", top.Interval), common.NewField("sort", top.Sort))
+				printer.Error(common.ErrInvalidArg)
+				return
+			}
+			if err := top.Run(common.Context); err != nil {
+				logger.Info(err.Error())
+				printer.Error(err)
+			}
+		},
+		Example: common.Examples(`# Refresh every 2 seconds, press c or m to sort processes by cpu or rss, q to quit
+--interval 2s
+
+# Sort processes by rss
+--sort rss`, CommandSystem, CommandTop),
+	}
+	systemSubCmdTop.Flags().DurationVarP(&top.Interval, "interval", "i", time.Second, common.Usage("Refresh interval"))
+	systemSubCmdTop.Flags().StringVar(&top.Sort, "sort", systemTopSortCPU, common.Usage("Sort processes by cpu or rss"))
+
 	systemCmd.AddCommand(systemSubCmdCPU)
 	systemCmd.AddCommand(systemSubCmdDisk)
 	systemCmd.AddCommand(systemSubCmdHost)
 	systemCmd.AddCommand(systemSubCmdLoad)
 	systemCmd.AddCommand(systemSubCmdMemory)
 	systemCmd.AddCommand(systemSubCmdNetwork)
+	systemCmd.AddCommand(systemSubCmdTop)
 	return systemCmd
 }
 
@@ -261,3 +296,337 @@ func (s *System) NetInfo() (any, error) {
 	}
 	return &netResp, err
 }
+
+const (
+	systemTopSortCPU = "cpu"
+	systemTopSortRSS = "rss"
+
+	/* systemTopHistory is the number of rates kept for the charts. */
+	systemTopHistory = 300
+)
+
+/* SystemTop samples the host for the dashboard of system top, rates are in bytes per second, oldest first. */
+type SystemTop struct {
+	Interval time.Duration
+	/* Sort is cpu or rss. */
+	Sort string
+
+	CPU       []float64
+	Memory    *mem.VirtualMemoryStat
+	Swap      *mem.SwapMemoryStat
+	Load      *load.AvgStat
+	Uptime    time.Duration
+	DiskRead  []float64
+	DiskWrite []float64
+	NetRecv   []float64
+	NetSent   []float64
+	Processes []SystemTopProcess
+
+	last    time.Time
+	disk    [2]uint64
+	net     [2]uint64
+	procs   map[int32]*systemTopProc
+	sampled bool
+}
+
+/* SystemTopProcess is a process of the dashboard, CPU is the percent of one core since the last sample. */
+type SystemTopProcess struct {
+	PID    int32
+	User   string
+	Name   string
+	CPU    float64
+	RSS    uint64
+	Memory float64
+}
+
+/* systemTopProc keeps the process between samples, CPU percent is the delta of its times. */
+type systemTopProc struct {
+	*process.Process
+	user, name string
+}
+
+/* Sample reads the host once, rates and process CPU are computed from the previous sample. */
+func (t *SystemTop) Sample(ctx context.Context) error {
+	var err error
+	if t.CPU, err = cpu.PercentWithContext(ctx, 0, true); err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	if t.Memory, err = mem.VirtualMemoryWithContext(ctx); err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
+	if t.Swap, err = mem.SwapMemoryWithContext(ctx); err != nil {
+		logger.Debug(err.Error())
+	}
+	if t.Load, err = load.AvgWithContext(ctx); err != nil {
+		logger.Debug(err.Error())
+	}
+	if uptime, err := host.UptimeWithContext(ctx); err == nil {
+		t.Uptime = time.Duration(uptime) * time.Second
+	}
+
+	now := time.Now()
+	var diskIO, netIO [2]uint64
+	if counters, err := disk.IOCountersWithContext(ctx); err == nil {
+		for _, v := range counters {
+			if !systemTopDisk(v.Name) {
+				continue
+			}
+			diskIO[0] += v.ReadBytes
+			diskIO[1] += v.WriteBytes
+		}
+	} else {
+		logger.Debug(err.Error())
+	}
+	if counters, err := net.IOCountersWithContext(ctx, false); err == nil && len(counters) != 0 {
+		netIO = [2]uint64{counters[0].BytesRecv, counters[0].BytesSent}
+	} else if err != nil {
+		logger.Debug(err.Error())
+	}
+	if t.sampled {
+		seconds := now.Sub(t.last).Seconds()
+		t.DiskRead = systemTopRate(t.DiskRead, t.disk[0], diskIO[0], seconds)
+		t.DiskWrite = systemTopRate(t.DiskWrite, t.disk[1], diskIO[1], seconds)
+		t.NetRecv = systemTopRate(t.NetRecv, t.net[0], netIO[0], seconds)
+		t.NetSent = systemTopRate(t.NetSent, t.net[1], netIO[1], seconds)
+	}
+	t.last, t.disk, t.net, t.sampled = now, diskIO, netIO, true
+
+	t.sampleProcesses(ctx)
+	return nil
+}
+
+/*
+systemTopDisk reports whether name is a whole physical disk, so bytes are not counted again by its partitions,
+device mapper and loop devices. Only Linux lists both, other systems count every device.
+*/
+func systemTopDisk(name string) bool {
+	if _, err := os.Stat("/sys/block"); err != nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join("/sys/block", strings.ReplaceAll(name, "/", "!"), "device"))
+	return err == nil
+}
+
+/* systemTopRate appends the rate of a counter to history, a counter which went backwards is 0. */
+func systemTopRate(history []float64, before, after uint64, seconds float64) []float64 {
+	rate := 0.0
+	if after >= before && seconds > 0 {
+		rate = float64(after-before) / seconds
+	}
+	history = append(history, rate)
+	if len(history) > systemTopHistory {
+		history = history[len(history)-systemTopHistory:]
+	}
+	return history
+}
+
+func (t *SystemTop) sampleProcesses(ctx context.Context) {
+	processes, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		logger.Debug(err.Error())
+		return
+	}
+	procs := make(map[int32]*systemTopProc, len(processes))
+	t.Processes = t.Processes[:0]
+	for _, v := range processes {
+		p, ok := t.procs[v.Pid]
+		if !ok {
+			p = &systemTopProc{Process: v}
+			/* Exited processes and kernel threads are skipped. */
+			if p.name, err = v.NameWithContext(ctx); err != nil {
+				continue
+			}
+			p.user, _ = v.UsernameWithContext(ctx)
+		}
+		memory, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		percent, _ := p.PercentWithContext(ctx, 0)
+		procs[v.Pid] = p
+		result := SystemTopProcess{PID: v.Pid, User: p.user, Name: p.name, CPU: percent, RSS: memory.RSS}
+		if t.Memory != nil && t.Memory.Total != 0 {
+			result.Memory = float64(memory.RSS) / float64(t.Memory.Total) * 100
+		}
+		t.Processes = append(t.Processes, result)
+	}
+	t.procs = procs
+	t.sortProcesses()
+}
+
+func (t *SystemTop) sortProcesses() {
+	sort.SliceStable(t.Processes, func(i, j int) bool {
+		a, b := t.Processes[i], t.Processes[j]
+		if t.Sort == systemTopSortRSS || a.CPU == b.CPU {
+			return a.RSS > b.RSS
+		}
+		return a.CPU > b.CPU
+	})
+}
+
+/* Run draws the dashboard every Interval until q is pressed or ctx is done. */
+func (t *SystemTop) Run(ctx context.Context) error {
+	if err := t.Sample(ctx); err != nil {
+		return err
+	}
+	if err := termui.Init(); err != nil {
+		return err
+	}
+	defer termui.Close()
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+	uiEvents := termui.PollEvents()
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		termui.Clear()
+		termui.Render(t.Widgets(termui.TerminalDimensions())...)
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-uiEvents:
+			switch e.ID {
+			case "q", "<C-c>":
+				return nil
+			case "c":
+				t.Sort = systemTopSortCPU
+				t.sortProcesses()
+			case "m":
+				t.Sort = systemTopSortRSS
+				t.sortProcesses()
+			}
+		case <-ticker.C:
+			if err := t.Sample(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+/* Widgets lays out the dashboard in a terminal of width and height. */
+func (t *SystemTop) Widgets(width, height int) []termui.Drawable {
+	/* CPU bars and load averages. */
+	columns := max(1, min(4, (width-2)/28))
+	rows := (len(t.CPU) + columns - 1) / columns
+	cpuBox := widgets.NewParagraph()
+	cpuBox.Title = fmt.Sprintf(" %s  up %s  (c)pu (m)em sort (q)uit ", t.loadText(), t.Uptime)
+	cpuBox.WrapText = false
+	var lines []string
+	for row := range rows {
+		var cells []string
+		for column := range columns {
+			i := column*rows + row
+			if i >= len(t.CPU) {
+				break
+			}
+			cells = append(cells, systemTopBar(fmt.Sprintf("%3d", i), t.CPU[i], (width-2)/columns-1))
+		}
+		lines = append(lines, strings.Join(cells, " "))
+	}
+	cpuBox.Text = strings.Join(lines, "\n")
+	y := rows + 2
+	cpuBox.SetRect(0, 0, width, y)
+
+	/* Memory and swap. */
+	memory := widgets.NewGauge()
+	swap := widgets.NewGauge()
+	memory.BarColor, swap.BarColor = termui.ColorGreen, termui.ColorMagenta
+	memory.Title, swap.Title = " Memory ", " Swap "
+	if t.Memory != nil {
+		memory.Percent = int(t.Memory.UsedPercent)
+		memory.Label = fmt.Sprintf("%.1f%% of %s", t.Memory.UsedPercent, common.ByteSize(t.Memory.Total))
+	}
+	if t.Swap != nil {
+		swap.Percent = int(t.Swap.UsedPercent)
+		swap.Label = fmt.Sprintf("%.1f%% of %s", t.Swap.UsedPercent, common.ByteSize(t.Swap.Total))
+	}
+	memory.SetRect(0, y, width/2, y+3)
+	swap.SetRect(width/2, y, width, y+3)
+	y += 3
+
+	/* Disk IO and network throughput. */
+	chartHeight := min(10, max(4, (height-y)/3))
+	diskIO := systemTopChart(" Disk IO ", width/2, []string{"read", "write"}, t.DiskRead, t.DiskWrite)
+	network := systemTopChart(" Network ", width-width/2, []string{"recv", "sent"}, t.NetRecv, t.NetSent)
+	diskIO.SetRect(0, y, width/2, y+chartHeight)
+	network.SetRect(width/2, y, width, y+chartHeight)
+	y += chartHeight
+
+	/* Processes. */
+	table := widgets.NewTable()
+	table.Title = " Processes by " + t.Sort + " "
+	table.RowSeparator = false
+	table.TextAlignment = termui.AlignLeft
+	table.ColumnWidths = []int{8, 10, 7, 11, 7, max(4, width-2-8-10-7-11-7)}
+	table.Rows = [][]string{{"PID", "USER", "CPU%", "RSS", "MEM%", "NAME"}}
+	for _, v := range t.Processes {
+		if len(table.Rows) >= height-y-2 {
+			break
+		}
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(int(v.PID)), v.User, fmt.Sprintf("%.1f", v.CPU), common.ByteSize(v.RSS), fmt.Sprintf("%.1f", v.Memory), v.Name,
+		})
+	}
+	table.RowStyles[0] = termui.NewStyle(termui.ColorWhite, termui.ColorClear, termui.ModifierBold)
+	table.SetRect(0, y, width, max(y+3, height))
+	return []termui.Drawable{cpuBox, memory, swap, diskIO, network, table}
+}
+
+func (t *SystemTop) loadText() string {
+	if t.Load == nil {
+		return "load -"
+	}
+	return fmt.Sprintf("load %.2f %.2f %.2f", t.Load.Load1, t.Load.Load5, t.Load.Load15)
+}
+
+/* systemTopBar draws percent as a colored bar of width cells with its label. */
+func systemTopBar(label string, percent float64, width int) string {
+	value := fmt.Sprintf("%5.1f%%", percent)
+	size := width - len(label) - len(value) - 3
+	if size < 1 {
+		return label + " " + value
+	}
+	filled := min(size, int(percent/100*float64(size)+0.5))
+	color := "green"
+	switch {
+	case percent >= 90:
+		color = "red"
+	case percent >= 60:
+		color = "yellow"
+	}
+	bar := strings.Repeat("|", filled)
+	if filled != 0 {
+		bar = fmt.Sprintf("[%s](fg:%s)", bar, color)
+	}
+	return fmt.Sprintf("%s [%s%s]%s", label, bar, strings.Repeat(" ", size-filled), value)
+}
+
+/* systemTopChart draws the latest rates of every series which fit in width. */
+func systemTopChart(title string, width int, names []string, series ...[]float64) *widgets.SparklineGroup {
+	colors := []termui.Color{termui.ColorCyan, termui.ColorYellow}
+	var lines []*widgets.Sparkline
+	for i, data := range series {
+		if n := width - 2; len(data) > n && n > 0 {
+			data = data[len(data)-n:]
+		}
+		line := widgets.NewSparkline()
+		line.LineColor = colors[i%len(colors)]
+		line.Data = data
+		line.MaxVal = 1
+		for _, v := range data {
+			line.MaxVal = max(line.MaxVal, v)
+		}
+		var last float64
+		if len(data) != 0 {
+			last = data[len(data)-1]
+		}
+		line.Title = fmt.Sprintf("%s %s/s  max %s/s", names[i], common.ByteSize(last), common.ByteSize(line.MaxVal))
+		lines = append(lines, line)
+	}
+	group := widgets.NewSparklineGroup(lines...)
+	group.Title = title
+	return group
+}
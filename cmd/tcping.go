@@ -17,9 +17,20 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/linzeyan/ops-cli/cmd/common"
@@ -30,6 +41,8 @@ func initTCPing() *cobra.Command {
 	var flags struct {
 		count    int
 		protocol string
+		payload  string
+		interval time.Duration
 		timeout  time.Duration
 	}
 	var tcpingCmd = &cobra.Command{
@@ -38,61 +51,550 @@ func initTCPing() *cobra.Command {
 		Args:    cobra.ExactArgs(2),
 		Short:   "Connect to a port of a host",
 		Run: func(_ *cobra.Command, args []string) {
+			if flags.count == 0 || (flags.protocol != TCP && flags.protocol != UDP) {
+				logger.Error(common.ErrInvalidFlag.Error())
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
 			t := TCPing{
 				Protocal: flags.protocol,
 				Timeout:  flags.timeout,
+				Payload:  []byte(flags.payload),
 			}
-			for i := 0; ; {
-				addr, duration, err := t.Connect(i, args)
-				if err != nil {
-					logger.Info(err.Error())
-					printer.Error(err)
-				}
-				ip, port, err := net.SplitHostPort(addr)
-				if err != nil {
-					logger.Info(err.Error())
-					printer.Error(err)
-					return
-				}
-				if flags.count == 1 {
-					printer.Printf("%s response from %s (%s) port %s [open] %v", t.Protocal, args[0], ip, port, duration)
-					return
-				}
-				printer.Printf("seq %d: %s response from %s (%s) port %s [open] %v", i, t.Protocal, args[0], ip, port, duration)
-				i++
-				if i == flags.count {
-					break
-				}
-				time.Sleep(time.Second)
-			}
+			ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+			defer cancel()
+			stat := t.Run(ctx, args[0], args[1], flags.count, flags.interval)
+			t.Summary(stat, flags.count)
 		},
+		Example: common.Examples(`# Connect to a port once
+google.com 443
+
+# Keep connecting until interrupted, then print statistics
+google.com 443 -c -1 -i 500ms
+
+# Probe a UDP port
+1.1.1.1 53 -p udp --payload ping
+
+# Print every probe as a JSON line
+google.com 443 -c 5 --output ndjson`, CommandTCPing),
 	}
-	tcpingCmd.Flags().IntVarP(&flags.count, "count", "c", 1, common.Usage("Specify tcping counts"))
-	tcpingCmd.Flags().StringVarP(&flags.protocol, "protocol", "p", "tcp", common.Usage("Specify protocol"))
+	tcpingCmd.AddCommand(initTCPingScan())
+	tcpingCmd.Flags().IntVarP(&flags.count, "count", "c", 1, common.Usage("Specify tcping counts, -1 means continuous"))
+	tcpingCmd.Flags().StringVarP(&flags.protocol, "protocol", "p", TCP, common.Usage("Specify protocol (tcp/udp)"))
+	tcpingCmd.Flags().StringVar(&flags.payload, "payload", "\n", common.Usage("Specify payload of UDP probes"))
+	tcpingCmd.Flags().DurationVarP(&flags.interval, "interval", "i", time.Second, common.Usage("Specify interval"))
 	tcpingCmd.Flags().DurationVarP(&flags.timeout, "timeout", "t", 2*time.Second, common.Usage("Specify timeout"))
 	return tcpingCmd
 }
 
+func initTCPingScan() *cobra.Command {
+	var flags struct {
+		concurrency, rate int
+		banner, all       bool
+		timeout           time.Duration
+	}
+	var scanCmd = &cobra.Command{
+		Use:   CommandScan + " [targets] [ports]",
+		Args:  cobra.ExactArgs(2),
+		Short: "Scan ports of hosts or CIDR ranges",
+		Run: func(_ *cobra.Command, args []string) {
+			targets, err := ParseScanTargets(args[0])
+			if err != nil {
+				logger.Info(err.Error(), common.DefaultField(args[0]))
+				printer.Error(err)
+				return
+			}
+			ports, err := ParseScanPorts(args[1])
+			if err != nil {
+				logger.Info(err.Error(), common.DefaultField(args[1]))
+				printer.Error(err)
+				return
+			}
+			t := TCPing{
+				Protocal:    TCP,
+				Timeout:     flags.timeout,
+				Concurrency: flags.concurrency,
+				Rate:        flags.rate,
+				Banner:      flags.banner,
+			}
+			results, err := t.Scan(targets, ports)
+			if err != nil {
+				logger.Info(err.Error(), common.DefaultField(args))
+				printer.Error(err)
+				return
+			}
+			t.PrintScan(results, flags.all)
+		},
+		Example: common.Examples(`# Scan common ports of a host
+scan example.com 22,80,443
+
+# Scan a subnet and grab service banners
+scan 192.168.1.0/24 22,80,443,6379,8000-8100 --banner
+
+# List closed and filtered ports as well
+scan 10.0.0.1,10.0.0.2 1-1024 --all --output json`, CommandTCPing),
+	}
+	scanCmd.Flags().IntVar(&flags.concurrency, "concurrency", 100, common.Usage("Number of concurrent connections"))
+	scanCmd.Flags().IntVar(&flags.rate, "rate", 0, common.Usage("Maximum new connections per second, 0 means unlimited"))
+	scanCmd.Flags().BoolVarP(&flags.banner, "banner", "b", false, common.Usage("Read banners of open ports to identify services"))
+	scanCmd.Flags().BoolVarP(&flags.all, "all", "a", false, common.Usage("Print closed and filtered ports"))
+	scanCmd.Flags().DurationVarP(&flags.timeout, "timeout", "t", time.Second, common.Usage("Specify timeout"))
+	return scanCmd
+}
+
 type TCPing struct {
 	Protocal string
 	Timeout  time.Duration
+	/* Payload is sent by UDP probes. */
+	Payload []byte
+
+	/* Scan options. */
+	Concurrency int
+	Rate        int
+	Banner      bool
 }
 
-func (t *TCPing) Connect(counter int, args []string) (string, time.Duration, error) {
-	var p string
-	startTime := time.Now()
-	conn, err := net.DialTimeout(t.Protocal, net.JoinHostPort(args[0], args[1]), t.Timeout)
+/* TCPingScanResult is the state of a port, State is open, closed, filtered, or error if the host does not resolve. */
+type TCPingScanResult struct {
+	Host    string `json:"host" yaml:"host"`
+	Port    int    `json:"port" yaml:"port"`
+	State   string `json:"state" yaml:"state"`
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	Banner  string `json:"banner,omitempty" yaml:"banner,omitempty"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+const (
+	scanStateOpen     = "open"
+	scanStateClosed   = "closed"
+	scanStateFiltered = "filtered"
+	scanStateError    = "error"
+
+	/* maxScanProbes caps targets times ports, e.g. a /24 with ports 1-1024. */
+	maxScanProbes = 1 << 18
+)
+
+/* ParseScanTargets parses comma separated hosts, IPs and CIDR ranges. */
+func ParseScanTargets(s string) ([]string, error) {
+	const maxTargets = 1 << 16
+	var n Netmask
+	var targets []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			continue
+		case common.IsCIDR(v):
+			ipnet, first, last := n.ipRange(v)
+			if ipnet == nil {
+				return nil, common.ErrInvalidArg
+			}
+			for ip := first; ip.IsValid() && ip.Compare(last) <= 0; ip = ip.Next() {
+				if len(targets) >= maxTargets {
+					return nil, fmt.Errorf("%w: more than %d targets", common.ErrInvalidArg, maxTargets)
+				}
+				targets = append(targets, ip.String())
+			}
+		case common.IsIP(v) || common.IsDomain(v) || v == inetLocalhost:
+			targets = append(targets, v)
+		default:
+			return nil, fmt.Errorf("%w: %s", common.ErrInvalidArg, v)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, common.ErrInvalidArg
+	}
+	return targets, nil
+}
+
+/* ParseScanPorts parses port lists and ranges such as 22,80,443,8000-8100. */
+func ParseScanPorts(s string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		first, last, found := strings.Cut(v, "-")
+		if !found {
+			last = first
+		}
+		a, err1 := strconv.Atoi(first)
+		b, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || a < 1 || b > 65535 || a > b {
+			return nil, fmt.Errorf("%w: %s", common.ErrInvalidArg, v)
+		}
+		for p := a; p <= b; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, common.ErrInvalidArg
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+/* Scan dials every port of every target concurrently, names are resolved once before scanning. */
+func (t *TCPing) Scan(targets []string, ports []int) ([]TCPingScanResult, error) {
+	if probes := len(targets) * len(ports); probes > maxScanProbes {
+		logger.Debug(common.ErrInvalidArg.Error(), common.NewField("probes", probes))
+		return nil, fmt.Errorf("%w: %d targets and %d ports are more than %d probes", common.ErrInvalidArg, len(targets), len(ports), maxScanProbes)
+	}
+	if t.Concurrency <= 0 {
+		t.Concurrency = 1
+	}
+	var limiter <-chan time.Time
+	if t.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(t.Rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	addrs := make([]string, len(targets))
+	errs := make([]error, len(targets))
+	for i, v := range targets {
+		addrs[i] = v
+		if common.IsIP(v) {
+			continue
+		}
+		ips, err := net.DefaultResolver.LookupHost(context.Background(), v)
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(v))
+			errs[i] = err
+			continue
+		}
+		addrs[i] = ips[0]
+	}
+
+	results := make([]TCPingScanResult, len(targets)*len(ports))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < t.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				i, port := j/len(ports), ports[j%len(ports)]
+				if errs[i] != nil {
+					results[j] = TCPingScanResult{Host: targets[i], Port: port, State: scanStateError, Error: errs[i].Error()}
+					continue
+				}
+				results[j] = t.scanPort(targets[i], addrs[i], port)
+			}
+		}()
+	}
+	for i := range results {
+		if limiter != nil && errs[i/len(ports)] == nil {
+			<-limiter
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results, nil
+}
+
+/* scanPort dials ip, the banner of TLS uses host as the server name. */
+func (t *TCPing) scanPort(host, ip string, port int) TCPingScanResult {
+	result := TCPingScanResult{Host: host, Port: port}
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	conn, err := net.DialTimeout(TCP, addr, t.Timeout)
 	if err != nil {
-		logger.Debug(err.Error())
-		p = fmt.Sprintf("Connect error: %s", err.Error())
-		return "", 0, errors.New(p)
+		logger.Debug(err.Error(), common.DefaultField(addr))
+		result.State = scanStateFiltered
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			result.State = scanStateClosed
+		}
+		return result
+	}
+	defer conn.Close()
+	result.State = scanStateOpen
+	if t.Banner {
+		result.Service, result.Banner = t.grabBanner(conn, host, addr)
 	}
+	return result
+}
+
+/* grabBanner waits for the server to talk first (SSH, SMTP, Redis errors), then probes with HTTP and TLS. */
+func (t *TCPing) grabBanner(conn net.Conn, host, addr string) (string, string) {
+	buf := make([]byte, 512)
+	read := func() []byte {
+		if err := conn.SetReadDeadline(time.Now().Add(t.Timeout)); err != nil {
+			return nil
+		}
+		n, _ := conn.Read(buf)
+		return buf[:n]
+	}
+
+	b := read()
+	if len(b) == 0 {
+		if _, err := conn.Write([]byte("HEAD / HTTP/1.0\r\n\r\n")); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(addr))
+			return "", ""
+		}
+		b = read()
+	}
+	switch {
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		return "ssh", t.bannerLine(b)
+	case bytes.HasPrefix(b, []byte("HTTP/")):
+		for _, line := range strings.Split(string(b), "\n") {
+			if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(k, "Server") {
+				return "http", t.bannerLine([]byte(v))
+			}
+		}
+		return "http", t.bannerLine(b)
+	case bytes.HasPrefix(b, []byte("-ERR")), bytes.HasPrefix(b, []byte("-NOAUTH")), bytes.HasPrefix(b, []byte("+PONG")):
+		return "redis", t.bannerLine(b)
+	case len(b) == 0 || b[0] == 0x15:
+		/* Nothing or a TLS alert came back, try a TLS handshake. */
+		return t.grabTLS(host, addr)
+	}
+	return "", t.bannerLine(b)
+}
+
+func (t *TCPing) grabTLS(host, addr string) (string, string) {
+	dialer := &net.Dialer{Timeout: t.Timeout}
+	config := &tls.Config{InsecureSkipVerify: true}
+	if !common.IsIP(host) {
+		config.ServerName = host
+	}
+	/* #nosec G402 -- only reading the certificate of the peer. */
+	conn, err := tls.DialWithDialer(dialer, TCP, addr, config)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(addr))
+		return "", ""
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	banner := tls.VersionName(state.Version)
+	if len(state.PeerCertificates) != 0 {
+		banner += " " + state.PeerCertificates[0].Subject.CommonName
+	}
+	return "tls", banner
+}
+
+/* bannerLine returns the first printable line of b. */
+func (*TCPing) bannerLine(b []byte) string {
+	line, _, _ := strings.Cut(string(b), "\n")
+	line = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, line)
+	return strings.TrimSpace(line)
+}
+
+/* PrintScan prints open ports and errors, and closed and filtered ports if all is true. */
+func (t *TCPing) PrintScan(results []TCPingScanResult, all bool) {
+	var out []TCPingScanResult
+	count := make(map[string]int)
+	for _, v := range results {
+		count[v.State]++
+		if all || v.State == scanStateOpen || v.State == scanStateError {
+			out = append(out, v)
+		}
+	}
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, out)
+		return
+	}
+	header := []string{"Host", "Port", "State", "Service", "Banner"}
+	var data [][]string
+	for _, v := range out {
+		banner := v.Banner
+		if v.Error != "" {
+			banner = v.Error
+		}
+		data = append(data, []string{v.Host, strconv.Itoa(v.Port), v.State, v.Service, banner})
+	}
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	format := printer.SetTableAsDefaultFormat(rootOutputFormat)
+	printer.Printf(format, header, data)
+	if format == common.TableFormat {
+		printer.Printf("\n%d open, %d closed, %d filtered, %d error\n",
+			count[scanStateOpen], count[scanStateClosed], count[scanStateFiltered], count[scanStateError])
+	}
+}
+
+/* TCPingProbe is the result of a single connection attempt. */
+type TCPingProbe struct {
+	Seq      int     `json:"seq" yaml:"seq"`
+	Protocol string  `json:"protocol" yaml:"protocol"`
+	Host     string  `json:"host" yaml:"host"`
+	IP       string  `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Port     string  `json:"port" yaml:"port"`
+	State    string  `json:"state" yaml:"state"`
+	Time     float64 `json:"time_ms" yaml:"time_ms"`
+	Error    string  `json:"error,omitempty" yaml:"error,omitempty"`
+
+	rtt time.Duration
+}
+
+/* TCPingStat summarises probes, times are in milliseconds. */
+type TCPingStat struct {
+	Protocol string  `json:"protocol" yaml:"protocol"`
+	Host     string  `json:"host" yaml:"host"`
+	Port     string  `json:"port" yaml:"port"`
+	Sent     int     `json:"sent" yaml:"sent"`
+	Received int     `json:"received" yaml:"received"`
+	Loss     float64 `json:"loss" yaml:"loss"`
+	Min      float64 `json:"min" yaml:"min"`
+	Avg      float64 `json:"avg" yaml:"avg"`
+	Max      float64 `json:"max" yaml:"max"`
+	StdDev   float64 `json:"stddev" yaml:"stddev"`
+
+	Probes []TCPingProbe `json:"probes,omitempty" yaml:"probes,omitempty"`
+}
+
+const scanStateOpenFiltered = scanStateOpen + "|" + scanStateFiltered
 
-	if conn != nil {
-		duration := time.Since(startTime)
+/* Run probes host:port count times, or until ctx is done if count is negative. */
+func (t *TCPing) Run(ctx context.Context, host, port string, count int, interval time.Duration) TCPingStat {
+	stat := TCPingStat{Protocol: t.Protocal, Host: host, Port: port}
+	for i := 0; count < 0 || i < count; i++ {
+		if i != 0 {
+			select {
+			case <-ctx.Done():
+				return stat
+			case <-time.After(interval):
+			}
+		}
+		p := t.Probe(i, host, port)
+		stat.Sent++
+		if p.Error == "" {
+			stat.Received++
+		}
+		stat.Probes = append(stat.Probes, p)
+		t.printProbe(p, count)
+		if ctx.Err() != nil {
+			return stat
+		}
+	}
+	return stat
+}
+
+/* Probe connects to host:port once, a failure is recorded in the result instead of being returned. */
+func (t *TCPing) Probe(seq int, host, port string) TCPingProbe {
+	p := TCPingProbe{Seq: seq, Protocol: t.Protocal, Host: host, Port: port}
+	addr := net.JoinHostPort(host, port)
+	startTime := time.Now()
+	conn, err := net.DialTimeout(t.Protocal, addr, t.Timeout)
+	if err == nil {
 		defer conn.Close()
-		return conn.RemoteAddr().String(), duration, err
+		p.IP, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+		if t.Protocal == UDP {
+			err = t.udpReply(conn)
+		}
+	}
+	p.rtt = time.Since(startTime)
+	p.Time = float64(p.rtt.Microseconds()) / 1000
+	switch {
+	case err == nil:
+		p.State = scanStateOpen
+		return p
+	case errors.Is(err, syscall.ECONNREFUSED):
+		p.State = scanStateClosed
+	case t.Protocal == UDP && conn != nil:
+		/* No reply and no ICMP port unreachable. */
+		p.State = scanStateOpenFiltered
+	default:
+		p.State = scanStateFiltered
+	}
+	logger.Debug(err.Error(), common.DefaultField(addr))
+	p.Error = err.Error()
+	p.rtt, p.Time = 0, 0
+	return p
+}
+
+/* udpReply sends the payload and waits for any reply, ICMP port unreachable surfaces as ECONNREFUSED. */
+func (t *TCPing) udpReply(conn net.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(t.Timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(t.Payload); err != nil {
+		return err
+	}
+	_, err := conn.Read(make([]byte, 1500))
+	return err
+}
+
+func (t *TCPing) printProbe(p TCPingProbe, count int) {
+	switch rootOutputFormat {
+	case common.NDJSONFormat:
+		printer.Printf(rootOutputFormat, p)
+		return
+	case common.JSONFormat, common.YamlFormat:
+		return
+	}
+	var prefix string
+	if count != 1 {
+		prefix = fmt.Sprintf("seq %d: ", p.Seq)
+	}
+	if p.Error != "" {
+		printer.Printf("%s%s connect to %s port %s [%s] %s\n", prefix, p.Protocol, p.Host, p.Port, p.State, p.Error)
+		return
+	}
+	printer.Printf("%s%s response from %s (%s) port %s [%s] %v\n", prefix, p.Protocol, p.Host, p.IP, p.Port, p.State, p.rtt)
+}
+
+/* Summary computes loss and round-trip statistics and prints them. */
+func (t *TCPing) Summary(stat TCPingStat, count int) {
+	var rtts []time.Duration
+	for _, p := range stat.Probes {
+		if p.Error == "" {
+			rtts = append(rtts, p.rtt)
+		}
+	}
+	if stat.Sent != 0 {
+		stat.Loss = float64(stat.Sent-stat.Received) * 100 / float64(stat.Sent)
+	}
+	var minRtt, maxRtt, sum time.Duration
+	for i, v := range rtts {
+		if i == 0 || v < minRtt {
+			minRtt = v
+		}
+		if v > maxRtt {
+			maxRtt = v
+		}
+		sum += v
+	}
+	var avg, stddev time.Duration
+	if len(rtts) != 0 {
+		avg = sum / time.Duration(len(rtts))
+		var temp float64
+		for _, v := range rtts {
+			temp += math.Pow(float64(v-avg), 2)
+		}
+		stddev = time.Duration(math.Sqrt(temp / float64(len(rtts))))
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	stat.Min, stat.Avg, stat.Max, stat.StdDev = ms(minRtt), ms(avg), ms(maxRtt), ms(stddev)
+
+	switch rootOutputFormat {
+	case common.NDJSONFormat:
+		stat.Probes = nil
+		printer.Printf(rootOutputFormat, stat)
+		return
+	case common.JSONFormat, common.YamlFormat:
+		printer.Printf(rootOutputFormat, stat)
+		return
+	}
+	if count == 1 || stat.Sent == 0 {
+		return
+	}
+	out := fmt.Sprintf("\n--- %s %s port %s statistics ---\n", stat.Host, stat.Protocol, stat.Port)
+	out += fmt.Sprintf("%d probes transmitted, %d received, %.1f%% loss\n", stat.Sent, stat.Received, stat.Loss)
+	if len(rtts) != 0 {
+		out += fmt.Sprintf("round-trip min/avg/max/stddev = %v/%v/%v/%v\n", minRtt, avg, maxRtt, stddev)
 	}
-	p = fmt.Sprintf("Connect error for seq %d", counter)
-	return "", 0, errors.New(p)
+	printer.Printf("%s", out)
 }
@@ -0,0 +1,172 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initTeams() *cobra.Command {
+	var flags struct {
+		Teams
+		NotifyQueue
+		arg     string
+		message NotifyMessage
+	}
+	var teamsCmd = &cobra.Command{
+		GroupID: getGroupID(CommandTeams),
+		Use:     CommandTeams,
+		Short:   "Send message to Microsoft Teams",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandTeams, &flags); err != nil {
+				return err
+			}
+		}
+		if flags.message.Format != "" {
+			flags.Format = flags.message.Format
+		}
+		return flags.setup()
+	}
+	send := func(entry NotifyOutboxEntry) error { return notifySend(&flags.Teams, entry.Kind, entry.Arg) }
+
+	run := func(cmd *cobra.Command, _ []string) {
+		if flags.arg == "" && (cmd.Name() != CommandText || flags.message.Template == "") {
+			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
+			return
+		}
+		var err error
+		if err = setup(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if cmd.Name() == CommandText {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
+		entry := NotifyOutboxEntry{Target: CommandTeams, Kind: cmd.Name(), Arg: flags.arg}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
+	var teamsSubCmdPhoto = &cobra.Command{
+		Use:   CommandPhoto,
+		Short: "Send photo URL to Microsoft Teams",
+		Run:   run,
+		Example: common.Examples(`# Send photo
+-u https://example.webhook.office.com/webhookb2/... -a https://example.com/graph.png`, CommandTeams, CommandPhoto),
+	}
+
+	var teamsSubCmdText = &cobra.Command{
+		Use:   CommandText,
+		Short: "Send text to Microsoft Teams",
+		Run:   run,
+		Example: common.Examples(`# Send text, the webhook URL is read from the teams block
+-a "Hello World!" --config ~/.config.toml
+
+# Send Adaptive Card elements in JSON from stdin
+-u https://example.webhook.office.com/webhookb2/... -a - --format blocks < card.json`, CommandTeams, CommandText),
+	}
+
+	teamsCmd.PersistentFlags().StringVarP(&flags.URL, "url", "u", "", common.Usage("Incoming webhook URL (required)"))
+	teamsCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads text from stdin"))
+	flags.message.addFlags(teamsCmd, []string{notifyFormatMarkdown, notifyFormatBlocks}, false)
+	flags.NotifyQueue.addFlags(teamsCmd)
+
+	teamsCmd.AddCommand(flags.NotifyQueue.flushCommand(CommandTeams, setup, send), teamsSubCmdPhoto, teamsSubCmdText)
+	return teamsCmd
+}
+
+/* Teams posts Adaptive Cards to an incoming webhook or a Workflows webhook. */
+type Teams struct {
+	URL string `json:"url"`
+	/* Format is markdown (default) or blocks, the text of blocks is an array of card elements in JSON. */
+	Format string `json:"format"`
+}
+
+func (t *Teams) setup() error {
+	if !common.IsURL(t.URL) {
+		logger.Debug(common.ErrInvalidURL.Error(), common.DefaultField(t.URL))
+		return common.ErrInvalidURL
+	}
+	if t.Format != "" && t.Format != notifyFormatMarkdown && t.Format != notifyFormatBlocks {
+		return errNotifyFormat(CommandTeams, t.Format)
+	}
+	return nil
+}
+
+func (t *Teams) Text(msg string) error {
+	if t.Format != notifyFormatBlocks {
+		return t.send(map[string]any{"type": "TextBlock", "text": msg, "wrap": true})
+	}
+	var elements []map[string]any
+	if err := json.Unmarshal([]byte(msg), &elements); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(msg))
+		return err
+	}
+	return t.send(elements...)
+}
+
+/* Plain sends msg as a TextBlock if Format is blocks, which expects JSON. */
+func (t *Teams) Plain(msg string) error {
+	return t.send(map[string]any{"type": "TextBlock", "text": msg, "wrap": true})
+}
+
+/* File is not supported, webhooks can not upload files. */
+func (t *Teams) File(path string) error {
+	logger.Debug(common.ErrInvalidFile.Error(), common.DefaultField(path))
+	return fmt.Errorf("%w: Teams webhooks can not send files", common.ErrInvalidFile)
+}
+
+/* Image sends an Image element, path has to be an URL. */
+func (t *Teams) Image(path string) error {
+	if !common.IsURL(path) {
+		logger.Debug(common.ErrInvalidURL.Error(), common.DefaultField(path))
+		return common.ErrInvalidURL
+	}
+	return t.send(map[string]any{"type": "Image", "url": path})
+}
+
+func (t *Teams) send(elements ...map[string]any) error {
+	card := map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    elements,
+			},
+		}},
+	}
+	_, err := notifyJSON(t.URL, "", card)
+	return err
+}
@@ -17,8 +17,12 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"html"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	tgBot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/linzeyan/ops-cli/cmd/common"
@@ -28,11 +32,17 @@ import (
 func initTelegram() *cobra.Command {
 	var flags struct {
 		/* Bind flags */
-		Token   string `json:"token"`
-		ChatID  string `json:"chat_id"`
-		Chat    int64
+		Token  string `json:"token"`
+		ChatID string `json:"chat_id"`
+		Chat   int64
+		API    string `json:"api"`
+		NotifyQueue
 		arg     string
 		caption string
+		thread  string
+		edit    string
+		message NotifyMessage
+		bot     TelegramBot
 	}
 	var telegramCmd = &cobra.Command{
 		GroupID: getGroupID(CommandTelegram),
@@ -43,54 +53,101 @@ func initTelegram() *cobra.Command {
 		DisableFlagsInUseLine: true,
 	}
 
-	run := func(cmd *cobra.Command, _ []string) {
-		if flags.arg == "" {
-			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
-			return
-		}
-		var err error
+	var t Telegram
+	setup := func() error {
 		if rootConfig != "" {
-			if err = ReadConfig(CommandTelegram, &flags); err != nil {
-				logger.Error(err.Error())
-				return
+			if err := ReadConfig(CommandTelegram, &flags); err != nil {
+				return err
 			}
 			i, err := strconv.ParseInt(flags.ChatID, 10, 64)
 			if err != nil {
-				logger.Error(err.Error())
-				return
+				return err
 			}
 			flags.Chat = i
 		}
-		var t Telegram
-		if err = t.Init(flags.Token); err != nil {
+		if flags.Token == "" {
+			return common.ErrInvalidToken
+		}
+		t = Telegram{Format: flags.message.Format, Endpoint: flags.API}
+		return nil
+	}
+	send := func(entry NotifyOutboxEntry) error {
+		/* Init calls getMe, so it is retried and queued with the message. */
+		if t.API == nil {
+			if err := t.Init(flags.Token); err != nil {
+				return err
+			}
+		}
+		/* Entries of the outbox keep their chat and format, flags are used if they have none. */
+		chat, err := strconv.ParseInt(notifyOption(entry, "chat", strconv.FormatInt(flags.Chat, 10)), 10, 64)
+		if err != nil {
+			return err
+		}
+		t.Format = notifyOption(entry, "format", flags.message.Format)
+		if t.Reply, err = telegramMessageID(entry.Options["thread"]); err != nil {
+			return err
+		}
+		if entry.Options["edit"] != "" {
+			id, err := telegramMessageID(entry.Options["edit"])
+			if err != nil {
+				return err
+			}
+			return t.Edit(chat, id, entry.Arg)
+		}
+		caption := entry.Options["caption"]
+		switch entry.Kind {
+		case CommandAudio:
+			return t.Audio(chat, entry.Arg, caption)
+		case CommandFile:
+			return t.File(chat, entry.Arg, caption)
+		case CommandPhoto:
+			return t.Photo(chat, entry.Arg, caption)
+		case CommandVideo:
+			return t.Video(chat, entry.Arg, caption)
+		case CommandVoice:
+			return t.Voice(chat, entry.Arg, caption)
+		}
+		return t.Text(chat, entry.Arg)
+	}
+
+	run := func(cmd *cobra.Command, _ []string) {
+		if flags.arg == "" && (cmd.Name() != CommandText || flags.message.Template == "") {
+			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
+			return
+		}
+		if flags.edit != "" && cmd.Name() != CommandText {
+			logger.Error(common.ErrInvalidArg.Error(), common.NewField("edit", flags.edit))
+			return
+		}
+		var err error
+		if err = setup(); err != nil {
 			logger.Error(err.Error())
 			return
 		}
+		if cmd.Name() == CommandText {
+			if flags.arg, err = flags.message.Render(flags.arg, os.Stdin); err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
 		if cmd.Name() != CommandText {
 			if !common.IsFile(flags.arg) && !common.IsURL(flags.arg) {
 				logger.Error(common.ErrInvalidFile.Error())
 				return
 			}
 		}
-		switch cmd.Name() {
-		case CommandAudio:
-			err = t.Audio(flags.Chat, flags.arg, flags.caption)
-		case CommandFile:
-			err = t.File(flags.Chat, flags.arg, flags.caption)
-		case CommandPhoto:
-			err = t.Photo(flags.Chat, flags.arg, flags.caption)
-		case CommandText:
-			err = t.Text(flags.Chat, flags.arg)
-		case CommandVideo:
-			err = t.Video(flags.Chat, flags.arg, flags.caption)
-		case CommandVoice:
-			err = t.Voice(flags.Chat, flags.arg, flags.caption)
+		entry := NotifyOutboxEntry{
+			Target: CommandTelegram,
+			Kind:   cmd.Name(),
+			Arg:    flags.arg,
+			Options: notifyOptions("chat", strconv.FormatInt(flags.Chat, 10), "format", flags.message.Format,
+				"caption", flags.caption, "thread", flags.thread, "edit", flags.edit),
 		}
-		if err != nil {
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
 			logger.Error(err.Error())
 			return
 		}
-		printer.Printf(printer.SetNoneAsDefaultFormat(rootOutputFormat), t.Response)
+		printer.Printf(printer.SetJSONAsDefaultFormat(rootOutputFormat), t.Sent())
 	}
 
 	var telegramSubCmdAudio = &cobra.Command{
@@ -99,6 +156,51 @@ func initTelegram() *cobra.Command {
 		Run:   run,
 	}
 
+	var telegramSubCmdBot = &cobra.Command{
+		Use:   CommandBot,
+		Short: "Run ops-cli commands sent from whitelisted chats",
+		Run: func(_ *cobra.Command, _ []string) {
+			var err error
+			if rootConfig != "" {
+				if err = ReadConfig(CommandTelegram, &flags); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+				if err = ReadConfig(CommandTelegram, &flags.bot); err != nil {
+					logger.Error(err.Error())
+					return
+				}
+				if flags.Chat, err = strconv.ParseInt(flags.ChatID, 10, 64); err != nil && flags.ChatID != "" {
+					logger.Error(err.Error())
+					return
+				}
+			}
+			if len(flags.bot.Allow) == 0 && flags.Chat != 0 {
+				flags.bot.Allow = []int64{flags.Chat}
+			}
+			if len(flags.bot.Allow) == 0 {
+				logger.Error(common.ErrInvalidFlag.Error(), common.NewField("allow", flags.bot.Allow))
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
+			t := Telegram{Endpoint: flags.API}
+			if err = t.Init(flags.Token); err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			flags.bot.API = t.API
+			logger.Info("listening", common.NewField("bot", t.API.Self.UserName), common.NewField("allow", flags.bot.Allow))
+			flags.bot.Run(common.Context)
+		},
+		Example: common.Examples(`# Reply /ping host, /cert host and /dig name sent from chat 12345678
+-t bot_token --allow 12345678
+
+# The chat_id of the telegram block is allowed if --allow is not set
+--commands cert,dig,ping,tcping,whois --timeout 1m --config ~/.config.toml`, CommandTelegram, CommandBot),
+	}
+	telegramSubCmdBot.Flags().Int64SliceVar(&flags.bot.Allow, "allow", nil, common.Usage("Chat IDs allowed to run commands"))
+	flags.bot.ChatOps.addFlags(telegramSubCmdBot)
+
 	var telegramSubCmdFile = &cobra.Command{
 		Use:   CommandFile,
 		Short: "Send file to Telegram",
@@ -118,7 +220,7 @@ func initTelegram() *cobra.Command {
 					return
 				}
 			}
-			var t Telegram
+			t := Telegram{Endpoint: flags.API}
 			if err = t.Init(flags.Token); err != nil {
 				logger.Error(err.Error())
 				return
@@ -134,7 +236,14 @@ func initTelegram() *cobra.Command {
 		Short: "Send text to Telegram",
 		Run:   run,
 		Example: common.Examples(`# Send message
--t bot_token -c chat_id -a 'Hello word'`, CommandTelegram, CommandText),
+-t bot_token -c chat_id -a 'Hello word'
+
+# Send output of a command from stdin as HTML
+-t bot_token -c chat_id -a - --template alert.tmpl --format html < df.txt
+
+# Reply to message 42, then edit the reply with the id printed
+-t bot_token -c chat_id --thread 42 -a 'backup started'
+-t bot_token -c chat_id --edit 43 -a 'backup finished'`, CommandTelegram, CommandText),
 	}
 
 	var telegramSubCmdPhoto = &cobra.Command{
@@ -159,11 +268,17 @@ func initTelegram() *cobra.Command {
 	}
 	telegramCmd.PersistentFlags().StringVarP(&flags.Token, "token", "t", "", common.Usage("Bot token (required)"))
 	telegramCmd.PersistentFlags().Int64VarP(&flags.Chat, "chat-id", "c", 0, common.Usage("Chat ID"))
-	telegramCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument"))
+	telegramCmd.PersistentFlags().StringVar(&flags.API, "api", "", common.Usage("Bot API endpoint, e.g. http://localhost:8081/bot%s/%s of a local Bot API server"))
+	telegramCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads text from stdin"))
 	telegramCmd.PersistentFlags().StringVarP(&flags.caption, "caption", "", "", common.Usage("Add caption for file"))
+	flags.message.addFlags(telegramCmd, []string{notifyFormatPlain, notifyFormatMarkdown, notifyFormatHTML}, false)
+	addReplyFlags(telegramCmd, &flags.thread, &flags.edit, "Reply to the message of this ID")
+	flags.NotifyQueue.addFlags(telegramCmd)
 
 	telegramCmd.AddCommand(telegramSubCmdAudio)
+	telegramCmd.AddCommand(telegramSubCmdBot)
 	telegramCmd.AddCommand(telegramSubCmdFile)
+	telegramCmd.AddCommand(flags.NotifyQueue.flushCommand(CommandTelegram, setup, send))
 	telegramCmd.AddCommand(telegramSubCmdID)
 	telegramCmd.AddCommand(telegramSubCmdText)
 	telegramCmd.AddCommand(telegramSubCmdPhoto)
@@ -175,6 +290,12 @@ func initTelegram() *cobra.Command {
 type Telegram struct {
 	API      *tgBot.BotAPI
 	Response tgBot.Message
+	/* Format is plain, markdown (MarkdownV2, default) or html. */
+	Format string
+	/* Endpoint is the Bot API endpoint with placeholders of token and method, defaults to api.telegram.org. */
+	Endpoint string
+	/* Reply is the ID of the message to reply to. */
+	Reply int
 }
 
 func (t *Telegram) Init(token string) error {
@@ -183,7 +304,14 @@ func (t *Telegram) Init(token string) error {
 		logger.Debug(common.ErrInvalidToken.Error())
 		return common.ErrInvalidToken
 	}
-	t.API, err = tgBot.NewBotAPI(token)
+	if t.Endpoint == "" {
+		t.Endpoint = tgBot.APIEndpoint
+	}
+	t.API, err = tgBot.NewBotAPIWithAPIEndpoint(token, t.Endpoint)
+	if err != nil {
+		logger.Debug(err.Error())
+		return err
+	}
 	if t.API == nil {
 		logger.Debug(common.ErrFailedInitial.Error())
 		return common.ErrFailedInitial
@@ -194,12 +322,14 @@ func (t *Telegram) Init(token string) error {
 func (t Telegram) Animation(chat int64, arg, caption string) error {
 	input := tgBot.NewAnimation(chat, t.parseFile(arg))
 	input.Caption = caption
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
 func (t *Telegram) Audio(chat int64, arg, caption string) error {
 	input := tgBot.NewAudio(chat, t.parseFile(arg))
 	input.Caption = caption
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
@@ -220,37 +350,81 @@ func (t Telegram) ChatTitle(chat int64, arg string) error {
 
 func (t Telegram) Dice(chat int64) error {
 	input := tgBot.NewDice(chat)
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
 func (t *Telegram) File(chat int64, arg, caption string) error {
 	input := tgBot.NewDocument(chat, t.parseFile(arg))
 	input.Caption = caption
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
 func (t *Telegram) Text(chat int64, arg string) error {
+	var err error
 	input := tgBot.NewMessage(chat, arg)
-	input.ParseMode = tgBot.ModeMarkdownV2
+	if input.ParseMode, err = t.parseMode(); err != nil {
+		return err
+	}
+	input.DisableWebPagePreview = true
+	input.ReplyToMessageID = t.Reply
+	return t.send(input)
+}
+
+/* Edit replaces the text of message id with arg. */
+func (t *Telegram) Edit(chat int64, id int, arg string) error {
+	var err error
+	input := tgBot.NewEditMessageText(chat, id, arg)
+	if input.ParseMode, err = t.parseMode(); err != nil {
+		return err
+	}
 	input.DisableWebPagePreview = true
 	return t.send(input)
 }
 
+/* Sent returns the IDs of the last sent or edited message. */
+func (t *Telegram) Sent() NotifySent {
+	sent := NotifySent{ID: strconv.Itoa(t.Response.MessageID)}
+	if t.Response.Chat != nil {
+		sent.Channel = strconv.FormatInt(t.Response.Chat.ID, 10)
+	}
+	if t.Reply != 0 {
+		sent.Thread = strconv.Itoa(t.Reply)
+	}
+	return sent
+}
+
+func (t *Telegram) parseMode() (string, error) {
+	switch t.Format {
+	case "", notifyFormatMarkdown:
+		return tgBot.ModeMarkdownV2, nil
+	case notifyFormatHTML:
+		return tgBot.ModeHTML, nil
+	case notifyFormatPlain:
+		return "", nil
+	}
+	return "", errNotifyFormat(CommandTelegram, t.Format)
+}
+
 func (t *Telegram) Photo(chat int64, arg, caption string) error {
 	input := tgBot.NewPhoto(chat, t.parseFile(arg))
 	input.Caption = caption
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
 func (t *Telegram) Video(chat int64, arg, caption string) error {
 	input := tgBot.NewVideo(chat, t.parseFile(arg))
 	input.Caption = caption
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
 func (t *Telegram) Voice(chat int64, arg, caption string) error {
 	input := tgBot.NewVoice(chat, t.parseFile(arg))
 	input.Caption = caption
+	input.ReplyToMessageID = t.Reply
 	return t.send(input)
 }
 
@@ -287,3 +461,143 @@ func (t *Telegram) send(c tgBot.Chattable) error {
 	}
 	return err
 }
+
+/* telegramMessageID parses the message ID of --thread and --edit, empty is 0. */
+func telegramMessageID(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(s))
+		return 0, common.ErrInvalidArg
+	}
+	return id, nil
+}
+
+/* TelegramNotifier adapts Telegram to Notifier, fields are read from the telegram config block. */
+type TelegramNotifier struct {
+	Token  string `json:"token"`
+	ChatID string `json:"chat_id"`
+	Format string `json:"format"`
+	API    string `json:"api"`
+	chat   int64
+	api    Telegram
+}
+
+func (n *TelegramNotifier) setup() error {
+	var err error
+	n.api.Format, n.api.Endpoint = n.Format, n.API
+	if n.chat, err = strconv.ParseInt(n.ChatID, 10, 64); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(n.ChatID))
+		return err
+	}
+	if n.Token == "" {
+		logger.Debug(common.ErrInvalidToken.Error())
+		return common.ErrInvalidToken
+	}
+	return nil
+}
+
+/* init connects on the first message, so a failed getMe is retried like a failed send. */
+func (n *TelegramNotifier) init() error {
+	if n.api.API != nil {
+		return nil
+	}
+	return n.api.Init(n.Token)
+}
+
+func (n *TelegramNotifier) Text(msg string) error {
+	if err := n.init(); err != nil {
+		return err
+	}
+	return n.api.Text(n.chat, msg)
+}
+
+/* Plain sends msg without MarkdownV2 or HTML, which reject unescaped characters. */
+func (n *TelegramNotifier) Plain(msg string) error {
+	if err := n.init(); err != nil {
+		return err
+	}
+	api := n.api
+	api.Format = notifyFormatPlain
+	return api.Text(n.chat, msg)
+}
+
+func (n *TelegramNotifier) File(path string) error {
+	if err := n.init(); err != nil {
+		return err
+	}
+	return n.api.File(n.chat, path, "")
+}
+
+func (n *TelegramNotifier) Image(path string) error {
+	if err := n.init(); err != nil {
+		return err
+	}
+	return n.api.Photo(n.chat, path, "")
+}
+
+/* TelegramBot runs ops-cli commands sent from chats in Allow and replies the output in a code block. */
+type TelegramBot struct {
+	ChatOps
+	API   *tgBot.BotAPI `json:"-"`
+	Allow []int64       `json:"allow"`
+}
+
+/* Run long-polls updates until ctx is done, messages over Concurrency are dropped. */
+func (b *TelegramBot) Run(ctx context.Context) {
+	u := tgBot.NewUpdate(0)
+	u.Timeout = 60
+	updates := b.API.GetUpdatesChan(u)
+	for {
+		select {
+		case <-ctx.Done():
+			b.API.StopReceivingUpdates()
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if msg := update.Message; msg != nil {
+				b.Go(func() { b.handle(ctx, msg) })
+			}
+		}
+	}
+}
+
+func (b *TelegramBot) handle(ctx context.Context, msg *tgBot.Message) {
+	if !slices.Contains(b.Allow, msg.Chat.ID) {
+		logger.Warn("chat is not allowed", common.NewField("chat", msg.Chat.ID), common.NewField("text", msg.Text))
+		return
+	}
+	if !msg.IsCommand() {
+		return
+	}
+	var user string
+	if msg.From != nil {
+		user = msg.From.UserName
+	}
+	logger.Info(msg.Text, common.NewField("chat", msg.Chat.ID), common.NewField("user", user))
+	reply := tgBot.NewMessage(msg.Chat.ID, b.Dispatch(ctx, msg.Command(), strings.Fields(msg.CommandArguments())))
+	reply.ParseMode = tgBot.ModeHTML
+	reply.ReplyToMessageID = msg.MessageID
+	if _, err := b.API.Send(reply); err != nil {
+		logger.Warn(err.Error(), common.NewField("chat", msg.Chat.ID))
+	}
+}
+
+/* telegramMaxText keeps the reply under 4096 characters, the limit of a message. */
+const telegramMaxText = 3800
+
+/* Dispatch runs ops-cli command with args and returns the reply in HTML. */
+func (b *TelegramBot) Dispatch(ctx context.Context, command string, args []string) string {
+	if command == "start" || command == "help" {
+		return html.EscapeString(b.Help("/"))
+	}
+	out, err := b.Exec(ctx, command, args)
+	if err != nil {
+		return html.EscapeString(err.Error() + "\n\n" + b.Help("/"))
+	}
+	return "<pre>" + html.EscapeString(truncateText(out, telegramMaxText)) + "</pre>"
+}
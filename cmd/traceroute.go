@@ -17,9 +17,18 @@ limitations under the License.
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"net"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/linzeyan/ops-cli/cmd/common"
@@ -33,6 +42,8 @@ func initTraceroute() *cobra.Command {
 		size, maxTTL int
 		interval     time.Duration
 		timeout      time.Duration
+		asn, geo     bool
+		databases    []string
 	}
 	var tracerouteCmd = &cobra.Command{
 		GroupID: getGroupID(CommandTraceroute),
@@ -62,6 +73,14 @@ func initTraceroute() *cobra.Command {
 				Timeout:  flags.timeout,
 				Count:    1,
 			}
+			if flags.asn || flags.geo {
+				t.Lookup = &HopLookup{DNS: true, ASN: flags.asn, Geo: flags.geo, Databases: flags.databases}
+				if err := t.Lookup.Open(); err != nil {
+					logger.Info(err.Error())
+					printer.Error(err)
+					return
+				}
+			}
 			data := Randoms.GenerateString(t.Size, LowercaseLetters)
 			t.Data = icmp.Message{
 				Type: ipv4.ICMPTypeEcho,
@@ -98,6 +117,9 @@ func initTraceroute() *cobra.Command {
 	tracerouteCmd.Flags().IntVarP(&flags.maxTTL, "max-ttl", "m", 64, common.Usage("Specify max hop"))
 	tracerouteCmd.Flags().DurationVarP(&flags.interval, "interval", "i", 500*time.Millisecond, common.Usage("Specify interval"))
 	tracerouteCmd.Flags().DurationVarP(&flags.timeout, "timeout", "t", 2*time.Second, common.Usage("Specify timeout"))
+	tracerouteCmd.Flags().BoolVar(&flags.asn, "asn", false, common.Usage("Print PTR, origin ASN and organization of each hop"))
+	tracerouteCmd.Flags().BoolVar(&flags.geo, "geo", false, common.Usage("Print city and country of each hop"))
+	tracerouteCmd.Flags().StringSliceVar(&flags.databases, "db", nil, common.Usage("Offline MaxMind (.mmdb) or ip2asn (.tsv) database, skip online lookups"))
 	return tracerouteCmd
 }
 
@@ -112,9 +134,14 @@ type Traceroute struct {
 
 	Count int
 
+	/* Lookup annotates hops with PTR, ASN and geolocation if not nil. */
+	Lookup *HopLookup
+
 	lost   bool
 	Record bool
-	Stat   []ICMPStat
+	/* mu guards Stat, which Connect writes while mtr reads it. */
+	mu   sync.Mutex
+	Stat []ICMPStat
 }
 
 func (*Traceroute) Listen() (*icmp.PacketConn, error) {
@@ -215,6 +242,10 @@ func (t *Traceroute) sendPacket(hop int, b, reply []byte) (string, error) {
 	if t.Record {
 		return ip, err
 	}
+	if t.Lookup != nil && ip != "" {
+		printer.Printf("%2d. %-16v\t%-10s\t%-10s\t%-10s\t%s\n", hop, ip, rtt[0], rtt[1], rtt[2], t.Lookup.Resolve(ip))
+		return ip, err
+	}
 	printer.Printf("%2d. %-16v\t%-10s\t%-10s\t%-10s\n", hop, ip, rtt[0], rtt[1], rtt[2])
 	return ip, err
 }
@@ -223,6 +254,8 @@ func (t *Traceroute) statistics(hop int, ip string, duration time.Duration) {
 	if !t.Record {
 		return
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if len(t.Stat) < hop {
 		t.Stat = append(t.Stat, ICMPStat{
 			Hop: hop,
@@ -252,3 +285,258 @@ func (t *Traceroute) statistics(hop int, ip string, duration time.Duration) {
 		t.Stat[hop-1].Max = duration
 	}
 }
+
+/* Stats returns a copy of Stat, which is safe to read while Connect records. */
+func (t *Traceroute) Stats() []ICMPStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := slices.Clone(t.Stat)
+	for i := range stats {
+		stats[i].Rtts = slices.Clone(stats[i].Rtts)
+	}
+	return stats
+}
+
+/* ResetStats clears Stat. */
+func (t *Traceroute) ResetStats() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Stat = nil
+}
+
+/* HopInfo is the reverse DNS, origin AS and location of a hop. */
+type HopInfo struct {
+	IP      string `json:"ip" yaml:"ip"`
+	PTR     string `json:"ptr,omitempty" yaml:"ptr,omitempty"`
+	ASN     string `json:"asn,omitempty" yaml:"asn,omitempty"`
+	Org     string `json:"org,omitempty" yaml:"org,omitempty"`
+	City    string `json:"city,omitempty" yaml:"city,omitempty"`
+	Country string `json:"country,omitempty" yaml:"country,omitempty"`
+}
+
+func (h HopInfo) String() string {
+	var out []string
+	if h.PTR != "" {
+		out = append(out, h.PTR)
+	}
+	if h.ASN != "" {
+		out = append(out, strings.TrimSpace("AS"+h.ASN+" "+h.Org))
+	}
+	var location []string
+	for _, v := range []string{h.City, h.Country} {
+		if v != "" {
+			location = append(location, v)
+		}
+	}
+	if len(location) != 0 {
+		out = append(out, strings.Join(location, ", "))
+	}
+	return strings.Join(out, "  ")
+}
+
+/* HopLookup resolves HopInfo online (PTR, Team Cymru and ip-api.com) or from offline databases. */
+type HopLookup struct {
+	DNS, ASN, Geo bool
+	/* Databases are MaxMind (.mmdb) or ip2asn (.tsv) files, online lookups are skipped if set. */
+	Databases []string
+
+	mu    sync.Mutex
+	cache map[string]*HopInfo
+	mmdb  []*common.MMDB
+	tsv   []hopASNRange
+}
+
+type hopASNRange struct {
+	first, last netip.Addr
+	asn         string
+	country     string
+	org         string
+}
+
+/* Open loads the offline databases. */
+func (h *HopLookup) Open() error {
+	h.cache = make(map[string]*HopInfo)
+	for _, path := range h.Databases {
+		if strings.EqualFold(filepath.Ext(path), ".mmdb") {
+			db, err := common.OpenMMDB(path)
+			if err != nil {
+				logger.Debug(err.Error(), common.DefaultField(path))
+				return err
+			}
+			h.mmdb = append(h.mmdb, db)
+			continue
+		}
+		if err := h.openTSV(path); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(path))
+			return err
+		}
+	}
+	sort.Slice(h.tsv, func(i, j int) bool { return h.tsv[i].first.Less(h.tsv[j].first) })
+	return nil
+}
+
+/* openTSV reads ip2asn-combined.tsv: range_start, range_end, AS_number, country_code, AS_description. */
+func (h *HopLookup) openTSV(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 || fields[2] == "0" {
+			continue
+		}
+		first, err1 := netip.ParseAddr(fields[0])
+		last, err2 := netip.ParseAddr(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		h.tsv = append(h.tsv, hopASNRange{first: first, last: last, asn: fields[2], country: fields[3], org: fields[4]})
+	}
+	return scanner.Err()
+}
+
+/* Get returns the cached HopInfo of ip, and resolves it in background if not cached yet. */
+func (h *HopLookup) Get(ip string) HopInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cache == nil {
+		h.cache = make(map[string]*HopInfo)
+	}
+	info, ok := h.cache[ip]
+	if !ok {
+		info = &HopInfo{IP: ip}
+		h.cache[ip] = info
+		go h.Resolve(ip)
+	}
+	return *info
+}
+
+/* Resolve looks up ip and caches the result. */
+func (h *HopLookup) Resolve(ip string) HopInfo {
+	info := HopInfo{IP: ip}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(ip))
+		return info
+	}
+	if h.DNS {
+		names, err := net.LookupAddr(ip)
+		if err == nil && len(names) != 0 {
+			info.PTR = strings.TrimSuffix(names[0], ".")
+		}
+	}
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		h.store(&info)
+		return info
+	}
+	switch {
+	case len(h.Databases) != 0:
+		h.offline(addr, &info)
+	default:
+		if h.ASN {
+			h.cymru(addr, &info)
+		}
+		if h.Geo {
+			var g GeoIP
+			out, err := g.Request([]string{ip})
+			if err == nil && len(out) != 0 {
+				info.City = out[0].City
+				info.Country = out[0].CountryCode
+			}
+		}
+	}
+	if !h.Geo {
+		info.City, info.Country = "", ""
+	}
+	h.store(&info)
+	return info
+}
+
+func (h *HopLookup) store(info *HopInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cache == nil {
+		h.cache = make(map[string]*HopInfo)
+	}
+	h.cache[info.IP] = info
+}
+
+func (h *HopLookup) offline(addr netip.Addr, info *HopInfo) {
+	for _, db := range h.mmdb {
+		record, err := db.Lookup(net.IP(addr.AsSlice()))
+		if err != nil || record == nil {
+			continue
+		}
+		if v := common.MMDBString(record, "autonomous_system_number"); v != "" && h.ASN {
+			info.ASN = v
+			info.Org = common.MMDBString(record, "autonomous_system_organization")
+		}
+		if v := common.MMDBString(record, "city", "names", "en"); v != "" {
+			info.City = v
+		}
+		if v := common.MMDBString(record, "country", "iso_code"); v != "" {
+			info.Country = v
+		}
+	}
+	if !h.ASN || info.ASN != "" {
+		return
+	}
+	i := sort.Search(len(h.tsv), func(i int) bool { return addr.Less(h.tsv[i].first) })
+	if i == 0 {
+		return
+	}
+	r := h.tsv[i-1]
+	if addr.Compare(r.last) > 0 {
+		return
+	}
+	info.ASN, info.Org = r.asn, r.org
+	if info.Country == "" {
+		info.Country = r.country
+	}
+}
+
+/* cymru queries origin.asn.cymru.com and AS<n>.asn.cymru.com TXT records. */
+func (*HopLookup) cymru(addr netip.Addr, info *HopInfo) {
+	var name string
+	if addr.Is4() {
+		b := addr.As4()
+		name = fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", b[3], b[2], b[1], b[0])
+	} else {
+		b := addr.As16()
+		var nibbles []string
+		for i := len(b) - 1; i >= 0; i-- {
+			nibbles = append(nibbles, strconv.FormatUint(uint64(b[i]&0x0f), 16), strconv.FormatUint(uint64(b[i]>>4), 16))
+		}
+		name = strings.Join(nibbles, ".") + ".origin6.asn.cymru.com"
+	}
+	/* "13335 | 1.1.1.0/24 | AU | apnic | 2011-08-11" */
+	txt, err := net.LookupTXT(name)
+	if err != nil || len(txt) == 0 {
+		logger.Debug(fmt.Sprint(err), common.DefaultField(name))
+		return
+	}
+	fields := strings.Split(txt[0], "|")
+	asn := strings.Fields(fields[0])
+	if len(asn) == 0 {
+		return
+	}
+	info.ASN = asn[0]
+	if len(fields) > 2 {
+		info.Country = strings.TrimSpace(fields[2])
+	}
+	/* "13335 | US | arin | 2010-07-14 | CLOUDFLARENET, US" */
+	txt, err = net.LookupTXT("AS" + info.ASN + ".asn.cymru.com")
+	if err != nil || len(txt) == 0 {
+		logger.Debug(fmt.Sprint(err), common.NewField("asn", info.ASN))
+		return
+	}
+	fields = strings.Split(txt[0], "|")
+	org := strings.TrimSpace(fields[len(fields)-1])
+	if i := strings.LastIndex(org, ","); i != -1 {
+		org = org[:i]
+	}
+	info.Org = org
+}
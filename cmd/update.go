@@ -371,13 +371,12 @@ func (u *Updater) init(ver string) *Updater {
 
 /* Fetch the release file. */
 func (u *Updater) Download() error {
-	var err error
-	resp, err := common.HTTPRequestContent(u.Repository.DownloadLink)
+	d := Downloader{Progress: true}
+	err := d.Download(common.Context, u.Repository.DownloadLink, u.Repository.DownloadPath)
 	if err != nil {
 		logger.Debug(err.Error(), common.DefaultField(u.Repository.DownloadLink))
-		return err
 	}
-	return os.WriteFile(u.Repository.DownloadPath, resp, FileModeRAll)
+	return err
 }
 
 /* Decompress, replace original file, and remove compress files ...etc. */
@@ -17,20 +17,46 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/linzeyan/ops-cli/cmd/common"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func initURL() *cobra.Command {
 	var urlFlag struct {
-		expand  bool
-		verbose bool
-		output  string
-		method  string
-		data    string
-		headers string
+		expand      bool
+		verbose     bool
+		output      string
+		method      string
+		data        string
+		headers     []string
+		user        string
+		bearer      string
+		digest      bool
+		form        []string
+		multipart   []string
+		cookieJar   string
+		timeout     time.Duration
+		retry       int
+		retryUnsafe bool
+		insecure    bool
+		caCert      string
+		proxy       string
+		parallel    int
+		sha256      string
 	}
 	var urlCmd = &cobra.Command{
 		GroupID: getGroupID(CommandURL),
@@ -53,21 +79,58 @@ func initURL() *cobra.Command {
 					return
 				}
 			default:
+				headers, err := parseHeaders(urlFlag.headers)
+				if err != nil {
+					logger.Error(err.Error(), common.DefaultField(urlFlag.headers))
+					printer.Error(err)
+					return
+				}
 				body := common.HTTPConfig{
-					Body:    urlFlag.data,
-					Method:  urlFlag.method,
-					Verbose: urlFlag.verbose,
-					Headers: urlFlag.headers,
+					Body:        urlFlag.data,
+					Method:      urlFlag.method,
+					Verbose:     urlFlag.verbose,
+					Headers:     headers,
+					Auth:        urlFlag.user,
+					Form:        urlFlag.form,
+					Multipart:   urlFlag.multipart,
+					CookieJar:   urlFlag.cookieJar,
+					Timeout:     urlFlag.timeout,
+					Retry:       urlFlag.retry,
+					RetryUnsafe: urlFlag.retryUnsafe,
+					Insecure:    urlFlag.insecure,
+					CACert:      urlFlag.caCert,
+					Proxy:       urlFlag.proxy,
 				}
-				result, err = common.HTTPRequestContent(url, body)
-				if err != nil || urlFlag.verbose {
-					logger.Error(err.Error())
-					return
+				switch {
+				case urlFlag.bearer != "":
+					body.AuthType, body.Auth = common.HTTPAuthBearer, urlFlag.bearer
+				case urlFlag.digest:
+					body.AuthType = common.HTTPAuthDigest
+				}
+				if body.Method == http.MethodGet && (body.Body != "" || len(body.Form) != 0 || len(body.Multipart) != 0) {
+					body.Method = http.MethodPost
 				}
 				if urlFlag.output != "" {
-					if err = os.WriteFile(urlFlag.output, result.([]byte), FileModeRAll); err != nil {
+					d := Downloader{
+						Config:   body,
+						Parallel: urlFlag.parallel,
+						Progress: true,
+						SHA256:   urlFlag.sha256,
+					}
+					if err = d.Download(common.Context, url, urlFlag.output); err != nil {
 						logger.Error(err.Error())
+						printer.Error(err)
 					}
+					return
+				}
+				result, err = common.HTTPRequestContent(url, body)
+				if err != nil {
+					logger.Error(err.Error())
+					printer.Error(err)
+					return
+				}
+				if urlFlag.verbose {
+					return
 				}
 			}
 			printer.Printf(rootOutputFormat, result)
@@ -75,15 +138,450 @@ func initURL() *cobra.Command {
 		Example: common.Examples(`# Get the file from URL
 https://raw.githubusercontent.com/golangci/golangci-lint/master/.golangci.reference.yml -o config.yaml
 
+# Download with 4 connections and verify the checksum
+https://example.com/release.tar.gz -o release.tar.gz -p 4 --sha256 "$(cat release.tar.gz.sha256)"
+
 # Get the real URL from the shortened URL
-https://goo.gl/maps/b37Aq3Anc7taXQDd9 -e`,
+https://goo.gl/maps/b37Aq3Anc7taXQDd9 -e
+
+# Post JSON from a file with headers
+https://httpbin.org/post -d @body.json -H 'Content-Type: application/json' -H 'X-Request-ID: 1'
+
+# Upload a file with multipart form and basic auth
+https://httpbin.org/post -F name=report -F file=@report.pdf -u user:password
+
+# Use digest auth, keep cookies and retry three times
+https://httpbin.org/digest-auth/auth/user/password -u user:password --digest -b cookies.json --retry 3
+
+# Go through a SOCKS5 proxy and trust a private CA
+https://internal.example.com -x socks5://127.0.0.1:1080 --cacert ca.pem`,
 			CommandURL),
 	}
 	urlCmd.Flags().BoolVarP(&urlFlag.expand, "expand", "e", false, "Expand shorten url")
 	urlCmd.Flags().BoolVarP(&urlFlag.verbose, "verbose", "v", false, "Verbose output")
-	urlCmd.Flags().StringVarP(&urlFlag.output, "output-file", "o", "", "Write to file")
-	urlCmd.Flags().StringVarP(&urlFlag.method, "method", "m", "GET", "Request method")
-	urlCmd.Flags().StringVarP(&urlFlag.data, "data", "d", "", "Request method")
-	urlCmd.Flags().StringVarP(&urlFlag.headers, "headers", "h", "", "Headers")
+	urlCmd.Flags().StringVarP(&urlFlag.output, "output-file", "o", "", "Download to file, resumes from file.part if it exists")
+	urlCmd.Flags().IntVarP(&urlFlag.parallel, "parallel", "p", 1, "Number of parallel byte-range connections for downloading")
+	urlCmd.Flags().StringVar(&urlFlag.sha256, "sha256", "", "Verify SHA-256 checksum of the downloaded file")
+	urlCmd.Flags().StringVarP(&urlFlag.method, "method", "m", http.MethodGet, "Request method")
+	urlCmd.Flags().StringVarP(&urlFlag.data, "data", "d", "", "Request body, @file reads from file and @- reads from stdin")
+	urlCmd.Flags().StringArrayVarP(&urlFlag.headers, "headers", "H", nil, "Headers, 'Key: Value' or JSON object, can be repeated")
+	urlCmd.Flags().StringVarP(&urlFlag.user, "user", "u", "", "Credentials user:password for basic or digest auth")
+	urlCmd.Flags().StringVar(&urlFlag.bearer, "bearer", "", "Token for bearer auth")
+	urlCmd.Flags().BoolVar(&urlFlag.digest, "digest", false, "Use digest auth")
+	urlCmd.Flags().StringArrayVar(&urlFlag.form, "data-urlencode", nil, "URL encoded form field key=value, can be repeated")
+	urlCmd.Flags().StringArrayVarP(&urlFlag.multipart, "form", "F", nil, "Multipart form field key=value or key=@file, can be repeated")
+	urlCmd.Flags().StringVarP(&urlFlag.cookieJar, "cookie-jar", "b", "", "File to read cookies from and write cookies to")
+	urlCmd.Flags().DurationVarP(&urlFlag.timeout, "timeout", "t", 15*time.Second, "Request timeout, downloads limit only the connection and the response headers")
+	urlCmd.Flags().IntVar(&urlFlag.retry, "retry", 0, "Retry times on network errors, 429 and 5xx of idempotent methods, with exponential backoff")
+	urlCmd.Flags().BoolVar(&urlFlag.retryUnsafe, "retry-unsafe", false, "Also retry 5xx of POST and PATCH, which may repeat their side effects")
+	urlCmd.Flags().BoolVarP(&urlFlag.insecure, "insecure", "k", false, "Skip TLS certificate verification")
+	urlCmd.Flags().StringVar(&urlFlag.caCert, "cacert", "", "CA certificate file to verify the server")
+	urlCmd.Flags().StringVarP(&urlFlag.proxy, "proxy", "x", "", "Proxy URL, http://, https:// or socks5://, default from environment")
 	return urlCmd
 }
+
+/* parseHeaders merges 'Key: Value' and JSON object headers into the JSON format of HTTPConfig. */
+func parseHeaders(headers []string) (string, error) {
+	if len(headers) == 0 {
+		return "", nil
+	}
+	header := make(map[string]string)
+	for _, v := range headers {
+		if strings.HasPrefix(strings.TrimSpace(v), "{") {
+			if err := json.Unmarshal([]byte(v), &header); err != nil {
+				return "", err
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(v, ":")
+		if !ok {
+			return "", common.ErrInvalidArg
+		}
+		header[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	b, err := json.Marshal(header)
+	return string(b), err
+}
+
+/* Downloader streams a URL to disk, resumes from path.part if the file is unchanged and verifies the SHA-256 checksum. */
+type Downloader struct {
+	Config common.HTTPConfig
+	/* Parallel is the number of byte-range connections, used when the server accepts ranges. */
+	Parallel int
+	Progress bool
+	SHA256   string
+
+	written atomic.Int64
+	/* validator is the ETag or Last-Modified of the file, sent as If-Range so a changed file is not appended to the old part. */
+	validator string
+}
+
+const (
+	downloadPartSuffix = ".part"
+	/* downloadMetaSuffix is appended to the part file for the file keeping the validator. */
+	downloadMetaSuffix = ".meta"
+)
+
+func (d *Downloader) Download(ctx context.Context, uri, path string) error {
+	if d.Config.Method == "" {
+		d.Config.Method = http.MethodGet
+	}
+	d.Config.Stream = true
+	client, err := d.Config.Client()
+	if err != nil {
+		return err
+	}
+	part := path + downloadPartSuffix
+	size, ranges, validator := d.head(ctx, client, uri)
+	if err = d.loadValidator(part, validator); err != nil {
+		return err
+	}
+	if d.Progress && term.IsTerminal(int(os.Stderr.Fd())) {
+		done := make(chan struct{})
+		defer func() {
+			close(done)
+			d.printProgress(size)
+			fmt.Fprintln(os.Stderr)
+		}()
+		go func() {
+			ticker := time.NewTicker(200 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					d.printProgress(size)
+				}
+			}
+		}()
+	}
+
+	if d.Parallel > 1 && ranges && size > 0 {
+		err = d.parallel(ctx, client, uri, part, size)
+	} else {
+		err = d.single(ctx, client, uri, part, size)
+	}
+	if err != nil {
+		return err
+	}
+	if d.SHA256 != "" {
+		sum, err := Hasher.Hash(HashAlgorithm(HashSha256), part)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, d.SHA256) {
+			logger.Debug(common.ErrChecksum.Error(), common.NewField("expected", d.SHA256), common.NewField("got", sum))
+			removeDownloadParts(part)
+			return fmt.Errorf("%w: expected %s, got %s", common.ErrChecksum, d.SHA256, sum)
+		}
+	}
+	if err = os.Rename(part, path); err != nil {
+		return err
+	}
+	if err = os.Remove(part + downloadMetaSuffix); err != nil && !os.IsNotExist(err) {
+		logger.Debug(err.Error(), common.DefaultField(part))
+	}
+	return nil
+}
+
+/* head returns the size of uri, whether the server accepts byte ranges and the validator of the file. */
+func (d *Downloader) head(ctx context.Context, client *http.Client, uri string) (int64, bool, string) {
+	if d.Config.Method != http.MethodGet {
+		return -1, false, ""
+	}
+	config := d.Config
+	config.Method = http.MethodHead
+	resp, err := config.Do(ctx, client, uri)
+	if err != nil {
+		return -1, false, ""
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1, false, ""
+	}
+	return resp.ContentLength, resp.Header.Get("Accept-Ranges") == "bytes", downloadValidator(resp.Header)
+}
+
+/*
+loadValidator compares validator of the file with the one saved next to part by the previous run, and starts over if the file changed.
+Without a validator from the server, the saved one is still sent as If-Range.
+*/
+func (d *Downloader) loadValidator(part, validator string) error {
+	meta := part + downloadMetaSuffix
+	saved, err := os.ReadFile(meta)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Debug(err.Error(), common.DefaultField(meta))
+		return err
+	}
+	d.validator = string(saved)
+	if validator == "" || validator == d.validator {
+		return nil
+	}
+	/* The parts were written from another version of the file, or by a run which did not save the validator. */
+	if _, err = os.Stat(part); err == nil {
+		logger.Debug("file changed, start over", common.NewField("saved", d.validator), common.NewField("validator", validator))
+	}
+	removeDownloadParts(part)
+	return d.saveValidator(part, validator)
+}
+
+/* saveValidator keeps validator next to part for the next run. */
+func (d *Downloader) saveValidator(part, validator string) error {
+	d.validator = validator
+	meta := part + downloadMetaSuffix
+	if validator == "" {
+		if err := os.Remove(meta); err != nil && !os.IsNotExist(err) {
+			logger.Debug(err.Error(), common.DefaultField(meta))
+			return err
+		}
+		return nil
+	}
+	if err := os.WriteFile(meta, []byte(validator), FileModeRAll); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(meta))
+		return err
+	}
+	return nil
+}
+
+/* downloadValidator returns the strong ETag of header, or Last-Modified, weak ETags are not accepted by If-Range. */
+func downloadValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+/* removeDownloadParts removes part, its validator and the files of its ranges. */
+func removeDownloadParts(part string) {
+	files := []string{part, part + downloadMetaSuffix}
+	entries, _ := os.ReadDir(filepath.Dir(part))
+	prefix := filepath.Base(part) + "."
+	for _, v := range entries {
+		start, end, ok := strings.Cut(strings.TrimPrefix(v.Name(), prefix), "-")
+		if !strings.HasPrefix(v.Name(), prefix) || !ok {
+			continue
+		}
+		if _, err := strconv.ParseInt(start, 10, 64); err != nil {
+			continue
+		}
+		if _, err := strconv.ParseInt(end, 10, 64); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(filepath.Dir(part), v.Name()))
+	}
+	for _, v := range files {
+		if err := os.Remove(v); err != nil && !os.IsNotExist(err) {
+			logger.Debug(err.Error(), common.DefaultField(v))
+		}
+	}
+}
+
+/* single downloads with one connection, and continues from the end of part if it exists, size is -1 if unknown. */
+func (d *Downloader) single(ctx context.Context, client *http.Client, uri, part string, size int64) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, FileModeRAll)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(part))
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	config := d.Config
+	if offset > 0 {
+		config.Headers = d.rangeHeader(offset, -1)
+	}
+	resp, err := config.Do(ctx, client, uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		d.written.Store(offset)
+	case http.StatusOK:
+		/* The server ignored the range or the file changed, start over. */
+		if err = f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err = d.saveValidator(part, downloadValidator(resp.Header)); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		/* part is complete only if its length is the length of the resource. */
+		if total := contentRangeSize(resp.Header.Get("Content-Range"), size); offset > 0 && total == offset {
+			d.written.Store(offset)
+			return nil
+		}
+		logger.Debug(common.ErrStatusCode.Error(), common.NewField("status", resp.StatusCode), common.NewField("offset", offset))
+		return fmt.Errorf("%w: %s, remove %s to start over", common.ErrStatusCode, resp.Status, part)
+	default:
+		logger.Debug(common.ErrStatusCode.Error(), common.NewField("status", resp.StatusCode))
+		return fmt.Errorf("%w: %s", common.ErrStatusCode, resp.Status)
+	}
+	_, err = io.Copy(f, io.TeeReader(resp.Body, downloadCounter{&d.written}))
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(uri))
+	}
+	return err
+}
+
+/* contentRangeSize returns the complete length of a Content-Range header like bytes 0-99/1234, or size if it is absent. */
+func contentRangeSize(contentRange string, size int64) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return size
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return size
+	}
+	return n
+}
+
+/*
+parallel splits size into Parallel byte ranges, the first range is written to part and the others to part.start-end.
+Every file is a prefix of its range, so an interrupted download resumes each range, and part alone resumes as a single download.
+The files of ranges are appended to part after all ranges are complete.
+*/
+func (d *Downloader) parallel(ctx context.Context, client *http.Client, uri, part string, size int64) error {
+	chunk := (size + int64(d.Parallel) - 1) / int64(d.Parallel)
+	var files []string
+	errs := make(chan error, d.Parallel)
+	var wg sync.WaitGroup
+	for start := int64(0); start < size; start += chunk {
+		end := min(start+chunk, size) - 1
+		file := part
+		if start != 0 {
+			file = fmt.Sprintf("%s.%d-%d", part, start, end)
+		}
+		files = append(files, file)
+		wg.Add(1)
+		go func(file string, start, end int64) {
+			defer wg.Done()
+			if err := d.chunk(ctx, client, uri, file, start, end); err != nil {
+				errs <- err
+			}
+		}(file, start, end)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		logger.Debug(err.Error(), common.DefaultField(uri))
+		return err
+	}
+
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_APPEND, FileModeRAll)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(part))
+		return err
+	}
+	defer f.Close()
+	for _, file := range files[1:] {
+		if err = appendFile(f, file); err != nil {
+			logger.Debug(err.Error(), common.DefaultField(file))
+			return err
+		}
+	}
+	return nil
+}
+
+/* chunk downloads the byte range start-end to file, and continues from the end of file if it exists. */
+func (d *Downloader) chunk(ctx context.Context, client *http.Client, uri, file string, start, end int64) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, FileModeRAll)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(file))
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	/* part may be longer than the first range if it was left by a single download. */
+	if length := end - start + 1; offset >= length {
+		d.written.Add(length)
+		return f.Truncate(length)
+	}
+	d.written.Add(offset)
+
+	config := d.Config
+	config.Headers = d.rangeHeader(start+offset, end)
+	resp, err := config.Do(ctx, client, uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		/* A full answer to If-Range is a changed file, the next run starts over. */
+		if resp.StatusCode == http.StatusOK && d.validator != "" {
+			return fmt.Errorf("%w: %s, the file changed, download again", common.ErrStatusCode, resp.Status)
+		}
+		return fmt.Errorf("%w: %s", common.ErrStatusCode, resp.Status)
+	}
+	n, err := io.Copy(f, io.TeeReader(resp.Body, downloadCounter{&d.written}))
+	if err == nil && n != end-start+1-offset {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+/* appendFile appends file to f and removes it. */
+func appendFile(f *os.File, file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+/* rangeHeader merges the Range and If-Range headers into the JSON headers of the config, end < 0 means to the end. */
+func (d *Downloader) rangeHeader(start, end int64) string {
+	header := make(map[string]string)
+	if d.Config.Headers != "" {
+		_ = json.Unmarshal([]byte(d.Config.Headers), &header)
+	}
+	header["Range"] = fmt.Sprintf("bytes=%d-", start)
+	if end >= 0 {
+		header["Range"] += strconv.FormatInt(end, 10)
+	}
+	if d.validator != "" {
+		header["If-Range"] = d.validator
+	}
+	b, _ := json.Marshal(header)
+	return string(b)
+}
+
+func (d *Downloader) printProgress(size int64) {
+	const width = 30
+	written := d.written.Load()
+	if size <= 0 {
+		fmt.Fprintf(os.Stderr, "\r%s", common.ByteSize(written))
+		return
+	}
+	percent := float64(written) / float64(size)
+	done := int(percent * width)
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %3.0f%% %s/%s", strings.Repeat("=", done), strings.Repeat(" ", width-done),
+		percent*100, common.ByteSize(written), common.ByteSize(size))
+}
+
+/* downloadCounter adds the bytes passing through it to n. */
+type downloadCounter struct {
+	n *atomic.Int64
+}
+
+func (c downloadCounter) Write(p []byte) (int, error) {
+	c.n.Add(int64(len(p)))
+	return len(p), nil
+}
@@ -0,0 +1,517 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/miekg/dns"
+	"github.com/spf13/cobra"
+)
+
+func initWatch() *cobra.Command {
+	var flags struct {
+		to    []string
+		once  bool
+		watch Watch
+	}
+	var watchCmd = &cobra.Command{
+		GroupID: getGroupID(CommandWatch),
+		Use:     CommandWatch,
+		Short:   "Run checks on intervals and notify when they flip between OK and FAIL",
+		Run: func(_ *cobra.Command, _ []string) {
+			if rootConfig == "" {
+				logger.Error(common.ErrInvalidFlag.Error(), common.NewField("config", rootConfig))
+				printer.Error(common.ErrInvalidFlag)
+				return
+			}
+			w := &flags.watch
+			var err error
+			if err = ReadConfig(CommandWatch, w); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				return
+			}
+			if err = w.Load(); err != nil {
+				logger.Error(err.Error())
+				printer.Error(err)
+				return
+			}
+			to := flags.to
+			if len(to) == 0 && w.Notify != "" {
+				to = []string{w.Notify}
+			}
+			var failed []NotifyResult
+			w.Notifiers, failed = w.notifiers(to)
+			for _, v := range failed {
+				logger.Error(v.Error, common.NewField("target", v.Target))
+				printer.Error(fmt.Errorf("%s: %s", v.Target, v.Error))
+			}
+
+			if flags.once {
+				results := w.Once(common.Context)
+				w.print(results)
+				var fails int
+				for _, v := range results {
+					if v.Error != "" {
+						fails++
+					}
+				}
+				if fails != 0 {
+					printer.Error(fmt.Errorf("%w: %d of %d checks failed", common.ErrResponse, fails, len(results)))
+				}
+				return
+			}
+			ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+			defer cancel()
+			logger.Info("watching", common.NewField("checks", len(w.Checks)), common.NewField("notify", to))
+			w.Run(ctx)
+		},
+		Example: common.Examples(`# Checks are defined in the watch block of the config, e.g. checks.yaml
+# watch:
+#   notify: oncall          # groups or backends of the notify command
+#   interval: 1m            # default of checks
+#   timeout: 10s            # default of checks
+#   state: /var/lib/ops-cli/watch.json
+#   checks:
+#     - {name: web, type: http, target: https://example.com, status: 200, interval: 30s}
+#     - {name: db, type: tcping, target: db1:5432, threshold: 3}
+#     - {name: gateway, type: ping, target: 10.0.0.1}
+#     - {name: tls, type: cert, target: example.com:443, days: 14, interval: 12h}
+#     - {name: domain, type: whois, target: example.com, days: 30, interval: 24h}
+#     - {name: dns, type: dig, target: example.com, record: A, expect: 93.184.216.34, server: 1.1.1.1}
+# slack:
+#   token: xoxb-...
+#   channel_id: C0123456789
+--config checks.yaml
+
+# Run every check once, e.g. from cron, the state file keeps the last status between runs
+--once --config checks.yaml --output json`, CommandWatch),
+	}
+	watchCmd.Flags().StringSliceVar(&flags.to, "to", nil, common.Usage("Groups or backends to notify, overrides notify of the config"))
+	watchCmd.Flags().BoolVar(&flags.once, "once", false, common.Usage("Run every check once, print the results and exit"))
+	watchCmd.Flags().StringVar(&flags.watch.State, "state", "", common.Usage("File to keep the status of checks across restarts"))
+	flags.watch.NotifyQueue.addFlags(watchCmd)
+	return watchCmd
+}
+
+const (
+	watchStatusOK   = "ok"
+	watchStatusFail = "fail"
+)
+
+/* watchTypes are the probes of checks. */
+var watchTypes = []string{CommandCert, CommandDig, CommandHTTP, CommandPing, CommandTCPing, CommandWhois}
+
+/* Watch is the watch block of the config, durations are strings like 30s. */
+type Watch struct {
+	Notify   string       `json:"notify"`
+	Interval string       `json:"interval"`
+	Timeout  string       `json:"timeout"`
+	State    string       `json:"state"`
+	Checks   []WatchCheck `json:"checks"`
+	NotifyQueue
+
+	/* Notifiers receive the message when a check flips, the flip is only logged if it is empty. */
+	Notifiers map[string]Notifier `json:"-"`
+
+	mu     sync.Mutex
+	states map[string]*WatchState
+}
+
+/* WatchCheck is a probe of Type against Target, fields which do not apply to Type are ignored. */
+type WatchCheck struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Interval string `json:"interval"`
+	Timeout  string `json:"timeout"`
+	/* Threshold is the number of consecutive failures before the check is FAIL, defaults to 1. */
+	Threshold int `json:"threshold"`
+	/* Status is the expected status of http, any status below 400 is OK if it is 0. */
+	Status int `json:"status"`
+	/* Days is the minimum remaining days of cert and whois, defaults to 14. */
+	Days int `json:"days"`
+	/* Record is the query type of dig, defaults to A. */
+	Record string `json:"record"`
+	/* Expect is a record that dig must answer. */
+	Expect string `json:"expect"`
+	/* Server is the DNS server of dig, defaults to the local resolver. */
+	Server string `json:"server"`
+
+	interval, timeout time.Duration
+}
+
+/* WatchState is the status of a check, Since is the time of the last flip. */
+type WatchState struct {
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+	Fails  int       `json:"fails"`
+	Error  string    `json:"error,omitempty"`
+}
+
+/* WatchResult is a run of a check, times are in milliseconds. */
+type WatchResult struct {
+	Name   string  `json:"name" yaml:"name"`
+	Type   string  `json:"type" yaml:"type"`
+	Target string  `json:"target" yaml:"target"`
+	Status string  `json:"status" yaml:"status"`
+	Time   float64 `json:"time_ms" yaml:"time_ms"`
+	Error  string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+/* Load validates checks, fills defaults and reads the state file. */
+func (w *Watch) Load() error {
+	interval, timeout, err := watchDurations(w.Interval, w.Timeout, time.Minute, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if len(w.Checks) == 0 {
+		logger.Debug(common.ErrConfigContent.Error(), common.NewField("checks", w.Checks))
+		return fmt.Errorf("%w: no checks", common.ErrConfigContent)
+	}
+	var names []string
+	for i := range w.Checks {
+		c := &w.Checks[i]
+		c.Type = strings.ToLower(c.Type)
+		if !slices.Contains(watchTypes, c.Type) || c.Target == "" {
+			logger.Debug(common.ErrInvalidArg.Error(), common.NewField("type", c.Type), common.NewField("target", c.Target))
+			return fmt.Errorf("%w: check %d needs a target and a type of %s", common.ErrInvalidArg, i+1, strings.Join(watchTypes, "/"))
+		}
+		if c.Name == "" {
+			c.Name = c.Type + " " + c.Target
+		}
+		if slices.Contains(names, c.Name) {
+			return fmt.Errorf("%w: duplicate check %s", common.ErrInvalidArg, c.Name)
+		}
+		names = append(names, c.Name)
+		if c.interval, c.timeout, err = watchDurations(c.Interval, c.Timeout, interval, timeout); err != nil {
+			return fmt.Errorf("%w: %s", err, c.Name)
+		}
+		if c.Threshold <= 0 {
+			c.Threshold = 1
+		}
+		switch c.Type {
+		case CommandCert, CommandWhois:
+			if c.Days == 0 {
+				c.Days = 14
+			}
+		case CommandDig:
+			if c.Record == "" {
+				c.Record = "A"
+			}
+			if _, ok := dns.StringToType[strings.ToUpper(c.Record)]; !ok {
+				return fmt.Errorf("%w: record %s of %s", common.ErrInvalidArg, c.Record, c.Name)
+			}
+		case CommandTCPing:
+			if _, _, err = net.SplitHostPort(c.Target); err != nil {
+				return fmt.Errorf("%w: %s", err, c.Name)
+			}
+		}
+	}
+
+	w.states = make(map[string]*WatchState)
+	if w.State == "" {
+		return nil
+	}
+	b, err := os.ReadFile(w.State)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		logger.Debug(err.Error(), common.DefaultField(w.State))
+		return err
+	}
+	if err = json.Unmarshal(b, &w.states); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(w.State))
+		return fmt.Errorf("%w: %s", common.ErrInvalidFile, w.State)
+	}
+	return nil
+}
+
+func watchDurations(interval, timeout string, defaultInterval, defaultTimeout time.Duration) (time.Duration, time.Duration, error) {
+	var err error
+	i, t := defaultInterval, defaultTimeout
+	if interval != "" {
+		if i, err = time.ParseDuration(interval); err != nil || i <= 0 {
+			logger.Debug(common.ErrInvalidArg.Error(), common.NewField("interval", interval))
+			return 0, 0, fmt.Errorf("%w: interval %s", common.ErrInvalidArg, interval)
+		}
+	}
+	if timeout != "" {
+		if t, err = time.ParseDuration(timeout); err != nil || t <= 0 {
+			logger.Debug(common.ErrInvalidArg.Error(), common.NewField("timeout", timeout))
+			return 0, 0, fmt.Errorf("%w: timeout %s", common.ErrInvalidArg, timeout)
+		}
+	}
+	return i, t, nil
+}
+
+/* Run runs every check on its interval until ctx is done, the first run is immediate. */
+func (w *Watch) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range w.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(c.interval)
+			defer ticker.Stop()
+			for {
+				if _, msg := w.run(ctx, c); msg != "" {
+					printer.Printf("%s %s\n", time.Now().Format(time.RFC3339), msg)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+/* Once runs every check concurrently once, results are in the order of checks. */
+func (w *Watch) Once(ctx context.Context) []WatchResult {
+	var wg sync.WaitGroup
+	results := make([]WatchResult, len(w.Checks))
+	for i, c := range w.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = w.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+/* run checks c and alerts if it flips, the message is returned. */
+func (w *Watch) run(ctx context.Context, c WatchCheck) (WatchResult, string) {
+	result := w.Check(ctx, c)
+	/* Interrupted checks are not failures of the target. */
+	if ctx.Err() != nil {
+		return result, ""
+	}
+	logger.Debug(result.Status, common.NewField("check", result.Name), common.NewField("error", result.Error))
+	msg := w.update(c, result)
+	if msg != "" {
+		w.alert(msg)
+	}
+	return result, msg
+}
+
+/* Check runs the probe of c, the failure is recorded in the result instead of being returned. */
+func (w *Watch) Check(ctx context.Context, c WatchCheck) WatchResult {
+	result := WatchResult{Name: c.Name, Type: c.Type, Target: c.Target, Status: watchStatusOK}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.probe(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timeout after %s", c.timeout)
+	}
+	result.Time = float64(time.Since(startTime).Microseconds()) / 1000
+	if err != nil {
+		result.Status, result.Error = watchStatusFail, err.Error()
+	}
+	return result
+}
+
+func (c WatchCheck) probe(ctx context.Context) error {
+	switch c.Type {
+	case CommandCert:
+		host := c.Target
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "443")
+		}
+		cert, err := new(Cert).CheckHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		if cert.Days < c.Days {
+			return fmt.Errorf("%w: certificate expires in %d days", common.ErrResponse, cert.Days)
+		}
+	case CommandDig:
+		record := strings.ToUpper(c.Record)
+		answers, err := new(DigList).Request(ctx, dns.StringToType[record], c.Target, UDP, c.Server)
+		if err != nil {
+			return err
+		}
+		if len(answers) == 0 {
+			return fmt.Errorf("%w: no %s record", common.ErrResponse, record)
+		}
+		if c.Expect == "" {
+			return nil
+		}
+		for _, v := range answers {
+			if strings.TrimSuffix(strings.TrimSpace(v.Record), ".") == strings.TrimSuffix(c.Expect, ".") {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s record %s not found", common.ErrResponse, record, c.Expect)
+	case CommandHTTP:
+		p := HTTPProbe{Config: common.HTTPConfig{Method: http.MethodGet, Timeout: c.timeout}, MaxRedirects: 10}
+		results, err := p.Probe(ctx, c.Target)
+		if err != nil {
+			return err
+		}
+		status := results[len(results)-1].Status
+		if (c.Status != 0 && status != c.Status) || (c.Status == 0 && status >= http.StatusBadRequest) {
+			return fmt.Errorf("%w: status %d", common.ErrResponse, status)
+		}
+	case CommandPing:
+		p := Ping{IPv6: strings.Contains(c.Target, ":"), TTL: 64, Timeout: c.timeout}
+		conn, err := p.Listen()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		p.Conn = conn
+		_, err = p.Echo(c.Target)
+		return err
+	case CommandTCPing:
+		host, port, _ := net.SplitHostPort(c.Target)
+		t := TCPing{Protocal: TCP, Timeout: c.timeout}
+		if p := t.Probe(0, host, port); p.Error != "" {
+			return errors.New(p.Error)
+		}
+	case CommandWhois:
+		var w Whois
+		if err := w.Request(ctx, c.Target); err != nil {
+			return err
+		}
+		if w.ExpiresDate == "" {
+			return fmt.Errorf("%w: no expiry date", common.ErrResponse)
+		}
+		if w.RemainDays < c.Days {
+			return fmt.Errorf("%w: domain expires in %d days", common.ErrResponse, w.RemainDays)
+		}
+	}
+	return nil
+}
+
+/* update counts the result into the state of c and returns the message if the check flips. */
+func (w *Watch) update(c WatchCheck, result WatchResult) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	state, ok := w.states[c.Name]
+	if !ok {
+		state = &WatchState{Status: watchStatusOK, Since: now}
+		w.states[c.Name] = state
+	}
+	before := *state
+
+	var msg string
+	switch {
+	case result.Error == "" && state.Status == watchStatusFail:
+		msg = fmt.Sprintf("[OK] %s recovered after %s: %s %s", c.Name, now.Sub(state.Since).Round(time.Second), c.Type, c.Target)
+		*state = WatchState{Status: watchStatusOK, Since: now}
+	case result.Error == "":
+		state.Fails = 0
+	default:
+		state.Fails++
+		if state.Status == watchStatusOK && state.Fails >= c.Threshold {
+			msg = fmt.Sprintf("[FAIL] %s: %s %s: %s", c.Name, c.Type, c.Target, result.Error)
+			state.Status, state.Since, state.Error = watchStatusFail, now, result.Error
+		}
+	}
+	if !ok || *state != before {
+		w.save()
+	}
+	return msg
+}
+
+/* save writes states to the state file, the caller holds the lock. */
+func (w *Watch) save() {
+	if w.State == "" {
+		return
+	}
+	b, err := json.MarshalIndent(w.states, "", IndentTwoSpaces)
+	if err != nil {
+		logger.Debug(err.Error())
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(w.State), 0o700); err != nil {
+		logger.Warn(err.Error(), common.DefaultField(w.State))
+		return
+	}
+	temp := w.State + ".tmp"
+	if err = os.WriteFile(temp, b, 0o600); err == nil {
+		err = os.Rename(temp, w.State)
+	}
+	if err != nil {
+		logger.Warn(err.Error(), common.DefaultField(w.State))
+	}
+}
+
+/* alert logs msg and sends it to Notifiers as plain text, the format of backends could reject the quoted errors. */
+func (w *Watch) alert(msg string) {
+	logger.Warn(msg)
+	for _, v := range Notify(w.Notifiers, notifyKindPlain, msg) {
+		if v.Error != "" {
+			logger.Error(v.Error, common.NewField("target", v.Target))
+		}
+	}
+}
+
+/* States returns a copy of the status of checks. */
+func (w *Watch) States() map[string]WatchState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	states := make(map[string]WatchState, len(w.states))
+	for k, v := range w.states {
+		states[k] = *v
+	}
+	return states
+}
+
+func (w *Watch) print(results []WatchResult) {
+	if !printer.IsTableFormat(rootOutputFormat) {
+		printer.Printf(rootOutputFormat, results)
+		return
+	}
+	header := []string{"Name", "Type", "Target", "Status", "Time", "Error"}
+	var data [][]string
+	for _, v := range results {
+		data = append(data, []string{v.Name, v.Type, v.Target, v.Status, strconv.FormatFloat(v.Time, 'f', 1, 64) + "ms", v.Error})
+	}
+	/* tablewriter.ALIGN_LEFT */
+	printer.SetTableAlign(3)
+	printer.SetTablePadding(IndentTwoSpaces)
+	printer.Printf(printer.SetTableAsDefaultFormat(rootOutputFormat), header, data)
+}
@@ -0,0 +1,230 @@
+/*
+Copyright © 2022 ZeYanLin <zeyanlin@outlook.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+func initWebhook() *cobra.Command {
+	var flags struct {
+		Webhook
+		NotifyQueue
+		arg string
+	}
+	var webhookCmd = &cobra.Command{
+		GroupID: getGroupID(CommandWebhook),
+		Use:     CommandWebhook,
+		Short:   "Send message to a generic webhook",
+		RunE:    func(cmd *cobra.Command, _ []string) error { return cmd.Help() },
+
+		DisableFlagsInUseLine: true,
+	}
+
+	setup := func() error {
+		if rootConfig != "" {
+			if err := ReadConfig(CommandWebhook, &flags); err != nil {
+				return err
+			}
+		}
+		return flags.setup()
+	}
+	send := func(entry NotifyOutboxEntry) error { return notifySend(&flags.Webhook, entry.Kind, entry.Arg) }
+
+	run := func(cmd *cobra.Command, _ []string) {
+		if flags.arg == "" {
+			logger.Error(common.ErrInvalidFlag.Error(), common.DefaultField(flags.arg))
+			return
+		}
+		var err error
+		if err = setup(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if cmd.Name() == CommandText {
+			if flags.arg, err = (NotifyMessage{}).Render(flags.arg, os.Stdin); err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
+		if cmd.Name() != CommandText {
+			if !common.IsFile(flags.arg) && !common.IsURL(flags.arg) {
+				logger.Error(common.ErrInvalidFile.Error())
+				return
+			}
+		}
+		entry := NotifyOutboxEntry{Target: CommandWebhook, Kind: cmd.Name(), Arg: flags.arg}
+		if err = flags.Send(entry, func() error { return send(entry) }); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		printer.Printf(printer.SetNoneAsDefaultFormat(rootOutputFormat), flags.Response)
+	}
+
+	var webhookSubCmdFile = &cobra.Command{
+		Use:   CommandFile,
+		Short: "Upload file to webhook as multipart form field file",
+		Run:   run,
+		Example: common.Examples(`# Upload file
+-u https://example.com/upload -a /tmp/report.csv`, CommandWebhook, CommandFile),
+	}
+
+	var webhookSubCmdText = &cobra.Command{
+		Use:   CommandText,
+		Short: "Send text to webhook",
+		Run:   run,
+		Example: common.Examples(`# Send {"text":"Hello World!"}
+-u https://example.com/hook -a "Hello World!"
+
+# Render the body with a template, fields are .Text, .File, .Kind, .Host and .Time
+-u https://example.com/hook -H 'Authorization: Bearer token' --template '{"content":{{json .Text}},"host":{{json .Host}}}' -a "disk full"
+-a "disk full" --template @body.tmpl --config ~/.config.toml`, CommandWebhook, CommandText),
+	}
+
+	webhookCmd.PersistentFlags().StringVarP(&flags.URL, "url", "u", "", common.Usage("Webhook URL (required)"))
+	webhookCmd.PersistentFlags().StringVarP(&flags.Method, "method", "X", http.MethodPost, common.Usage("HTTP method"))
+	webhookCmd.PersistentFlags().StringSliceVarP(&flags.Headers, "header", "H", nil, common.Usage("Request headers, 'K: V' or JSON"))
+	webhookCmd.PersistentFlags().StringVar(&flags.Template, "template", "", common.Usage("Body template or @file in Go text/template"))
+	webhookCmd.PersistentFlags().StringVarP(&flags.arg, "arg", "a", "", common.Usage("Input argument, - reads text from stdin"))
+
+	flags.NotifyQueue.addFlags(webhookCmd)
+
+	webhookCmd.AddCommand(webhookSubCmdFile, flags.NotifyQueue.flushCommand(CommandWebhook, setup, send), webhookSubCmdText)
+	return webhookCmd
+}
+
+/* Webhook sends a templated JSON body, or uploads a multipart form for local files. */
+type Webhook struct {
+	URL      string   `json:"url"`
+	Method   string   `json:"method"`
+	Headers  []string `json:"headers"`
+	Template string   `json:"template"`
+
+	/* Response is the decoded JSON body, or the body as string. */
+	Response any `json:"-"`
+	header   string
+	tmpl     *template.Template
+}
+
+/* WebhookData is passed to the body template. */
+type WebhookData struct {
+	Text string
+	File string
+	/* Kind is text, file or photo. */
+	Kind string
+	Host string
+	Time time.Time
+}
+
+func (w *Webhook) setup() error {
+	if !common.IsURL(w.URL) {
+		logger.Debug(common.ErrInvalidURL.Error(), common.DefaultField(w.URL))
+		return common.ErrInvalidURL
+	}
+	if w.Method == "" {
+		w.Method = http.MethodPost
+	}
+	var err error
+	if w.header, err = parseHeaders(w.Headers); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(w.Headers))
+		return err
+	}
+	text := w.Template
+	if text == "" {
+		text = `{"text":{{json .Text}}}`
+	}
+	if strings.HasPrefix(text, "@") {
+		b, err := os.ReadFile(text[1:])
+		if err != nil {
+			logger.Debug(err.Error(), common.DefaultField(text))
+			return err
+		}
+		text = string(b)
+	}
+	w.tmpl, err = template.New(CommandWebhook).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(text))
+	}
+	return err
+}
+
+func (w *Webhook) Text(msg string) error {
+	return w.send(WebhookData{Text: msg, Kind: CommandText})
+}
+
+/* File uploads a local file as form field file, an URL is sent with the template. */
+func (w *Webhook) File(path string) error {
+	if !common.IsFile(path) {
+		return w.send(WebhookData{Text: path, File: path, Kind: CommandFile})
+	}
+	body, err := notifyRequest(common.HTTPConfig{
+		Method:    w.Method,
+		Headers:   w.header,
+		Multipart: []string{"file=@" + path},
+	}, w.URL)
+	w.Response = webhookResponse(body)
+	return err
+}
+
+func (w *Webhook) Image(path string) error {
+	if !common.IsFile(path) {
+		return w.send(WebhookData{Text: path, File: path, Kind: CommandPhoto})
+	}
+	return w.File(path)
+}
+
+func (w *Webhook) send(data WebhookData) error {
+	data.Host, _ = os.Hostname()
+	data.Time = time.Now()
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, data); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(data))
+		return err
+	}
+	header := map[string]string{"Content-Type": "application/json"}
+	if w.header != "" {
+		if err := json.Unmarshal([]byte(w.header), &header); err != nil {
+			return err
+		}
+	}
+	h, _ := json.Marshal(header)
+	body, err := notifyRequest(common.HTTPConfig{Method: w.Method, RawBody: buf.Bytes(), Headers: string(h)}, w.URL)
+	w.Response = webhookResponse(body)
+	return err
+}
+
+func webhookResponse(body []byte) any {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	return v
+}
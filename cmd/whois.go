@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -43,7 +44,7 @@ func initWhois() *cobra.Command {
 		Short: "List domain name information",
 		Run: func(_ *cobra.Command, args []string) {
 			var w Whois
-			if err := w.Request(args[0]); err != nil {
+			if err := w.Request(common.Context, args[0]); err != nil {
 				logger.Error(err.Error(), common.DefaultField(args))
 				return
 			}
@@ -87,14 +88,18 @@ type Whois struct {
 	NameServers []string `json:"nameServers" yaml:"nameServers"`
 }
 
-func (w *Whois) Request(domain string) error {
-	conn, err := net.Dial("tcp", net.JoinHostPort("whois.verisign-grs.com", "43"))
+/* Request queries the registry of domain, the connection is closed by the deadline of ctx. */
+func (w *Whois) Request(ctx context.Context, domain string) error {
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", net.JoinHostPort("whois.verisign-grs.com", "43"))
 	if err != nil {
 		logger.Debug(err.Error())
 		return err
 	}
-	if conn != nil {
-		defer conn.Close()
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
 	}
 	_, err = conn.Write([]byte(domain + "\n"))
 	if err != nil {
@@ -17,7 +17,16 @@ limitations under the License.
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -26,6 +35,17 @@ import (
 )
 
 func initWsping() *cobra.Command {
+	var flags struct {
+		count       int
+		headers     []string
+		origin      string
+		protocols   []string
+		insecure    bool
+		caCert      string
+		interactive bool
+		interval    time.Duration
+		timeout     time.Duration
+	}
 	var wspingCmd = &cobra.Command{
 		GroupID: getGroupID(CommandWsping),
 		Use:     CommandWsping + " host",
@@ -39,39 +59,281 @@ func initWsping() *cobra.Command {
 				logger.Error(common.ErrInvalidURL.Error(), common.DefaultField(args))
 				return
 			}
-			d := websocket.Dialer{
-				HandshakeTimeout: 2 * time.Second,
-				ReadBufferSize:   1024,
-				WriteBufferSize:  1024,
+			headers, err := parseHeaders(flags.headers)
+			if err != nil {
+				logger.Error(err.Error(), common.DefaultField(flags.headers))
+				printer.Error(err)
+				return
 			}
-
-			ws, resp, err := d.DialContext(common.Context, args[0], nil)
+			w := Wsping{
+				URL:          args[0],
+				Origin:       flags.origin,
+				Subprotocols: flags.protocols,
+				Timeout:      flags.timeout,
+				Config: common.HTTPConfig{
+					Headers:  headers,
+					Insecure: flags.insecure,
+					CACert:   flags.caCert,
+				},
+			}
+			ctx, cancel := signal.NotifyContext(common.Context, os.Interrupt)
+			defer cancel()
+			duration, err := w.Dial(ctx)
 			if err != nil {
 				logger.Error(err.Error())
+				printer.Error(err)
 				return
 			}
-			defer ws.Close()
-			if resp != nil {
-				defer resp.Body.Close()
-			}
-			if resp.StatusCode != http.StatusSwitchingProtocols {
-				printer.Printf("Status is not %d\n", http.StatusSwitchingProtocols)
+			defer w.Close()
+			printer.Printf("Connected to %s (%s) protocol=%q in %v\n", w.URL, w.Conn.RemoteAddr(), w.Conn.Subprotocol(), duration)
+
+			if flags.interactive {
+				if err = w.Interactive(ctx, os.Stdin, os.Stdout); err != nil {
+					logger.Error(err.Error())
+					printer.Error(err)
+				}
 				return
 			}
-			// err = ws.WriteMessage(websocket.PingMessage, []byte{})
-			// if err != nil {
-			// 	return err
-			// }
-			// _, message, err := ws.ReadMessage()
-			// if err != nil {
-			// 	return err
-			// }
-			// message = bytes.TrimSpace(bytes.Replace(message, []byte{'\n'}, []byte{' '}, -1))
-			// if string(message) == "" {
-			// 	return common.ErrResponse
-			// }
-			printer.Printf("Connect success")
+			w.Run(ctx, flags.count, flags.interval)
 		},
+		Example: common.Examples(`# Measure ping/pong round-trip time
+wss://echo.websocket.org -c 5
+
+# Send headers, origin and subprotocols
+wss://example.com/socket -H 'Authorization: Bearer token' --origin https://example.com --protocol graphql-ws
+
+# Send stdin lines and print received frames
+ws://127.0.0.1:8080/ws -I`, CommandWsping),
 	}
+	wspingCmd.Flags().IntVarP(&flags.count, "count", "c", 1, common.Usage("Specify ping counts, -1 means continuous"))
+	wspingCmd.Flags().StringArrayVarP(&flags.headers, "headers", "H", nil, common.Usage("Headers, 'Key: Value' or JSON object, can be repeated"))
+	wspingCmd.Flags().StringVar(&flags.origin, "origin", "", common.Usage("Origin header"))
+	wspingCmd.Flags().StringSliceVar(&flags.protocols, "protocol", nil, common.Usage("Subprotocols to request"))
+	wspingCmd.Flags().BoolVarP(&flags.insecure, "insecure", "k", false, common.Usage("Skip TLS certificate verification"))
+	wspingCmd.Flags().StringVar(&flags.caCert, "cacert", "", common.Usage("CA certificate file to verify the server"))
+	wspingCmd.Flags().BoolVarP(&flags.interactive, "interactive", "I", false, common.Usage("Send stdin lines and print received messages"))
+	wspingCmd.Flags().DurationVarP(&flags.interval, "interval", "i", time.Second, common.Usage("Specify interval"))
+	wspingCmd.Flags().DurationVarP(&flags.timeout, "timeout", "t", 2*time.Second, common.Usage("Specify timeout"))
 	return wspingCmd
 }
+
+type Wsping struct {
+	URL          string
+	Origin       string
+	Subprotocols []string
+	Timeout      time.Duration
+	/* Config provides the headers and TLS options. */
+	Config common.HTTPConfig
+	Conn   *websocket.Conn
+
+	pongs    chan string
+	messages chan wspingMessage
+	done     chan error
+}
+
+type wspingMessage struct {
+	typ  int
+	data []byte
+}
+
+/* Dial opens the connection and starts reading frames, it returns the handshake time. */
+func (w *Wsping) Dial(ctx context.Context) (time.Duration, error) {
+	client, err := w.Config.Client()
+	if err != nil {
+		return 0, err
+	}
+	d := websocket.Dialer{
+		HandshakeTimeout: w.Timeout,
+		ReadBufferSize:   1024,
+		WriteBufferSize:  1024,
+		Subprotocols:     w.Subprotocols,
+	}
+	if t, ok := client.Transport.(*http.Transport); ok {
+		d.Proxy = t.Proxy
+		d.TLSClientConfig = t.TLSClientConfig
+	}
+	header := make(http.Header)
+	if w.Config.Headers != "" {
+		m := make(map[string]string)
+		if err = Encoder.JSONMarshaler(w.Config.Headers, &m); err != nil {
+			return 0, err
+		}
+		for k, v := range m {
+			header.Set(k, v)
+		}
+	}
+	if w.Origin != "" {
+		header.Set("Origin", w.Origin)
+	}
+
+	start := time.Now()
+	ws, resp, err := d.DialContext(ctx, w.URL, header)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		logger.Debug(err.Error(), common.DefaultField(w.URL))
+		if resp != nil {
+			return 0, fmt.Errorf("%w: %s", err, resp.Status)
+		}
+		return 0, err
+	}
+	duration := time.Since(start)
+	w.Conn = ws
+	w.pongs = make(chan string, 1)
+	w.messages = make(chan wspingMessage, 16)
+	w.done = make(chan error, 1)
+	ws.SetPongHandler(func(data string) error {
+		select {
+		case w.pongs <- data:
+		default:
+		}
+		return nil
+	})
+	go func() {
+		for {
+			typ, data, err := ws.ReadMessage()
+			if err != nil {
+				w.done <- err
+				close(w.messages)
+				return
+			}
+			w.messages <- wspingMessage{typ: typ, data: data}
+		}
+	}()
+	return duration, nil
+}
+
+/* Ping sends a ping frame with seq as payload and waits for its pong. */
+func (w *Wsping) Ping(seq int) (time.Duration, error) {
+	payload := strconv.Itoa(seq)
+	start := time.Now()
+	deadline := start.Add(w.Timeout)
+	if err := w.Conn.WriteControl(websocket.PingMessage, []byte(payload), deadline); err != nil {
+		logger.Debug(err.Error(), common.DefaultField(w.URL))
+		return 0, err
+	}
+	timer := time.NewTimer(w.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case data := <-w.pongs:
+			if data == payload {
+				return time.Since(start), nil
+			}
+		case <-w.messages:
+			/* Data frames are not pongs. */
+		case err := <-w.done:
+			w.done <- err
+			return 0, err
+		case <-timer.C:
+			return 0, fmt.Errorf("ping timeout for seq %d", seq)
+		}
+	}
+}
+
+/* Run pings count times, or until ctx is done if count is negative, then prints statistics. */
+func (w *Wsping) Run(ctx context.Context, count int, interval time.Duration) []time.Duration {
+	var rtts []time.Duration
+	var sent int
+	for i := 0; count < 0 || i < count; i++ {
+		if i != 0 {
+			select {
+			case <-ctx.Done():
+				w.summary(sent, rtts)
+				return rtts
+			case <-time.After(interval):
+			}
+		}
+		sent++
+		rtt, err := w.Ping(i)
+		if err != nil {
+			printer.Printf("seq %d: %s\n", i, err)
+			continue
+		}
+		rtts = append(rtts, rtt)
+		printer.Printf("seq %d: pong from %s time=%v\n", i, w.URL, rtt)
+	}
+	w.summary(sent, rtts)
+	return rtts
+}
+
+func (w *Wsping) summary(sent int, rtts []time.Duration) {
+	if sent <= 1 {
+		return
+	}
+	out := fmt.Sprintf("\n--- %s wsping statistics ---\n", w.URL)
+	out += fmt.Sprintf("%d pings transmitted, %d pongs received, %.1f%% loss\n",
+		sent, len(rtts), float64(sent-len(rtts))*100/float64(sent))
+	if len(rtts) != 0 {
+		minRtt, maxRtt, sum := rtts[0], rtts[0], time.Duration(0)
+		for _, v := range rtts {
+			minRtt, maxRtt, sum = min(minRtt, v), max(maxRtt, v), sum+v
+		}
+		avg := sum / time.Duration(len(rtts))
+		var temp float64
+		for _, v := range rtts {
+			temp += math.Pow(float64(v-avg), 2)
+		}
+		out += fmt.Sprintf("round-trip min/avg/max/stddev = %v/%v/%v/%v\n",
+			minRtt, avg, maxRtt, time.Duration(math.Sqrt(temp/float64(len(rtts)))))
+	}
+	printer.Printf("%s", out)
+}
+
+/* Interactive sends every line of in as a text message, and writes received messages to out. */
+func (w *Wsping) Interactive(ctx context.Context, in io.Reader, out io.Writer) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return w.closeMessage()
+		case line, ok := <-lines:
+			if !ok {
+				/* stdin is closed, wait for replies until the server closes or timeout. */
+				if err := w.closeMessage(); err != nil {
+					return err
+				}
+				if err := w.Conn.SetReadDeadline(time.Now().Add(w.Timeout)); err != nil {
+					logger.Debug(err.Error(), common.DefaultField(w.URL))
+					return err
+				}
+				lines = nil
+				continue
+			}
+			if err := w.Conn.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+				logger.Debug(err.Error(), common.DefaultField(w.URL))
+				return err
+			}
+		case msg, ok := <-w.messages:
+			if !ok {
+				err := <-w.done
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return nil
+				}
+				return err
+			}
+			if msg.typ == websocket.BinaryMessage {
+				fmt.Fprintf(out, "%x\n", msg.data)
+				continue
+			}
+			fmt.Fprintf(out, "%s\n", strings.TrimRight(string(msg.data), "\n"))
+		}
+	}
+}
+
+func (w *Wsping) closeMessage() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	return w.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(w.Timeout))
+}
+
+func (w *Wsping) Close() error {
+	return w.Conn.Close()
+}
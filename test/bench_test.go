@@ -0,0 +1,102 @@
+package test_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBench(t *testing.T) {
+	var count atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1)%10 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+		_, _ = w.Write([]byte(r.Method))
+	}))
+	defer server.Close()
+
+	b := cmd.Bench{Concurrency: 4, Requests: 100}
+	b.Config.Method = http.MethodPost
+	result, err := b.Run(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), result.Requests)
+	assert.Equal(t, int64(0), result.Errors)
+	assert.Equal(t, map[string]int64{"200": 90, "500": 10}, result.Status)
+	l := result.Latency
+	assert.LessOrEqual(t, l.Min, l.P50)
+	assert.LessOrEqual(t, l.P50, l.P90)
+	assert.LessOrEqual(t, l.P90, l.P99)
+	assert.LessOrEqual(t, l.P99, l.Max)
+	assert.GreaterOrEqual(t, l.P50, 2.0)
+
+	b = cmd.Bench{Concurrency: 2, Requests: 10, QPS: 50}
+	start := time.Now()
+	result, err = b.Run(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), result.Requests)
+	assert.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+
+	b = cmd.Bench{Concurrency: 2, Duration: 200 * time.Millisecond}
+	result, err = b.Run(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Greater(t, result.Requests, int64(0))
+	assert.InDelta(t, 0.2, result.Duration, 0.1)
+
+	b = cmd.Bench{Concurrency: 1, Requests: 2}
+	result, err = b.Run(context.Background(), "http://127.0.0.1:1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Errors)
+
+	b = cmd.Bench{Requests: 1}
+	_, err = b.Run(context.Background(), server.URL)
+	assert.NotNil(t, err)
+}
+
+/* TestBenchBody sends the body of @file and @- with every request, not only with the first one. */
+func TestBenchBody(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[string(b)]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "body.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"a":1}`), 0o600))
+
+	for _, v := range []struct {
+		data, stdin string
+	}{{"@" + file, ""}, {"@-", `{"b":2}`}} {
+		mu.Lock()
+		bodies = make(map[string]int)
+		mu.Unlock()
+		command := exec.Command(binaryCommand, cmd.CommandBench, server.URL, "-m", http.MethodPost, "-d", v.data, "-n", "20", "-c", "4", "--output", "json")
+		command.Stdin = strings.NewReader(v.stdin)
+		out, err := command.Output()
+		assert.Nil(t, err, string(out))
+		expected := v.stdin
+		if expected == "" {
+			expected = `{"a":1}`
+		}
+		mu.Lock()
+		assert.Equal(t, map[string]int{expected: 20}, bodies)
+		mu.Unlock()
+	}
+}
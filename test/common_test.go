@@ -1,6 +1,8 @@
 package test_test
 
 import (
+	"io"
+	"os"
 	"testing"
 
 	"github.com/linzeyan/ops-cli/cmd/common"
@@ -69,3 +71,33 @@ func FuzzCommonBytes(t *testing.F) {
 		}
 	})
 }
+
+func TestCommonPrinterTableFormats(t *testing.T) {
+	header := []string{"Host", "Loss%"}
+	data := [][]string{{"1. 10.0.0.1", "0.0%"}, {"2. a|b", "10.0%"}}
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{common.CSVFormat, "Host,Loss%\n1. 10.0.0.1,0.0%\n2. a|b,10.0%\n"},
+		{common.MarkdownFormat, "| Host | Loss% |\n|---|---|\n| 1. 10.0.0.1 | 0.0% |\n| 2. a\\|b | 10.0% |\n"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.format, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout := os.Stdout
+			os.Stdout = w
+			common.NewPrinter().Printf(testCase.format, header, data)
+			os.Stdout = stdout
+			w.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testCase.expected, string(got))
+		})
+	}
+}
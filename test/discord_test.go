@@ -1,10 +1,19 @@
 package test_test
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os/exec"
 	"testing"
+	"time"
 
+	"github.com/bwmarrin/discordgo"
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestDiscordBinary(t *testing.T) {
@@ -15,3 +24,109 @@ func TestDiscordBinary(t *testing.T) {
 		}
 	})
 }
+
+/* discordRequest is a request received by fakeDiscordAPI. */
+type discordRequest struct {
+	method, path string
+	body         map[string]any
+}
+
+/* discordTransport sends the requests of discordgo to a test server. */
+type discordTransport struct{ url *url.URL }
+
+func (d discordTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = d.url.Scheme, d.url.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+/* fakeDiscordAPI returns a session of a REST API which answers every request with message m1. */
+func fakeDiscordAPI(t *testing.T) (*discordgo.Session, chan discordRequest) {
+	t.Helper()
+	requests := make(chan discordRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := discordRequest{method: r.Method, path: r.URL.Path}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &req.body)
+		requests <- req
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"m1","channel_id":"c1"}`))
+	}))
+	t.Cleanup(server.Close)
+	session, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(server.URL)
+	session.Client = &http.Client{Transport: discordTransport{url: u}}
+	return session, requests
+}
+
+func TestDiscordThread(t *testing.T) {
+	session, requests := fakeDiscordAPI(t)
+	d := cmd.Discord{API: session}
+
+	assert.Nil(t, d.Text("c1", "backup started"))
+	req := <-requests
+	assert.Equal(t, http.MethodPost, req.method)
+	assert.Equal(t, "/api/v"+discordgo.APIVersion+"/channels/c1/messages", req.path)
+
+	/* A thread takes the place of the channel. */
+	d.Thread = "t1"
+	assert.Nil(t, d.Text("c1", "backup started"))
+	req = <-requests
+	assert.Equal(t, "/api/v"+discordgo.APIVersion+"/channels/t1/messages", req.path)
+	assert.Equal(t, "backup started", req.body["content"])
+	assert.Equal(t, cmd.NotifySent{ID: "m1", Channel: "c1", Thread: "t1"}, d.Sent())
+
+	assert.Nil(t, d.Edit("c1", "m1", "backup finished"))
+	req = <-requests
+	assert.Equal(t, http.MethodPatch, req.method)
+	assert.Equal(t, "/api/v"+discordgo.APIVersion+"/channels/t1/messages/m1", req.path)
+	assert.Equal(t, "backup finished", req.body["content"])
+
+	/* A color turns the edit into an embed. */
+	d.Thread, d.Color = "", "danger"
+	assert.Nil(t, d.Edit("c1", "m1", "backup failed"))
+	req = <-requests
+	assert.Equal(t, "/api/v"+discordgo.APIVersion+"/channels/c1/messages/m1", req.path)
+	embeds, _ := req.body["embeds"].([]any)
+	assert.Len(t, embeds, 1)
+	assert.Equal(t, "backup failed", embeds[0].(map[string]any)["description"])
+
+	d.Format = "html"
+	assert.NotNil(t, d.Edit("c1", "m1", "backup failed"))
+	assert.Empty(t, requests)
+}
+
+func TestDiscordBot(t *testing.T) {
+	session, requests := fakeDiscordAPI(t)
+	bot := cmd.DiscordBot{
+		ChatOps: cmd.ChatOps{Commands: []string{cmd.CommandVersion}, Binary: binaryCommand},
+		API:     session,
+		Allow:   []string{"c1"},
+	}
+	message := func(channel, content string, isBot bool) *discordgo.Message {
+		return &discordgo.Message{ID: "m0", ChannelID: channel, Content: content, Author: &discordgo.User{Username: "oncall", Bot: isBot}}
+	}
+	ctx := context.Background()
+
+	/* Other channels, bots and messages without the prefix are ignored. */
+	bot.Handle(ctx, message("c2", "!version", false))
+	bot.Handle(ctx, message("c1", "!version", true))
+	bot.Handle(ctx, message("c1", "version", false))
+	assert.Empty(t, requests)
+
+	bot.Handle(ctx, message("c1", "!version", false))
+	select {
+	case req := <-requests:
+		assert.Equal(t, "/api/v"+discordgo.APIVersion+"/channels/c1/messages", req.path)
+		assert.Contains(t, req.body["content"], "Copyright © 2022 ZeYanLin")
+		assert.Equal(t, "m0", req.body["message_reference"].(map[string]any)["message_id"])
+	case <-time.After(30 * time.Second):
+		t.Fatal("no reply from bot")
+	}
+
+	assert.Contains(t, bot.Dispatch(ctx, "rm", []string{"-rf", "/"}), "unknown command rm")
+	assert.Contains(t, bot.Dispatch(ctx, "help", nil), "!version args")
+}
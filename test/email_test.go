@@ -0,0 +1,139 @@
+package test_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+/* smtpMail is a message received by smtpStub. */
+type smtpMail struct {
+	auth, from string
+	to         []string
+	data       string
+}
+
+/* smtpStub accepts one mail per connection, AUTH PLAIN is offered without STARTTLS. */
+func smtpStub(t *testing.T) (string, <-chan smtpMail) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	mails := make(chan smtpMail, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+				var mail smtpMail
+				reply("220 localhost ESMTP")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					verb, arg, _ := strings.Cut(line, " ")
+					switch strings.ToUpper(verb) {
+					case "EHLO":
+						reply("250-localhost")
+						reply("250 AUTH PLAIN")
+					case "AUTH":
+						_, encoded, _ := strings.Cut(arg, " ")
+						b, _ := base64.StdEncoding.DecodeString(encoded)
+						mail.auth = string(b)
+						reply("235 2.7.0 Authentication successful")
+					case "MAIL":
+						mail.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+						reply("250 OK")
+					case "RCPT":
+						mail.to = append(mail.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+						reply("250 OK")
+					case "DATA":
+						reply("354 End data with <CR><LF>.<CR><LF>")
+						var data strings.Builder
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil || line == ".\r\n" {
+								break
+							}
+							data.WriteString(line)
+						}
+						mail.data = data.String()
+						mails <- mail
+						reply("250 OK")
+					case "QUIT":
+						reply("221 Bye")
+						return
+					default:
+						reply("250 OK")
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), mails
+}
+
+func TestEmail(t *testing.T) {
+	addr, mails := smtpStub(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	/* The stub offers no STARTTLS, which is an error unless opportunistic. */
+	out, err := exec.Command(binaryCommand, cmd.CommandEmail, cmd.CommandText, "--host", host, "-p", port,
+		"--to", "ops@example.com", "-a", "disk full", "--retry", "0").CombinedOutput()
+	assert.Contains(t, string(out), "does not offer STARTTLS", err)
+	select {
+	case <-mails:
+		t.Fatal("mail was sent in plaintext")
+	default:
+	}
+
+	out, err = exec.Command(binaryCommand, cmd.CommandEmail, cmd.CommandText, "--host", host, "-p", port, "--tls", "opportunistic",
+		"--user", "bot@example.com", "--auth", "secret", "--to", "ops@example.com,dev@example.com",
+		"-a", "disk full on db1\nusage 91%").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	mail := <-mails
+	assert.Equal(t, "\x00bot@example.com\x00secret", mail.auth)
+	assert.Equal(t, "bot@example.com", mail.from)
+	assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, mail.to)
+	assert.Contains(t, mail.data, "Subject: disk full on db1\r\n")
+	assert.Contains(t, mail.data, "To: ops@example.com, dev@example.com\r\n")
+	assert.Contains(t, mail.data, "usage 91%")
+
+	file := filepath.Join(t.TempDir(), "report.csv")
+	assert.Nil(t, os.WriteFile(file, []byte("a,b\n1,2\n"), 0o600))
+	out, err = exec.Command(binaryCommand, cmd.CommandEmail, cmd.CommandFile, "--host", host, "-p", port,
+		"--from", "bot@example.com", "--to", "ops@example.com", "-s", "Daily report", "-a", file, "--tls", "none").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	mail = <-mails
+	assert.Equal(t, "", mail.auth)
+	assert.Contains(t, mail.data, "Subject: Daily report\r\n")
+	assert.Contains(t, mail.data, "Content-Type: multipart/mixed; boundary=")
+	assert.Contains(t, mail.data, `Content-Disposition: attachment; filename=report.csv`)
+	assert.Contains(t, mail.data, base64.StdEncoding.EncodeToString([]byte("a,b\n1,2\n")))
+
+	command := exec.Command(binaryCommand, cmd.CommandEmail, cmd.CommandText, "--host", host, "-p", port,
+		"--from", "bot@example.com", "--to", "ops@example.com", "-s", "Report", "--format", "html", "-a", "-", "--tls", "none")
+	command.Stdin = strings.NewReader("<h1>disk full</h1>\n")
+	out, err = command.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	mail = <-mails
+	assert.Contains(t, mail.data, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, mail.data, "<h1>disk full</h1>")
+}
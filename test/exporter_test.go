@@ -0,0 +1,100 @@
+package test_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporter(t *testing.T) {
+	server := httptest.NewServer(&cmd.Exporter{Timeout: 2 * time.Second})
+	defer server.Close()
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusOK && path != "/" {
+			assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+		}
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := get("/metrics")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "# TYPE node_cpu_seconds_total counter\n")
+	assert.Contains(t, body, `node_scrape_collector_success{collector="meminfo"} 1`)
+	assert.Contains(t, body, "# TYPE node_memory_MemTotal_bytes gauge\n")
+	assert.Equal(t, 1, strings.Count(body, "# HELP node_cpu_seconds_total "))
+	/* Every series is written once, even for bind mounts. */
+	series := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := line[:strings.LastIndex(line, " ")]
+		assert.False(t, series[name], name)
+		series[name] = true
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	status, body = get("/probe?module=tcp&target=" + l.Addr().String())
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "probe_success 1\n")
+	assert.Contains(t, body, "probe_tcp_duration_seconds ")
+
+	_, body = get("/probe?module=tcp&target=" + closedAddr(t))
+	assert.Contains(t, body, "probe_success 0\n")
+	assert.Contains(t, body, "probe_duration_seconds ")
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/ok", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer site.Close()
+	_, body = get("/probe?module=http&target=" + url.QueryEscape(site.URL))
+	assert.Contains(t, body, "probe_success 1\n")
+	assert.Contains(t, body, "probe_http_status_code 200\n")
+	assert.Contains(t, body, "probe_http_redirects 1\n")
+	assert.Contains(t, body, "probe_http_ssl 0\n")
+	assert.Contains(t, body, `probe_http_duration_seconds{phase="connect"} `)
+
+	status, _ = get("/probe?module=ftp&target=example.com")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = get("/probe?module=tcp")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = get("/nothing")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestExporterMetrics(t *testing.T) {
+	var m cmd.ExporterMetrics
+	m.Add("up", "Up.", "gauge", 1)
+	m.Add("errors_total", "Errors.", "counter", 2, "path", `C:\tmp "a"`)
+	m.Add("up", "Up.", "gauge", 0.5, "job", "b")
+	assert.Equal(t, `# HELP up Up.
+# TYPE up gauge
+up 1
+up{job="b"} 0.5
+# HELP errors_total Errors.
+# TYPE errors_total counter
+errors_total{path="C:\\tmp \"a\""} 2
+`, string(m.Bytes()))
+}
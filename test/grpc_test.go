@@ -0,0 +1,271 @@
+package test_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/stretchr/testify/assert"
+)
+
+/* grpcTestFiles returns test.proto and its dependency common.proto as serialized FileDescriptorProto. */
+func grpcTestFiles() (test, dep []byte) {
+	str := func(b []byte, n int, s string) []byte { return common.ProtoAppendBytes(b, n, []byte(s)) }
+	field := func(name string, number, label, typ int, typeName string) []byte {
+		f := str(nil, 1, name)
+		f = common.ProtoAppendVarint(f, 3, uint64(number))
+		f = common.ProtoAppendVarint(f, 4, uint64(label))
+		f = common.ProtoAppendVarint(f, 5, uint64(typ))
+		if typeName != "" {
+			f = str(f, 6, typeName)
+		}
+		return f
+	}
+	value := func(name string, number int) []byte {
+		return common.ProtoAppendVarint(str(nil, 1, name), 2, uint64(number))
+	}
+
+	mood := str(nil, 1, "Mood")
+	mood = common.ProtoAppendBytes(mood, 2, value("UNKNOWN", 0))
+	mood = common.ProtoAppendBytes(mood, 2, value("HAPPY", 1))
+	dep = str(nil, 1, "common.proto")
+	dep = str(dep, 2, "test")
+	dep = common.ProtoAppendBytes(dep, 5, mood)
+
+	entry := str(nil, 1, "ScoresEntry")
+	entry = common.ProtoAppendBytes(entry, 2, field("key", 1, 1, 9, ""))
+	entry = common.ProtoAppendBytes(entry, 2, field("value", 2, 1, 3, ""))
+	entry = common.ProtoAppendBytes(entry, 7, common.ProtoAppendVarint(nil, 7, 1))
+	request := str(nil, 1, "HelloRequest")
+	request = common.ProtoAppendBytes(request, 2, field("name", 1, 1, 9, ""))
+	request = common.ProtoAppendBytes(request, 2, field("count", 2, 1, 5, ""))
+	request = common.ProtoAppendBytes(request, 2, field("tags", 3, 3, 9, ""))
+	request = common.ProtoAppendBytes(request, 2, field("scores", 4, 3, 11, ".test.HelloRequest.ScoresEntry"))
+	request = common.ProtoAppendBytes(request, 3, entry)
+	reply := str(nil, 1, "HelloReply")
+	reply = common.ProtoAppendBytes(reply, 2, field("messages", 1, 3, 9, ""))
+	reply = common.ProtoAppendBytes(reply, 2, field("mood", 2, 1, 14, ".test.Mood"))
+	reply = common.ProtoAppendBytes(reply, 2, field("total_score", 3, 1, 3, ""))
+
+	method := str(nil, 1, "SayHello")
+	method = str(method, 2, ".test.HelloRequest")
+	method = str(method, 3, ".test.HelloReply")
+	service := str(nil, 1, "Greeter")
+	service = common.ProtoAppendBytes(service, 2, method)
+
+	test = str(nil, 1, "test.proto")
+	test = str(test, 2, "test")
+	test = str(test, 3, "common.proto")
+	test = common.ProtoAppendBytes(test, 4, request)
+	test = common.ProtoAppendBytes(test, 4, reply)
+	test = common.ProtoAppendBytes(test, 6, service)
+	return test, dep
+}
+
+func grpcTestServer(t *testing.T, tls bool) *httptest.Server {
+	test, dep := grpcTestFiles()
+	handler := func(path string, req []common.ProtoField) ([]byte, int) {
+		switch path {
+		case "/grpc.health.v1.Health/Check":
+			if len(req) == 0 || string(req[0].Bytes) == "test.Greeter" {
+				return common.ProtoAppendVarint(nil, 1, 1), 0
+			}
+			return nil, 5
+		case "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo":
+			switch req[0].Number {
+			case 7:
+				var list []byte
+				for _, v := range []string{"test.Greeter", "grpc.health.v1.Health"} {
+					list = common.ProtoAppendBytes(list, 1, common.ProtoAppendBytes(nil, 1, []byte(v)))
+				}
+				return common.ProtoAppendBytes(nil, 6, list), 0
+			case 3:
+				return common.ProtoAppendBytes(nil, 4, common.ProtoAppendBytes(nil, 1, dep)), 0
+			case 4:
+				if !strings.HasPrefix(string(req[0].Bytes), "test.") {
+					e := common.ProtoAppendVarint(nil, 1, 5)
+					return common.ProtoAppendBytes(nil, 7, common.ProtoAppendBytes(e, 2, []byte("symbol not found"))), 0
+				}
+				return common.ProtoAppendBytes(nil, 4, common.ProtoAppendBytes(nil, 1, test)), 0
+			}
+		case "/test.Greeter/SayHello":
+			var name string
+			var count, total uint64
+			var reply []byte
+			for _, v := range req {
+				switch v.Number {
+				case 1:
+					name = string(v.Bytes)
+				case 2:
+					count = v.Varint
+				case 3:
+					reply = common.ProtoAppendBytes(reply, 1, v.Bytes)
+				case 4:
+					entry, _ := common.ProtoDecode(v.Bytes)
+					total += entry[1].Varint
+				}
+			}
+			for range count {
+				reply = common.ProtoAppendBytes(reply, 1, []byte("hello "+name))
+			}
+			reply = common.ProtoAppendVarint(reply, 2, 1)
+			return common.ProtoAppendVarint(reply, 3, total), 0
+		}
+		return nil, 12
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HTTP/2.0", r.Proto)
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		var req []common.ProtoField
+		if len(body) >= 5 {
+			req, _ = common.ProtoDecode(body[5:])
+		}
+		reply, code := handler(r.URL.Path, req)
+		if code == 0 {
+			var frame bytes.Buffer
+			frame.WriteByte(0)
+			_ = binary.Write(&frame, binary.BigEndian, uint32(len(reply)))
+			frame.Write(reply)
+			_, _ = w.Write(frame.Bytes())
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", "not%20found")
+	}))
+	if tls {
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		return server
+	}
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	return server
+}
+
+func TestGRPC(t *testing.T) {
+	server := grpcTestServer(t, false)
+	defer server.Close()
+	g := cmd.GRPC{
+		Target: strings.TrimPrefix(server.URL, "http://"),
+		Config: common.HTTPConfig{Headers: `{"X-Token":"secret"}`},
+	}
+	ctx := context.Background()
+
+	health, err := g.Health(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "SERVING", health.Status)
+	_, err = g.Health(ctx, "unknown")
+	assert.EqualError(t, err, "rpc error: code = NotFound desc = not found")
+
+	services, err := g.ListServices(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"grpc.health.v1.Health", "test.Greeter"}, services)
+	methods, err := g.ListMethods(ctx, "test.Greeter")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test.Greeter.SayHello"}, methods)
+
+	_, text, err := g.Describe(ctx, "test.Greeter")
+	assert.Nil(t, err)
+	assert.Equal(t, "service test.Greeter {\n  rpc SayHello(test.HelloRequest) returns (test.HelloReply);\n}\n", text)
+	_, text, err = g.Describe(ctx, "test.HelloRequest")
+	assert.Nil(t, err)
+	assert.Contains(t, text, "repeated test.HelloRequest.ScoresEntry scores = 4;")
+	_, text, err = g.Describe(ctx, "test.Mood")
+	assert.Nil(t, err)
+	assert.Contains(t, text, "HAPPY = 1;")
+	_, _, err = g.Describe(ctx, "unknown.Symbol")
+	assert.NotNil(t, err)
+
+	result, err := g.Call(ctx, "test.Greeter/SayHello",
+		strings.NewReader(`{"name":"ops","count":2,"tags":["a"],"scores":{"x":3,"y":"4"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]any{{
+		"messages":   []any{"a", "hello ops", "hello ops"},
+		"mood":       "HAPPY",
+		"totalScore": "7",
+	}}, result)
+	_, err = g.Call(ctx, "test.Greeter/SayHello", strings.NewReader(`{"unknown":1}`))
+	assert.NotNil(t, err)
+	_, err = g.Call(ctx, "test.Greeter/Missing", strings.NewReader(""))
+	assert.NotNil(t, err)
+}
+
+func TestGRPCTLS(t *testing.T) {
+	server := grpcTestServer(t, true)
+	defer server.Close()
+	g := cmd.GRPC{
+		Target: strings.TrimPrefix(server.URL, "https://"),
+		Config: common.HTTPConfig{Headers: `{"X-Token":"secret"}`, Insecure: true},
+	}
+	health, err := g.Health(context.Background(), "test.Greeter")
+	assert.Nil(t, err)
+	assert.Equal(t, "SERVING", health.Status)
+}
+
+/* TestGRPCGolden checks the length-prefixed frames of grpc.health.v1.Health/Check against known bytes. */
+func TestGRPCGolden(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		/* Uncompressed, length 2, status: SERVING. */
+		_, _ = w.Write([]byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	g := cmd.GRPC{Target: strings.TrimPrefix(server.URL, "http://")}
+	health, err := g.Health(context.Background(), "test.Greeter")
+	assert.Nil(t, err)
+	assert.Equal(t, "SERVING", health.Status)
+	assert.Equal(t, "000000000e0a0c746573742e47726565746572", hex.EncodeToString(<-bodies))
+
+	/* An empty request is a frame of length 0. */
+	_, err = g.Health(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, "0000000000", hex.EncodeToString(<-bodies))
+}
+
+/* TestGRPCMaxRecvSize rejects a frame longer than the limit before reading it. */
+func TestGRPCMaxRecvSize(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		/* Uncompressed, length 0xffffffff, and no message. */
+		_, _ = w.Write([]byte{0x00, 0xff, 0xff, 0xff, 0xff})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	g := cmd.GRPC{Target: strings.TrimPrefix(server.URL, "http://")}
+	_, err := g.Invoke(context.Background(), "/test.Greeter/SayHello", [][]byte{nil})
+	assert.ErrorIs(t, err, common.ErrResponse)
+	var status *cmd.GRPCStatus
+	if assert.ErrorAs(t, err, &status) {
+		assert.Equal(t, 8, status.Code)
+		assert.Contains(t, status.Message, "4294967295 vs. 4194304")
+	}
+}
@@ -0,0 +1,83 @@
+package test_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPProbe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + string(b)))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := cmd.HTTPProbe{MaxRedirects: 10}
+	p.Config.Method = http.MethodPost
+	p.Config.Body = "body"
+	result, err := p.Probe(context.Background(), server.URL+"/old")
+	assert.Nil(t, err)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, http.StatusFound, result[0].Status)
+		assert.Equal(t, server.URL+"/new", result[1].URL)
+		assert.Equal(t, http.StatusOK, result[1].Status)
+		/* A 302 turns POST into GET without body. */
+		assert.Equal(t, int64(len(http.MethodGet)), result[1].Size)
+		assert.Equal(t, "HTTP/1.1", result[1].Proto)
+		assert.Greater(t, result[1].Total, 0.0)
+	}
+
+	p.MaxRedirects = 0
+	result, err = p.Probe(context.Background(), server.URL+"/old")
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+
+	tlsServer := httptest.NewUnstartedServer(mux)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	p = cmd.HTTPProbe{}
+	p.Config.Insecure = true
+	result, err = p.Probe(context.Background(), tlsServer.URL+"/new")
+	assert.Nil(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "HTTP/2.0", result[0].Proto)
+		assert.Equal(t, "TLS 1.3", result[0].TLSVersion)
+		assert.Greater(t, result[0].TLS, 0.0)
+	}
+
+	p.Config.Insecure = false
+	_, err = p.Probe(context.Background(), tlsServer.URL+"/new")
+	assert.NotNil(t, err)
+}
+
+func TestHTTPProbeHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer x" || r.Header.Get("X-Trace") != "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	out, err := exec.Command(binaryCommand, cmd.CommandHTTP, cmd.CommandProbe, server.URL, "-H", "Authorization: Bearer x",
+		"-H", `{"X-Trace":"1"}`, "--output", "json").Output()
+	assert.Nil(t, err)
+	var result []cmd.HTTPProbeResult
+	assert.Nil(t, json.Unmarshal(out, &result), string(out))
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, http.StatusOK, result[0].Status)
+	}
+}
@@ -1,10 +1,20 @@
 package test_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os/exec"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/line/line-bot-sdk-go/v7/linebot"
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLINEBinary(t *testing.T) {
@@ -15,3 +25,62 @@ func TestLINEBinary(t *testing.T) {
 		}
 	})
 }
+
+func TestLINEServer(t *testing.T) {
+	const secret = "channel-secret"
+	replies := make(chan map[string]any, 10)
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&v)
+		v["path"] = r.URL.Path
+		replies <- v
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer fake.Close()
+	api, err := linebot.New(secret, "token", linebot.WithEndpointBase(fake.URL))
+	assert.Nil(t, err)
+	server := httptest.NewServer(&cmd.LINEServer{
+		ChatOps: cmd.ChatOps{Commands: []string{cmd.CommandVersion}, Binary: binaryCommand},
+		Allow:   []string{"G1"},
+		API:     api,
+	})
+	defer server.Close()
+
+	post := func(sign string, events ...string) int {
+		body := `{"destination":"U0","events":[` + strings.Join(events, ",") + `]}`
+		mac := hmac.New(sha256.New, []byte(sign))
+		mac.Write([]byte(body))
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("X-Line-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	event := func(token, source, text string) string {
+		return `{"type":"message","replyToken":"` + token + `","timestamp":0,"mode":"active",` +
+			`"source":{"type":"group","groupId":"` + source + `","userId":"U1"},` +
+			`"message":{"id":"1","type":"text","text":"` + text + `"}}`
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", event("r0", "G1", "/version")))
+	assert.Equal(t, http.StatusOK, post(secret,
+		event("r1", "G2", "/version"), event("r2", "G1", "hello"), event("r3", "G1", "/version"), event("r4", "G1", "/rm -rf /")))
+
+	got := make(map[string]string)
+	for range 2 {
+		select {
+		case v := <-replies:
+			assert.Equal(t, "/v2/bot/message/reply", v["path"])
+			messages := v["messages"].([]any)
+			got[v["replyToken"].(string)] = messages[0].(map[string]any)["text"].(string)
+		case <-time.After(30 * time.Second):
+			t.Fatal("no reply from server")
+		}
+	}
+	assert.Len(t, got, 2)
+	assert.Contains(t, got["r3"], "Copyright © 2022 ZeYanLin")
+	assert.Contains(t, got["r4"], "unknown command rm")
+}
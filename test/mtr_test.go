@@ -0,0 +1,63 @@
+package test_test
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+/* TestMTRToggle runs the keys of the UI while Summary draws, run with -race. */
+func TestMTRToggle(t *testing.T) {
+	var m cmd.MTR
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				m.Summary()
+				_ = m.SparklineGroup(80)
+				_ = m.Hops()
+				_ = m.Rows()
+			}
+		}
+	}()
+	for range 100 {
+		m.ToggleDNS()
+		m.TogglePause()
+		m.ToggleDisplay()
+		m.ToggleJitter()
+		m.Reset()
+	}
+	close(done)
+	wg.Wait()
+	assert.False(t, m.DNS)
+	assert.False(t, m.Paused)
+	assert.False(t, m.Jitter)
+}
+
+func TestMTRReport(t *testing.T) {
+	/* Replies of the loopback are not hops, so the report has headers only. */
+	out, err := exec.Command(binaryCommand, cmd.CommandMTR, "127.0.0.1", "--report", "-c", "1", "-i", "50ms", "--output", "markdown").CombinedOutput()
+	if strings.Contains(string(out), "operation not permitted") {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+	assert.Nil(t, err, string(out))
+	assert.Equal(t, "| Host | Loss% | Snt | Last | Avg | Best | Wrst | StDev |\n|---|---|---|---|---|---|---|---|\n", string(out))
+
+	out, err = exec.Command(binaryCommand, cmd.CommandMTR, "127.0.0.1", "--report", "-c", "1", "-i", "50ms", "--output", "json").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, "null\n", string(out))
+
+	/* --output of a file name still works, with a deprecation warning. */
+	out, _ = exec.Command(binaryCommand, cmd.CommandMTR, "127.0.0.1", "-c", "1", "--output", "mtr.txt").CombinedOutput()
+	assert.Contains(t, string(out), "use --output-file")
+}
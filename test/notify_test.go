@@ -0,0 +1,201 @@
+package test_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/stretchr/testify/assert"
+)
+
+/* fakeNotifier records what it sent and fails when err is set. */
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []string
+	err  error
+}
+
+func (f *fakeNotifier) record(kind, arg string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, kind+":"+arg)
+	return f.err
+}
+
+func (f *fakeNotifier) Text(msg string) error { return f.record("text", msg) }
+
+func (f *fakeNotifier) File(path string) error { return f.record("file", path) }
+
+func (f *fakeNotifier) Image(path string) error { return f.record("image", path) }
+
+func TestResolveNotifyTargets(t *testing.T) {
+	channels := map[string]string{
+		"oncall": "slack+telegram",
+		"all":    "oncall,discord,slack",
+		"loop":   "loop+line",
+	}
+	testCases := []struct {
+		input  []string
+		expect []string
+	}{
+		{[]string{"oncall"}, []string{"slack", "telegram"}},
+		{[]string{"all"}, []string{"slack", "telegram", "discord"}},
+		{[]string{"Discord+slack.ops", "line"}, []string{"discord", "slack.ops", "line"}},
+		{[]string{"loop"}, []string{"loop", "line"}},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expect, cmd.ResolveNotifyTargets(channels, testCase.input))
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ok, failed := &fakeNotifier{}, &fakeNotifier{err: errors.New("rate limited")}
+	notifiers := map[string]cmd.Notifier{"telegram": failed, "slack": ok}
+
+	results := cmd.Notify(notifiers, "text", "disk full")
+	assert.Equal(t, []cmd.NotifyResult{{Target: "slack"}, {Target: "telegram", Error: "rate limited"}}, results)
+	assert.Equal(t, []string{"text:disk full"}, ok.sent)
+	assert.Equal(t, []string{"text:disk full"}, failed.sent)
+
+	cmd.Notify(notifiers, "photo", "graph.png")
+	cmd.Notify(notifiers, "file", "report.csv")
+	assert.Equal(t, []string{"text:disk full", "image:graph.png", "file:report.csv"}, ok.sent)
+
+	_, err := cmd.NewNotifier("unknown")
+	assert.NotNil(t, err)
+}
+
+/* TestNotifyUnknownTarget reports a typo in --to as the result of the target, the config has no notify block. */
+func TestNotifyUnknownTarget(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(config, []byte("slack:\n  token: xoxb-token\n"), 0o600))
+	for _, v := range []string{config, filepath.Join(t.TempDir(), "missing.yaml")} {
+		out, err := exec.Command(binaryCommand, cmd.CommandNotify, cmd.CommandText, "--to", "slak", "-a", "hi", "--config", v, "--output", "json").Output()
+		assert.Nil(t, err)
+		var results []cmd.NotifyResult
+		assert.Nil(t, json.Unmarshal(out, &results), string(out))
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "slak", results[0].Target)
+			assert.NotEmpty(t, results[0].Error)
+		}
+	}
+	out, _ := exec.Command(binaryCommand, cmd.CommandNotify, cmd.CommandText, "--to", "slak", "-a", "hi", "--config", config).CombinedOutput()
+	assert.Contains(t, string(out), "unknown target slak")
+}
+
+func TestNotifyMessage(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "alert.tmpl")
+	assert.Nil(t, os.WriteFile(tmpl, []byte("*{{upper .host}}* {{.status}}\n{{code .Text}}\n"), 0o600))
+
+	testCases := []struct {
+		message cmd.NotifyMessage
+		arg     string
+		stdin   string
+		expect  string
+	}{
+		{cmd.NotifyMessage{}, "hello", "", "hello"},
+		{cmd.NotifyMessage{}, "-", "line 1\nline 2\n", "line 1\nline 2"},
+		{cmd.NotifyMessage{Template: tmpl, Vars: []string{"host=db1", "status=down"}}, "disk full", "", "*DB1* down\n```\ndisk full\n```"},
+		{cmd.NotifyMessage{Template: tmpl, Vars: []string{"status=up"}}, "-", `{"host":"web1","Text":"ok"}`, "*WEB1* up\n```\nok\n```"},
+		{cmd.NotifyMessage{Template: tmpl, Vars: []string{"host=db1"}}, "-", "/dev/sda1 91%\n", "*DB1* <no value>\n```\n/dev/sda1 91%\n```"},
+	}
+	for _, testCase := range testCases {
+		got, err := testCase.message.Render(testCase.arg, strings.NewReader(testCase.stdin))
+		assert.Nil(t, err)
+		assert.Equal(t, testCase.expect, got)
+	}
+
+	_, err := cmd.NotifyMessage{}.Render("", strings.NewReader(""))
+	assert.NotNil(t, err)
+	_, err = cmd.NotifyMessage{Template: tmpl, Vars: []string{"host"}}.Render("x", strings.NewReader(""))
+	assert.NotNil(t, err)
+}
+
+func TestNotifyQueue(t *testing.T) {
+	outbox := filepath.Join(t.TempDir(), "outbox", "queue.jsonl")
+	queue := cmd.NotifyQueue{Retry: 2, Wait: time.Millisecond, Outbox: outbox}
+
+	var calls int
+	temporary := &net.DNSError{Err: "timeout", IsTemporary: true}
+	err := queue.Send(cmd.NotifyOutboxEntry{Target: "slack", Kind: "text", Arg: "disk full"}, func() error {
+		calls++
+		return temporary
+	})
+	assert.ErrorIs(t, err, temporary)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = queue.Send(cmd.NotifyOutboxEntry{Target: "slack", Kind: "text", Arg: "bad"}, func() error {
+		calls++
+		return errors.New("invalid_auth")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+
+	assert.NotNil(t, queue.Send(cmd.NotifyOutboxEntry{Target: "telegram", Kind: "photo", Arg: "graph.png"}, func() error { return temporary }))
+	assert.NotNil(t, queue.Send(cmd.NotifyOutboxEntry{Target: "slack", Kind: "file", Arg: "report.csv"}, func() error { return temporary }))
+
+	/* Flush only slack, the file is dropped and telegram stays in the outbox. */
+	var sent []string
+	results, err := queue.Flush(func(target string) bool { return target == "slack" }, func(entry cmd.NotifyOutboxEntry) error {
+		if entry.Kind == "file" {
+			return os.ErrNotExist
+		}
+		sent = append(sent, entry.Arg)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"disk full"}, sent)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "sent", results[0].Status)
+	assert.Equal(t, "dropped", results[1].Status)
+
+	results, err = queue.Flush(func(string) bool { return true }, func(cmd.NotifyOutboxEntry) error { return temporary })
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "telegram", results[0].Target)
+	assert.Equal(t, "queued", results[0].Status)
+
+	results, err = queue.Flush(func(string) bool { return true }, func(cmd.NotifyOutboxEntry) error { return nil })
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "sent", results[0].Status)
+	_, err = os.Stat(outbox)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChatOpsConcurrency(t *testing.T) {
+	c := cmd.ChatOps{Concurrency: 1}
+	block, done := make(chan struct{}), make(chan struct{})
+	assert.True(t, c.Go(func() {
+		<-block
+		close(done)
+	}))
+	assert.False(t, c.Go(func() {}))
+	close(block)
+	<-done
+	assert.Eventually(t, func() bool { return c.Go(func() {}) }, time.Second, 10*time.Millisecond)
+}
+
+func TestChatOpsLocalPath(t *testing.T) {
+	c := cmd.ChatOps{Commands: []string{cmd.CommandCert, cmd.CommandVersion}, Binary: binaryCommand}
+	file := filepath.Join(t.TempDir(), "cert.pem")
+	assert.Nil(t, os.WriteFile(file, []byte("x"), 0o600))
+	for _, v := range [][]string{{file}, {"/etc"}, {"--output=" + file}, {"@" + file}} {
+		_, err := c.Exec(context.Background(), cmd.CommandCert, v)
+		assert.ErrorIs(t, err, common.ErrInvalidArg, v)
+	}
+	out, err := c.Exec(context.Background(), cmd.CommandVersion, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, out, "Copyright")
+}
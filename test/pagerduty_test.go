@@ -0,0 +1,66 @@
+package test_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerDuty(t *testing.T) {
+	events := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		if event["routing_key"] != "key" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"invalid event","message":"Event object is invalid"}`))
+			return
+		}
+		dedup, _ := event["dedup_key"].(string)
+		if dedup == "" {
+			dedup = "generated"
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Event processed", "dedup_key": dedup})
+	}))
+	defer server.Close()
+
+	/* The endpoint is only configurable in the config. */
+	config := filepath.Join(t.TempDir(), "config.toml")
+	assert.Nil(t, os.WriteFile(config, []byte("[pagerduty]\nrouting_key = \"key\"\nurl = \""+server.URL+"\"\n"), 0o600))
+
+	out, err := exec.Command(binaryCommand, cmd.CommandPagerDuty, cmd.CommandTrigger, "-a", "disk full",
+		"--severity", "critical", "--source", "db1", "--config", config).Output()
+	assert.Nil(t, err)
+	event := <-events
+	assert.Equal(t, "trigger", event["event_action"])
+	assert.Equal(t, map[string]any{"summary": "disk full", "source": "db1", "severity": "critical"}, event["payload"])
+	var resp cmd.PagerDutyResponse
+	assert.Nil(t, json.Unmarshal(out, &resp))
+	assert.Equal(t, "generated", resp.DedupKey)
+
+	/* Summaries over 1024 characters are rejected by PagerDuty. */
+	_, err = exec.Command(binaryCommand, cmd.CommandPagerDuty, cmd.CommandTrigger, "-a", strings.Repeat("é", 2000), "--config", config).Output()
+	assert.Nil(t, err)
+	event = <-events
+	summary := event["payload"].(map[string]any)["summary"].(string)
+	assert.Equal(t, 1024, utf8.RuneCountInString(summary))
+	assert.True(t, strings.HasSuffix(summary, "\n..."))
+
+	_, err = exec.Command(binaryCommand, cmd.CommandPagerDuty, cmd.CommandResolve, "--dedup-key", "db1-disk", "--config", config).Output()
+	assert.Nil(t, err)
+	event = <-events
+	assert.Equal(t, "resolve", event["event_action"])
+	assert.Equal(t, "db1-disk", event["dedup_key"])
+	assert.Nil(t, event["payload"])
+}
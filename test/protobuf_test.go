@@ -0,0 +1,144 @@
+package test_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/stretchr/testify/assert"
+)
+
+/* protoGoldenRegistry returns the types of golden.proto, the messages of the encoding guide of protobuf and more scalars. */
+func protoGoldenRegistry(t *testing.T) *common.ProtoRegistry {
+	t.Helper()
+	str := func(b []byte, n int, s string) []byte { return common.ProtoAppendBytes(b, n, []byte(s)) }
+	field := func(name string, number, label, typ int, typeName string) []byte {
+		f := str(nil, 1, name)
+		f = common.ProtoAppendVarint(f, 3, uint64(number))
+		f = common.ProtoAppendVarint(f, 4, uint64(label))
+		f = common.ProtoAppendVarint(f, 5, uint64(typ))
+		if typeName != "" {
+			f = str(f, 6, typeName)
+		}
+		return f
+	}
+	value := func(name string, number int) []byte {
+		return common.ProtoAppendVarint(str(nil, 1, name), 2, uint64(number))
+	}
+
+	test1 := str(nil, 1, "Test1")
+	test1 = common.ProtoAppendBytes(test1, 2, field("a", 1, 1, 5, ""))
+	entry := str(nil, 1, "LabelsEntry")
+	entry = common.ProtoAppendBytes(entry, 2, field("key", 1, 1, 9, ""))
+	entry = common.ProtoAppendBytes(entry, 2, field("value", 2, 1, 5, ""))
+	entry = common.ProtoAppendBytes(entry, 7, common.ProtoAppendVarint(nil, 7, 1))
+	all := str(nil, 1, "All")
+	for _, v := range []struct {
+		name               string
+		number, label, typ int
+		typeName           string
+	}{
+		{"a", 1, 1, 5, ""},
+		{"b", 2, 1, 9, ""},
+		{"c", 3, 1, 11, ".golden.Test1"},
+		{"d", 4, 3, 5, ""},
+		{"e", 5, 1, 17, ""},
+		{"f", 6, 1, 5, ""},
+		{"g", 7, 1, 8, ""},
+		{"h", 8, 1, 1, ""},
+		{"i", 9, 1, 2, ""},
+		{"j", 10, 1, 14, ".golden.Mood"},
+		{"k", 11, 3, 11, ".golden.All.LabelsEntry"},
+		{"l", 12, 1, 12, ""},
+		{"m", 13, 1, 7, ""},
+		{"n", 14, 1, 3, ""},
+		{"total_score", 15, 1, 5, ""},
+	} {
+		all = common.ProtoAppendBytes(all, 2, field(v.name, v.number, v.label, v.typ, v.typeName))
+	}
+	all = common.ProtoAppendBytes(all, 3, entry)
+	mood := str(nil, 1, "Mood")
+	mood = common.ProtoAppendBytes(mood, 2, value("UNKNOWN", 0))
+	mood = common.ProtoAppendBytes(mood, 2, value("HAPPY", 1))
+
+	file := str(nil, 1, "golden.proto")
+	file = str(file, 2, "golden")
+	file = common.ProtoAppendBytes(file, 4, test1)
+	file = common.ProtoAppendBytes(file, 4, all)
+	file = common.ProtoAppendBytes(file, 5, mood)
+	f, err := common.ParseProtoFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := common.NewProtoRegistry()
+	r.Add(f)
+	return r
+}
+
+func TestProtoGolden(t *testing.T) {
+	r := protoGoldenRegistry(t)
+	testCases := []struct {
+		name, message, input, expected string
+	}{
+		{"varint", "golden.Test1", `{"a":150}`, "089601"},
+		{"string", "golden.All", `{"b":"testing"}`, "120774657374696e67"},
+		{"embedded", "golden.All", `{"c":{"a":150}}`, "1a03089601"},
+		{"packed", "golden.All", `{"d":[3,270,86942]}`, "2206038e029ea705"},
+		{"sint32", "golden.All", `{"e":-2}`, "2803"},
+		{"negative int32", "golden.All", `{"f":-1}`, "30ffffffffffffffffff01"},
+		{"bool", "golden.All", `{"g":true}`, "3801"},
+		{"double", "golden.All", `{"h":1}`, "41000000000000f03f"},
+		{"float", "golden.All", `{"i":1}`, "4d0000803f"},
+		{"enum", "golden.All", `{"j":"HAPPY"}`, "5001"},
+		{"map", "golden.All", `{"k":{"y":4,"x":3}}`, "5a050a017810035a050a01791004"},
+		{"bytes", "golden.All", `{"l":"aGk="}`, "62026869"},
+		{"fixed32", "golden.All", `{"m":1}`, "6d01000000"},
+		{"int64", "golden.All", `{"n":"1"}`, "7001"},
+		{"json name", "golden.All", `{"totalScore":7}`, "7807"},
+		/* Fields are written in the order of their numbers. */
+		{"order", "golden.All", `{"n":"1","b":"testing","a":150}`, "089601120774657374696e677001"},
+	}
+	for _, v := range testCases {
+		t.Run(v.name, func(t *testing.T) {
+			got, err := r.Marshal(v.message, []byte(v.input))
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, hex.EncodeToString(got))
+
+			/* Decoding and encoding again gives the same bytes. */
+			decoded, err := r.Unmarshal(v.message, got)
+			assert.Nil(t, err)
+			data, err := json.Marshal(decoded)
+			assert.Nil(t, err)
+			again, err := r.Marshal(v.message, data)
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, hex.EncodeToString(again), string(data))
+		})
+	}
+
+	/* Unpacked repeated scalars are decoded as well. */
+	b, _ := hex.DecodeString("2003208e02209ea705")
+	decoded, err := r.Unmarshal("golden.All", b)
+	assert.Nil(t, err)
+	data, _ := json.Marshal(decoded)
+	assert.JSONEq(t, `{"d":[3,270,86942]}`, string(data))
+
+	_, err = r.Marshal("golden.All", []byte(`{"unknown":1}`))
+	assert.NotNil(t, err)
+}
+
+func TestProtoDecodeGolden(t *testing.T) {
+	b, _ := hex.DecodeString("089601120774657374696e67" + "4d0000803f" + "41000000000000f03f")
+	fields, err := common.ProtoDecode(b)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.ProtoField{
+		{Number: 1, Wire: common.ProtoWireVarint, Varint: 150},
+		{Number: 2, Wire: common.ProtoWireBytes, Bytes: []byte("testing")},
+		{Number: 9, Wire: common.ProtoWireFixed32, Varint: 0x3f800000},
+		{Number: 8, Wire: common.ProtoWireFixed64, Varint: 0x3ff0000000000000},
+	}, fields)
+
+	/* A length past the end is an error. */
+	_, err = common.ProtoDecode([]byte{0x12, 0x07, 0x74})
+	assert.NotNil(t, err)
+}
@@ -1,10 +1,22 @@
 package test_test
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
 	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRedisBinary(t *testing.T) {
@@ -15,3 +27,293 @@ func TestRedisBinary(t *testing.T) {
 		}
 	})
 }
+
+/* redisStub is a small in-memory Redis server speaking RESP2. */
+type redisStub struct {
+	sync.Mutex
+	addr string
+	keys map[string]*redisStubKey
+}
+
+type redisStubKey struct {
+	typ     string
+	members []string
+	ttl     time.Duration
+}
+
+func newRedisStub(t *testing.T) *redisStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &redisStub{addr: ln.Addr().String(), keys: make(map[string]*redisStubKey)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *redisStub) set(key, typ string, ttl time.Duration, members ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.keys[key] = &redisStubKey{typ: typ, members: members, ttl: ttl}
+}
+
+func (s *redisStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "*") {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			if _, err = r.ReadString('\n'); err != nil {
+				return
+			}
+			arg, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args[i] = strings.TrimSuffix(arg, "\r\n")
+		}
+		s.Lock()
+		reply := s.do(args)
+		s.Unlock()
+		if _, err = io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func redisStubBulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+func redisStubArray(items ...string) string {
+	return fmt.Sprintf("*%d\r\n%s", len(items), strings.Join(items, ""))
+}
+
+func (s *redisStub) do(args []string) string {
+	host, port, _ := net.SplitHostPort(s.addr)
+	key := func() *redisStubKey {
+		if len(args) < 2 {
+			return nil
+		}
+		return s.keys[args[1]]
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT", "AUTH":
+		return "+OK\r\n"
+	case "COMMAND":
+		var infos []string
+		for _, v := range []string{"get", "set", "scan", "ping"} {
+			infos = append(infos, redisStubArray(redisStubBulk(v), ":2\r\n", redisStubArray(), ":1\r\n", ":1\r\n", ":1\r\n"))
+		}
+		return redisStubArray(infos...)
+	case "CLUSTER":
+		p, _ := strconv.Atoi(port)
+		return redisStubArray(redisStubArray(":0\r\n", ":16383\r\n", redisStubArray(redisStubBulk(host), fmt.Sprintf(":%d\r\n", p))))
+	case "SENTINEL":
+		if strings.EqualFold(args[1], "get-master-addr-by-name") && args[2] == "mymaster" {
+			return redisStubArray(redisStubBulk(host), redisStubBulk(port))
+		}
+		return redisStubArray()
+	case "SET":
+		s.keys[args[1]] = &redisStubKey{typ: "string", members: []string{args[2]}}
+		return "+OK\r\n"
+	case "GET":
+		if k := key(); k != nil {
+			return redisStubBulk(k.members[0])
+		}
+		return "$-1\r\n"
+	case "DEL":
+		_, ok := s.keys[args[1]]
+		delete(s.keys, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "RPUSH":
+		k := key()
+		if k == nil {
+			k = &redisStubKey{typ: "list"}
+			s.keys[args[1]] = k
+		}
+		k.members = append(k.members, args[2:]...)
+		return fmt.Sprintf(":%d\r\n", len(k.members))
+	case "LRANGE":
+		var items []string
+		if k := key(); k != nil {
+			for _, v := range k.members {
+				items = append(items, redisStubBulk(v))
+			}
+		}
+		return redisStubArray(items...)
+	case "TYPE":
+		if k := key(); k != nil {
+			return "+" + k.typ + "\r\n"
+		}
+		return "+none\r\n"
+	case "STRLEN":
+		if k := key(); k != nil {
+			return fmt.Sprintf(":%d\r\n", len(k.members[0]))
+		}
+		return ":0\r\n"
+	case "LLEN", "HLEN", "SCARD", "ZCARD", "XLEN":
+		if k := key(); k != nil {
+			return fmt.Sprintf(":%d\r\n", len(k.members))
+		}
+		return ":0\r\n"
+	case "PTTL":
+		k := key()
+		switch {
+		case k == nil:
+			return ":-2\r\n"
+		case k.ttl == 0:
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", k.ttl.Milliseconds())
+	case "MEMORY":
+		if len(args) > 2 && strings.EqualFold(args[1], "usage") {
+			if k, ok := s.keys[args[2]]; ok {
+				size := 50 + len(args[2])
+				for _, v := range k.members {
+					size += len(v)
+				}
+				return fmt.Sprintf(":%d\r\n", size)
+			}
+			return "$-1\r\n"
+		}
+	case "SCAN":
+		match, count := "*", 10
+		for i := 2; i+1 < len(args); i += 2 {
+			switch strings.ToUpper(args[i]) {
+			case "MATCH":
+				match = args[i+1]
+			case "COUNT":
+				count, _ = strconv.Atoi(args[i+1])
+			}
+		}
+		keys := make([]string, 0, len(s.keys))
+		for k := range s.keys {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		cursor, _ := strconv.Atoi(args[1])
+		end := min(cursor+count, len(keys))
+		next := end
+		if end == len(keys) {
+			next = 0
+		}
+		var items []string
+		for _, k := range keys[min(cursor, len(keys)):end] {
+			if ok, _ := path.Match(match, k); ok {
+				items = append(items, redisStubBulk(k))
+			}
+		}
+		return redisStubArray(redisStubBulk(strconv.Itoa(next)), redisStubArray(items...))
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestRedis(t *testing.T) {
+	stub := newRedisStub(t)
+	host, port, _ := net.SplitHostPort(stub.addr)
+	r := cmd.Redis{Host: host, Port: port}
+	rdb, err := r.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+	ctx := context.Background()
+
+	var out strings.Builder
+	input := "set name 'Joe Doe'\nget name\nget missing\nrpush list a \"b\\tc\"\nlrange list 0 -1\nlrange empty 0 -1\nselect 2\nbad\nquit\nget name\n"
+	assert.Nil(t, r.Interactive(ctx, rdb, strings.NewReader(input), &out))
+	assert.Equal(t, strings.Join([]string{
+		`"OK"`, `"Joe Doe"`, `(nil)`, `(integer) 2`, `1) "a"`, `2) "b\tc"`, `(empty array)`, `OK`,
+		`(error) ERR unknown command 'bad'`, ``,
+	}, "\r\n"), out.String())
+	assert.Equal(t, 2, r.DB)
+
+	var errs strings.Builder
+	replies, failed, err := r.Pipe(ctx, rdb, strings.NewReader("set a 1\nset b 2\n\nunknown\nset c 'unbalanced\n"), &errs)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, replies)
+	assert.Equal(t, 2, failed)
+	assert.Contains(t, errs.String(), "unknown command")
+
+	for _, r := range []cmd.Redis{
+		{Addrs: []string{stub.addr}, Cluster: true},
+		{Addrs: []string{stub.addr}, Sentinel: "mymaster"},
+	} {
+		rdb, err := r.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := rdb.Get(ctx, "a").Result()
+		assert.Nil(t, err)
+		assert.Equal(t, "1", v)
+		rdb.Close()
+	}
+}
+
+func TestRedisScanAnalysis(t *testing.T) {
+	stub := newRedisStub(t)
+	for i := range 30 {
+		stub.set(fmt.Sprintf("session:%02d", i), "string", time.Duration(i+1)*time.Minute, "token")
+	}
+	stub.set("user:1:profile", "hash", 0, "name", "joe", "age", "30")
+	stub.set("user:2:profile", "hash", 0, "name", "amy")
+	stub.set("queue", "list", 0, strings.Repeat("x", 1000), "y")
+	host, port, _ := net.SplitHostPort(stub.addr)
+	r := cmd.Redis{Host: host, Port: port}
+	rdb, err := r.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+
+	a := cmd.RedisScanAnalysis{Count: 7, Match: "*", By: "elements", Top: 2, Separator: ":", Depth: 1}
+	result, err := a.Run(context.Background(), rdb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(33), result.Keys)
+	assert.Equal(t, []string{"string", "list", "hash"},
+		[]string{result.Types[0].Type, result.Types[1].Type, result.Types[2].Type})
+	assert.Equal(t, "session:00", result.BigKeys[0].Key)
+	assert.Equal(t, int64(60), result.BigKeys[0].TTL)
+	assert.Equal(t, []cmd.RedisKeyStat{
+		{Key: "queue", Type: "list", Memory: 1056, Elements: 2, TTL: -1},
+		{Key: "user:1:profile", Type: "hash", Memory: 76, Elements: 4, TTL: -1},
+		{Key: "user:2:profile", Type: "hash", Memory: 71, Elements: 2, TTL: -1},
+	}, result.BigKeys[2:])
+	assert.Equal(t, []cmd.RedisPrefixStat{
+		{Prefix: "session:*", Keys: 30, Memory: 30 * 65},
+		{Prefix: "user:*", Keys: 2, Memory: 147},
+	}, result.Prefix)
+	assert.Equal(t, []cmd.RedisTTLBucket{
+		{TTL: "no ttl", Keys: 3}, {TTL: "< 1m", Keys: 0}, {TTL: "1m - 1h", Keys: 30},
+		{TTL: "1h - 1d", Keys: 0}, {TTL: "1d - 7d", Keys: 0}, {TTL: ">= 7d", Keys: 0},
+	}, result.TTL)
+
+	a = cmd.RedisScanAnalysis{Count: 100, Match: "user:*", By: "memory", Top: 1, Separator: ":", Depth: 2, Rate: 1000}
+	result, err = a.Run(context.Background(), rdb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Keys)
+	assert.Equal(t, "user:1:profile", result.BigKeys[0].Key)
+	assert.Len(t, result.Prefix, 1)
+
+	a.By = "size"
+	_, err = a.Run(context.Background(), rdb)
+	assert.NotNil(t, err)
+}
@@ -6,7 +6,9 @@ import (
 	"os/exec"
 	"testing"
 
+	"github.com/linzeyan/ops-cli/cmd"
 	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/stretchr/testify/assert"
 )
 
 const (
@@ -33,3 +35,14 @@ func TestMain(m *testing.M) {
 	_ = os.Remove(binaryCommand)
 	os.Exit(exitCode)
 }
+
+func TestRootOutput(t *testing.T) {
+	/* csv and markdown need tabular data, other commands fail instead of printing nothing. */
+	out, err := exec.Command(binaryCommand, cmd.CommandSystem, cmd.CommandLoad, "--output", common.CSVFormat).CombinedOutput()
+	assert.NotNil(t, err)
+	assert.Contains(t, string(out), "output csv is not supported by this command")
+
+	out, err = exec.Command(binaryCommand, cmd.CommandSystem, cmd.CommandLoad, "--output", common.JSONFormat).Output()
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "Load1")
+}
@@ -1,10 +1,25 @@
 package test_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSlackBinary(t *testing.T) {
@@ -15,3 +30,164 @@ func TestSlackBinary(t *testing.T) {
 		}
 	})
 }
+
+func TestSlackServer(t *testing.T) {
+	const secret = "signing-secret"
+	posts := make(chan url.Values, 10)
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/response" {
+			var msg slack.WebhookMessage
+			_ = json.NewDecoder(r.Body).Decode(&msg)
+			posts <- url.Values{"response_type": {msg.ResponseType}, "text": {msg.Text}}
+			return
+		}
+		_ = r.ParseForm()
+		posts <- r.PostForm
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "channel": r.PostForm.Get("channel"), "ts": "2.0"})
+	}))
+	defer fake.Close()
+
+	handler := &cmd.SlackServer{
+		ChatOps:       cmd.ChatOps{Commands: []string{cmd.CommandVersion}, Binary: binaryCommand},
+		SigningSecret: secret,
+		Allow:         []string{"C1"},
+		API:           slack.New("xoxb-token", slack.OptionAPIURL(fake.URL+"/")),
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(path, contentType, body, sign string) (int, string) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(sign))
+		mac.Write([]byte("v0:" + ts + ":" + body))
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	waitPost := func() url.Values {
+		select {
+		case v := <-posts:
+			return v
+		case <-time.After(30 * time.Second):
+			t.Fatal("no reply posted")
+		}
+		return nil
+	}
+	const form = "application/x-www-form-urlencoded"
+	slash := func(channel, text string) string {
+		return url.Values{"command": {"/ops"}, "text": {text}, "channel_id": {channel}, "user_name": {"oncall"},
+			"response_url": {fake.URL + "/response"}}.Encode()
+	}
+
+	status, _ := post("/commands", form, slash("C1", "version"), "wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, body := post("/commands", form, slash("C2", "version"), secret)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "not allowed")
+
+	_, body = post("/commands", form, slash("C1", "rm -rf /"), secret)
+	assert.Contains(t, body, `"response_type":"ephemeral"`)
+	assert.Contains(t, body, "/ops version args")
+
+	_, body = post("/commands", form, slash("C1", "version"), secret)
+	assert.Contains(t, body, `"response_type":"in_channel"`)
+	reply := waitPost()
+	assert.Equal(t, "in_channel", reply.Get("response_type"))
+	assert.True(t, strings.HasPrefix(reply.Get("text"), "```"), reply.Get("text"))
+	assert.Contains(t, reply.Get("text"), "Copyright © 2022 ZeYanLin &lt;zeyanlin@outlook.com&gt;")
+
+	_, body = post("/events", "application/json", `{"type":"url_verification","challenge":"abc"}`, secret)
+	assert.Equal(t, "abc", body)
+
+	event := `{"type":"event_callback","event":{"type":"app_mention","text":"<@U0BOT> version","user":"U1","channel":"C1","ts":"1.0"}}`
+	status, _ = post("/events", "application/json", event, secret)
+	assert.Equal(t, http.StatusOK, status)
+	reply = waitPost()
+	assert.Equal(t, "C1", reply.Get("channel"))
+	assert.Equal(t, "1.0", reply.Get("thread_ts"))
+	assert.Contains(t, reply.Get("text"), "Copyright")
+
+	/* Slack wraps words looking like links, the label is what the user typed. */
+	event = `{"type":"event_callback","event":{"type":"app_mention","text":"<@U0BOT> <http://version|version>","user":"U1","channel":"C1","ts":"2.0"}}`
+	_, _ = post("/events", "application/json", event, secret)
+	reply = waitPost()
+	assert.Equal(t, "2.0", reply.Get("thread_ts"))
+	assert.Contains(t, reply.Get("text"), "Copyright")
+}
+
+func TestSlackThread(t *testing.T) {
+	posts := make(chan url.Values, 10)
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		r.PostForm.Set("method", strings.TrimPrefix(r.URL.Path, "/"))
+		posts <- r.PostForm
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "channel": r.PostForm.Get("channel"), "ts": "2.0"})
+	}))
+	defer fake.Close()
+
+	out, err := exec.Command(binaryCommand, cmd.CommandSlack, cmd.CommandText, "-t", "xoxb-token", "-c", "C1", "--api", fake.URL+"/",
+		"--thread", "1.0", "-a", "backup started").Output()
+	assert.Nil(t, err)
+	var result cmd.NotifySent
+	assert.Nil(t, json.Unmarshal(out, &result), string(out))
+	assert.Equal(t, cmd.NotifySent{ID: "2.0", Channel: "C1", Thread: "1.0"}, result)
+	v := <-posts
+	assert.Equal(t, "chat.postMessage", v.Get("method"))
+	assert.Equal(t, "1.0", v.Get("thread_ts"))
+
+	out, err = exec.Command(binaryCommand, cmd.CommandSlack, cmd.CommandText, "-t", "xoxb-token", "-c", "C1", "--api", fake.URL+"/",
+		"--edit", "2.0", "-a", "backup finished").Output()
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), `"id": "2.0"`)
+	v = <-posts
+	assert.Equal(t, "chat.update", v.Get("method"))
+	assert.Equal(t, "2.0", v.Get("ts"))
+	assert.Equal(t, "backup finished", v.Get("text"))
+}
+
+/* TestSlackOutbox flushes a queued message to its channel and color, not those of the flush flags. */
+func TestSlackOutbox(t *testing.T) {
+	var mu sync.Mutex
+	var fail = true
+	posts := make(chan url.Values, 10)
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = r.ParseForm()
+		posts <- r.PostForm
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "channel": r.PostForm.Get("channel"), "ts": "1.0"})
+	}))
+	defer fake.Close()
+	outbox := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	out, _ := exec.Command(binaryCommand, cmd.CommandSlack, cmd.CommandText, "-t", "xoxb-token", "--api", fake.URL+"/",
+		"-c", "C1", "--color", "danger", "-a", "db1 down", "--retry", "0", "--outbox", outbox).CombinedOutput()
+	assert.Contains(t, string(out), "queued into")
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	out, err := exec.Command(binaryCommand, cmd.CommandSlack, cmd.CommandFlush, "-t", "xoxb-token", "--api", fake.URL+"/",
+		"-c", "C2", "--outbox", outbox).CombinedOutput()
+	assert.Nil(t, err, string(out))
+	select {
+	case v := <-posts:
+		assert.Equal(t, "C1", v.Get("channel"))
+		assert.Contains(t, v.Get("attachments"), `"color":"#a30200"`)
+	case <-time.After(10 * time.Second):
+		t.Fatal("queued message was not sent")
+	}
+}
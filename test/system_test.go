@@ -1,10 +1,15 @@
 package test_test
 
 import (
+	"context"
+	"image"
 	"os/exec"
 	"testing"
+	"time"
 
+	"github.com/gizak/termui/v3"
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSystemBinary(t *testing.T) {
@@ -25,3 +30,29 @@ func TestSystemBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestSystemTop(t *testing.T) {
+	top := cmd.SystemTop{Sort: "rss"}
+	assert.Nil(t, top.Sample(context.Background()))
+	assert.Empty(t, top.NetRecv)
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, top.Sample(context.Background()))
+
+	/* CPUs of the host, which are more than runtime.NumCPU under a cpuset or an affinity mask. */
+	assert.NotEmpty(t, top.CPU)
+	assert.NotNil(t, top.Memory)
+	assert.Len(t, top.DiskRead, 1)
+	assert.Len(t, top.NetSent, 1)
+	assert.NotEmpty(t, top.Processes)
+	for i := 1; i < len(top.Processes); i++ {
+		assert.GreaterOrEqual(t, top.Processes[i-1].RSS, top.Processes[i].RSS)
+	}
+
+	/* Every widget draws in a small and a large terminal. */
+	for _, size := range [][2]int{{40, 20}, {200, 60}} {
+		buf := termui.NewBuffer(image.Rect(0, 0, size[0], size[1]))
+		for _, w := range top.Widgets(size[0], size[1]) {
+			w.Draw(buf)
+		}
+	}
+}
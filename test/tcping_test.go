@@ -1,10 +1,17 @@
 package test_test
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestTcpingBinary(t *testing.T) {
@@ -25,3 +32,128 @@ func TestTcpingBinary(t *testing.T) {
 		}
 	})
 }
+
+func TestTcpingScan(t *testing.T) {
+	ports, err := cmd.ParseScanPorts("443,22,80-82,22")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{22, 80, 81, 82, 443}, ports)
+	for _, v := range []string{"", "0", "65536", "90-80", "ssh"} {
+		_, err = cmd.ParseScanPorts(v)
+		assert.NotNil(t, err, v)
+	}
+
+	targets, err := cmd.ParseScanTargets("192.0.2.0/30,localhost")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3", "localhost"}, targets)
+
+	ssh, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ssh.Close()
+	go func() {
+		for {
+			conn, err := ssh.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Server", "test-server")
+	}))
+	defer web.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	sshPort := ssh.Addr().(*net.TCPAddr).Port
+	webPort := web.Listener.Addr().(*net.TCPAddr).Port
+	scanner := cmd.TCPing{Timeout: time.Second, Concurrency: 2, Banner: true}
+	results, err := scanner.Scan([]string{"127.0.0.1"}, []int{sshPort, webPort, closedPort})
+	assert.Nil(t, err)
+	assert.Equal(t, []cmd.TCPingScanResult{
+		{Host: "127.0.0.1", Port: sshPort, State: "open", Service: "ssh", Banner: "SSH-2.0-OpenSSH_9.6"},
+		{Host: "127.0.0.1", Port: webPort, State: "open", Service: "http", Banner: "test-server"},
+		{Host: "127.0.0.1", Port: closedPort, State: "closed"},
+	}, results)
+
+	/* A name which does not resolve is an error, not filtered. */
+	results, err = scanner.Scan([]string{"nonexistent.invalid"}, []int{22, 80})
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	for _, v := range results {
+		assert.Equal(t, "error", v.State)
+		assert.NotEmpty(t, v.Error)
+	}
+
+	targets, err = cmd.ParseScanTargets("10.0.0.0/16")
+	assert.Nil(t, err)
+	ports, err = cmd.ParseScanPorts("1-65535")
+	assert.Nil(t, err)
+	_, err = scanner.Scan(targets, ports)
+	assert.ErrorIs(t, err, common.ErrInvalidArg)
+}
+
+func TestTcpingProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udp.WriteTo(buf[:n], addr)
+		}
+	}()
+	_, tcpPort, _ := net.SplitHostPort(ln.Addr().String())
+	_, udpPort, _ := net.SplitHostPort(udp.LocalAddr().String())
+
+	tcping := cmd.TCPing{Protocal: "tcp", Timeout: time.Second}
+	stat := tcping.Run(context.Background(), "127.0.0.1", tcpPort, 3, 10*time.Millisecond)
+	assert.Equal(t, 3, stat.Sent)
+	assert.Equal(t, 3, stat.Received)
+	for _, p := range stat.Probes {
+		assert.Equal(t, "open", p.State)
+		assert.Equal(t, "127.0.0.1", p.IP)
+	}
+
+	tcping = cmd.TCPing{Protocal: "udp", Timeout: time.Second, Payload: []byte("ping")}
+	p := tcping.Probe(0, "127.0.0.1", udpPort)
+	assert.Equal(t, "open", p.State)
+
+	/* The UDP listener is closed, so the port replies with ICMP port unreachable. */
+	udp.Close()
+	p = tcping.Probe(0, "127.0.0.1", udpPort)
+	assert.Equal(t, "closed", p.State)
+	assert.NotEmpty(t, p.Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stat = tcping.Run(ctx, "127.0.0.1", udpPort, -1, time.Second)
+	assert.Equal(t, 1, stat.Sent)
+	assert.Equal(t, 0, stat.Received)
+}
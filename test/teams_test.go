@@ -0,0 +1,109 @@
+package test_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeams(t *testing.T) {
+	bodies := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	out, err := exec.Command(binaryCommand, cmd.CommandTeams, cmd.CommandText, "-u", server.URL, "-a", "disk full").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	body := <-bodies
+	assert.Equal(t, "message", body["type"])
+	card := body["attachments"].([]any)[0].(map[string]any)
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", card["contentType"])
+	element := card["content"].(map[string]any)["body"].([]any)[0].(map[string]any)
+	assert.Equal(t, "TextBlock", element["type"])
+	assert.Equal(t, "disk full", element["text"])
+
+	command := exec.Command(binaryCommand, cmd.CommandTeams, cmd.CommandText, "-u", server.URL, "-a", "-", "--format", "blocks")
+	command.Stdin = strings.NewReader(`[{"type":"TextBlock","text":"db1","weight":"Bolder"},{"type":"TextBlock","text":"disk full"}]`)
+	out, err = command.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	body = <-bodies
+	card = body["attachments"].([]any)[0].(map[string]any)
+	elements := card["content"].(map[string]any)["body"].([]any)
+	assert.Len(t, elements, 2)
+	assert.Equal(t, "Bolder", elements[0].(map[string]any)["weight"])
+}
+
+func TestTeamsRetry(t *testing.T) {
+	var mu sync.Mutex
+	var statuses []int
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		status := http.StatusAccepted
+		if len(statuses) != 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		if status == http.StatusAccepted {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			card := body["attachments"].([]any)[0].(map[string]any)
+			texts = append(texts, card["content"].(map[string]any)["body"].([]any)[0].(map[string]any)["text"].(string))
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	setStatuses := func(v ...int) {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses = v
+	}
+	outbox := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	/* Retry-After is honoured. */
+	setStatuses(http.StatusTooManyRequests)
+	start := time.Now()
+	out, err := exec.Command(binaryCommand, cmd.CommandTeams, cmd.CommandText, "-u", server.URL, "-a", "disk full").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, []string{"disk full"}, texts)
+
+	/* A message still failing after retries is queued, a client error is not. */
+	setStatuses(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusBadRequest)
+	out, _ = exec.Command(binaryCommand, cmd.CommandTeams, cmd.CommandText, "-u", server.URL, "-a", "db1 down",
+		"--retry", "1", "--retry-wait", "10ms", "--outbox", outbox).CombinedOutput()
+	assert.Contains(t, string(out), "queued into")
+	_, _ = exec.Command(binaryCommand, cmd.CommandTeams, cmd.CommandText, "-u", server.URL, "-a", "bad",
+		"--retry", "1", "--retry-wait", "10ms", "--outbox", outbox).CombinedOutput()
+	content, err := os.ReadFile(outbox)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "\n"))
+	assert.Contains(t, string(content), `"arg":"db1 down"`)
+
+	out, err = exec.Command(binaryCommand, cmd.CommandTeams, cmd.CommandFlush, "-u", server.URL, "--outbox", outbox, "--output", "json").Output()
+	assert.Nil(t, err)
+	var results []cmd.NotifyOutboxEntry
+	assert.Nil(t, json.Unmarshal(out, &results), string(out))
+	assert.Len(t, results, 1)
+	assert.Equal(t, "sent", results[0].Status)
+	assert.Equal(t, []string{"disk full", "db1 down"}, texts)
+	_, err = os.Stat(outbox)
+	assert.True(t, os.IsNotExist(err))
+}
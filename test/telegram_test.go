@@ -1,10 +1,18 @@
 package test_test
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os/exec"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestTelegramBinary(t *testing.T) {
@@ -15,3 +23,117 @@ func TestTelegramBinary(t *testing.T) {
 		}
 	})
 }
+
+/* fakeBotAPI serves getMe, getUpdates with updates once, and records sendMessage and editMessageText. */
+func fakeBotAPI(t *testing.T, updates []map[string]any) (*httptest.Server, chan url.Values) {
+	t.Helper()
+	sent := make(chan url.Values, 10)
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		var result any = true
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch method {
+		case "getMe":
+			result = map[string]any{"id": 1, "is_bot": true, "username": "opsbot"}
+		case "getUpdates":
+			result = []map[string]any{}
+			once.Do(func() { result = updates })
+			if len(result.([]map[string]any)) == 0 {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+		case "sendMessage", "editMessageText":
+			r.Form.Set("method", method)
+			sent <- r.Form
+			result = map[string]any{"message_id": 100, "date": 0, "chat": map[string]any{"id": 42, "type": "private"}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+	}))
+	return server, sent
+}
+
+func telegramUpdate(id int, chat int64, text string) map[string]any {
+	command := strings.Fields(text)[0]
+	return map[string]any{
+		"update_id": id,
+		"message": map[string]any{
+			"message_id": id * 10,
+			"date":       0,
+			"text":       text,
+			"chat":       map[string]any{"id": chat, "type": "private"},
+			"from":       map[string]any{"id": chat, "is_bot": false, "first_name": "oncall", "username": "oncall"},
+			"entities":   []map[string]any{{"type": "bot_command", "offset": 0, "length": len(command)}},
+		},
+	}
+}
+
+func TestTelegramBot(t *testing.T) {
+	server, sent := fakeBotAPI(t, []map[string]any{
+		telegramUpdate(1, 7, "/version"),
+		telegramUpdate(2, 42, "/version@opsbot"),
+		telegramUpdate(3, 42, "/rm -rf /"),
+		telegramUpdate(4, 42, "/version --config /etc/ops-cli.toml"),
+	})
+	defer server.Close()
+
+	bot := exec.Command(binaryCommand, cmd.CommandTelegram, cmd.CommandBot, "-t", "token", "--api", server.URL+"/bot%s/%s",
+		"--allow", "42", "--commands", cmd.CommandVersion)
+	assert.Nil(t, bot.Start())
+	defer func() {
+		_ = bot.Process.Kill()
+		_ = bot.Wait()
+	}()
+
+	replies := make(map[string]url.Values)
+	for range 3 {
+		select {
+		case v := <-sent:
+			replies[v.Get("reply_to_message_id")] = v
+		case <-time.After(30 * time.Second):
+			t.Fatal("no reply from bot")
+		}
+	}
+	assert.NotContains(t, replies, "10")
+	for _, v := range replies {
+		assert.Equal(t, "42", v.Get("chat_id"))
+		assert.Equal(t, "HTML", v.Get("parse_mode"))
+	}
+	assert.True(t, strings.HasPrefix(replies["20"].Get("text"), "<pre>"), replies["20"].Get("text"))
+	assert.Contains(t, replies["20"].Get("text"), "Copyright © 2022 ZeYanLin")
+	assert.Contains(t, replies["30"].Get("text"), "unknown command rm")
+	assert.Contains(t, replies["30"].Get("text"), "/version")
+	assert.Contains(t, replies["40"].Get("text"), "not allowed")
+}
+
+func TestTelegramReply(t *testing.T) {
+	server, sent := fakeBotAPI(t, nil)
+	defer server.Close()
+
+	api := server.URL + "/bot%s/%s"
+	out, err := exec.Command(binaryCommand, cmd.CommandTelegram, cmd.CommandText, "-t", "token", "-c", "42", "--api", api,
+		"--thread", "7", "-a", "backup started").Output()
+	assert.Nil(t, err)
+	var result cmd.NotifySent
+	assert.Nil(t, json.Unmarshal(out, &result), string(out))
+	assert.Equal(t, cmd.NotifySent{ID: "100", Channel: "42", Thread: "7"}, result)
+	v := <-sent
+	assert.Equal(t, "sendMessage", v.Get("method"))
+	assert.Equal(t, "7", v.Get("reply_to_message_id"))
+
+	out, err = exec.Command(binaryCommand, cmd.CommandTelegram, cmd.CommandText, "-t", "token", "-c", "42", "--api", api,
+		"--edit", "100", "--format", "plain", "-a", "backup finished").Output()
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), `"id": "100"`)
+	v = <-sent
+	assert.Equal(t, "editMessageText", v.Get("method"))
+	assert.Equal(t, "100", v.Get("message_id"))
+	assert.Equal(t, "backup finished", v.Get("text"))
+
+	out, _ = exec.Command(binaryCommand, cmd.CommandTelegram, cmd.CommandPhoto, "-t", "token", "-c", "42", "--api", api,
+		"--edit", "100", "-a", "telegram_test.go").CombinedOutput()
+	assert.Contains(t, string(out), "invalid")
+	assert.Empty(t, sent)
+}
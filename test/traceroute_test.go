@@ -1,10 +1,13 @@
 package test_test
 
 import (
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestTracerouteBinary(t *testing.T) {
@@ -15,3 +18,89 @@ func TestTracerouteBinary(t *testing.T) {
 		}
 	})
 }
+
+/* mmdbASN builds a one node IPv4 MaxMind DB, 128.0.0.0/1 maps to AS13335. */
+func mmdbASN(t *testing.T) string {
+	var data []byte
+	data = append(data, 0xe2)
+	data = append(data, 0x58)
+	data = append(data, "autonomous_system_number"...)
+	data = append(data, 0xc2, 0x34, 0x17)
+	data = append(data, 0x5d, 0x01)
+	data = append(data, "autonomous_system_organization"...)
+	data = append(data, 0x4d)
+	data = append(data, "CLOUDFLARENET"...)
+	return mmdbFile(t, data)
+}
+
+/* mmdbFile builds a one node IPv4 MaxMind DB, 128.0.0.0/1 maps to data. */
+func mmdbFile(t *testing.T, data []byte) string {
+	var b []byte
+	/* Search tree: left record is empty, right record points to data offset 0. */
+	b = append(b, 0x00, 0x00, 0x01, 0x00, 0x00, 0x11)
+	b = append(b, make([]byte, 16)...)
+	b = append(b, data...)
+	/* Metadata. */
+	b = append(b, "\xab\xcd\xefMaxMind.com"...)
+	b = append(b, 0xe4)
+	b = append(b, 0x4a)
+	b = append(b, "node_count"...)
+	b = append(b, 0xc1, 0x01)
+	b = append(b, 0x4b)
+	b = append(b, "record_size"...)
+	b = append(b, 0xa1, 0x18)
+	b = append(b, 0x4a)
+	b = append(b, "ip_version"...)
+	b = append(b, 0xa1, 0x04)
+	b = append(b, 0x4d)
+	b = append(b, "database_type"...)
+	b = append(b, 0x4c)
+	b = append(b, "GeoLite2-ASN"...)
+
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	if err := os.WriteFile(path, b, cmd.FileModeRAll); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTracerouteHopLookup(t *testing.T) {
+	tsv := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	content := "8.8.4.0\t8.8.4.255\t15169\tUS\tGOOGLE\n" +
+		"8.8.8.0\t8.8.8.255\t15169\tUS\tGOOGLE\n" +
+		"9.9.9.0\t9.9.9.255\t0\tNone\tNot routed\n"
+	if err := os.WriteFile(tsv, []byte(content), cmd.FileModeRAll); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		ip       string
+		expected cmd.HopInfo
+	}{
+		{"203.0.113.1", cmd.HopInfo{IP: "203.0.113.1", ASN: "13335", Org: "CLOUDFLARENET"}},
+		{"8.8.8.8", cmd.HopInfo{IP: "8.8.8.8", ASN: "15169", Org: "GOOGLE"}},
+		{"9.9.9.9", cmd.HopInfo{IP: "9.9.9.9"}},
+		{"192.168.1.1", cmd.HopInfo{IP: "192.168.1.1"}},
+	}
+	h := cmd.HopLookup{ASN: true, Databases: []string{mmdbASN(t), tsv}}
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.ip, func(t *testing.T) {
+			got := h.Resolve(testCase.ip)
+			assert.Equal(t, testCase.expected, got)
+			assert.Equal(t, testCase.expected, h.Get(testCase.ip))
+		})
+	}
+	assert.Equal(t, "AS13335 CLOUDFLARENET", h.Get("203.0.113.1").String())
+}
+
+/* TestTracerouteHopLookupLoop looks up a record pointing to itself, the lookup fails instead of running out of stack. */
+func TestTracerouteHopLookupLoop(t *testing.T) {
+	h := cmd.HopLookup{ASN: true, Databases: []string{mmdbFile(t, []byte{0x20, 0x00})}}
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, cmd.HopInfo{IP: "203.0.113.1"}, h.Resolve("203.0.113.1"))
+}
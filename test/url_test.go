@@ -1,10 +1,26 @@
 package test_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/linzeyan/ops-cli/cmd/common"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,3 +82,344 @@ func TestURLBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestURLClient(t *testing.T) {
+	var failures int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/basic", func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		fmt.Fprintf(w, "%s:%s %s", user, password, r.Header.Get("X-Test"))
+	})
+	mux.HandleFunc("/bearer", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	})
+	mux.HandleFunc("/digest", func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", nonce="abc", qop="auth", opaque="xyz"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		params := make(map[string]string)
+		for _, v := range strings.Split(strings.TrimPrefix(auth, "Digest "), ", ") {
+			k, v, _ := strings.Cut(v, "=")
+			params[k] = strings.Trim(v, `"`)
+		}
+		h := func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+		ha1 := h("user:test:password")
+		ha2 := h(r.Method + ":" + params["uri"])
+		expected := h(strings.Join([]string{ha1, "abc", params["nc"], params["cnonce"], "auth", ha2}, ":"))
+		if params["response"] != expected || params["opaque"] != "xyz" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "digest ok%s", b)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		b, _ := io.ReadAll(file)
+		fmt.Fprintf(w, "%s %s %s", r.FormValue("name"), header.Filename, b)
+	})
+	mux.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.FormValue("a")+r.FormValue("b"))
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+	mux.HandleFunc("/cookie", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err == nil {
+			fmt.Fprint(w, c.Value)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, _ *http.Request) {
+		if failures < 2 {
+			failures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+	var echoFailures int
+	mux.HandleFunc("/flaky-echo", func(w http.ResponseWriter, r *http.Request) {
+		if echoFailures < 1 {
+			echoFailures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.Copy(w, r.Body)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+	bodyFile := filepath.Join(dir, "body.json")
+	uploadFile := filepath.Join(dir, "upload.txt")
+	assert.Nil(t, os.WriteFile(bodyFile, []byte(`{"a":1}`), 0600))
+	assert.Nil(t, os.WriteFile(uploadFile, []byte("content"), 0600))
+
+	testCases := []struct {
+		path     string
+		config   common.HTTPConfig
+		expected string
+	}{
+		{"/basic", common.HTTPConfig{Method: http.MethodGet, Auth: "user:password", Headers: `{"X-Test":"1"}`}, "user:password 1"},
+		{"/bearer", common.HTTPConfig{Method: http.MethodGet, Auth: "token", AuthType: common.HTTPAuthBearer}, "Bearer token"},
+		{"/digest", common.HTTPConfig{Method: http.MethodGet, Auth: "user:password", AuthType: common.HTTPAuthDigest}, "digest ok"},
+		{"/upload", common.HTTPConfig{Method: http.MethodPost, Multipart: []string{"name=n", "file=@" + uploadFile}}, "n upload.txt content"},
+		{"/form", common.HTTPConfig{Method: http.MethodPost, Form: []string{"a=1", "b=2"}}, "12"},
+		{"/echo", common.HTTPConfig{Method: http.MethodPost, Body: "@" + bodyFile}, `{"a":1}`},
+		{"/flaky", common.HTTPConfig{Method: http.MethodGet, Retry: 2}, "ok"},
+	}
+	for _, v := range testCases {
+		t.Run(v.path, func(t *testing.T) {
+			got, err := common.HTTPRequestContent(server.URL+v.path, v.config)
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, string(got))
+		})
+	}
+
+	t.Run("cookie-jar", func(t *testing.T) {
+		config := common.HTTPConfig{Method: http.MethodGet, CookieJar: filepath.Join(dir, "cookies.json")}
+		got, err := common.HTTPRequestContent(server.URL+"/cookie", config)
+		assert.Nil(t, err)
+		assert.Empty(t, got)
+		got, err = common.HTTPRequestContent(server.URL+"/cookie", config)
+		assert.Nil(t, err)
+		assert.Equal(t, "s1", string(got))
+	})
+
+	/* Stdin is read once, retries and the answer of a digest challenge send the same body. */
+	t.Run("stdin", func(t *testing.T) {
+		stdin := os.Stdin
+		defer func() { os.Stdin = stdin }()
+		for _, v := range []struct {
+			path     string
+			config   common.HTTPConfig
+			expected string
+		}{
+			{"/flaky-echo", common.HTTPConfig{Method: http.MethodPost, Body: "@-", Retry: 1, RetryUnsafe: true}, "stdin"},
+			{"/digest", common.HTTPConfig{Method: http.MethodPost, Body: "@-", Auth: "user:password", AuthType: common.HTTPAuthDigest}, "digest okstdin"},
+		} {
+			f, err := os.CreateTemp(dir, "stdin")
+			assert.Nil(t, err)
+			_, _ = f.WriteString("stdin")
+			_, _ = f.Seek(0, io.SeekStart)
+			os.Stdin = f
+			got, err := common.HTTPRequestContent(server.URL+v.path, v.config)
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, string(got))
+			f.Close()
+		}
+	})
+
+	/* Only what may succeed next time is retried. */
+	t.Run("retry", func(t *testing.T) {
+		echoFailures = 0
+		got, err := common.HTTPRequestContent(server.URL+"/flaky-echo", common.HTTPConfig{Method: http.MethodPost, Body: "post", Retry: 1})
+		assert.Nil(t, err)
+		assert.Empty(t, got, "a POST is not sent again after 5xx")
+
+		tlsServer := httptest.NewTLSServer(mux)
+		defer tlsServer.Close()
+		startTime := time.Now()
+		_, err = common.HTTPRequestContent(tlsServer.URL+"/form", common.HTTPConfig{Method: http.MethodGet, Retry: 3})
+		assert.NotNil(t, err)
+		_, err = common.HTTPRequestContent("ftp://127.0.0.1/", common.HTTPConfig{Method: http.MethodGet, Retry: 3})
+		assert.NotNil(t, err)
+		assert.Less(t, time.Since(startTime), time.Second)
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			/* The first connection is closed without an answer. */
+			if conn, err := l.Accept(); err == nil {
+				conn.Close()
+			}
+			_ = http.Serve(l, mux)
+		}()
+		defer l.Close()
+		got, err = common.HTTPRequestContent("http://"+l.Addr().String()+"/form?a=1", common.HTTPConfig{Method: http.MethodGet, Retry: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "1", string(got))
+	})
+
+	t.Run("cacert", func(t *testing.T) {
+		tlsServer := httptest.NewTLSServer(mux)
+		defer tlsServer.Close()
+		_, err := common.HTTPRequestContent(tlsServer.URL+"/form", common.HTTPConfig{Method: http.MethodGet})
+		assert.NotNil(t, err)
+
+		caFile := filepath.Join(dir, "ca.pem")
+		pemBlock := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+		assert.Nil(t, os.WriteFile(caFile, pemBlock, 0600))
+		_, err = common.HTTPRequestContent(tlsServer.URL+"/form", common.HTTPConfig{Method: http.MethodGet, CACert: caFile})
+		assert.Nil(t, err)
+		_, err = common.HTTPRequestContent(tlsServer.URL+"/form", common.HTTPConfig{Method: http.MethodGet, Insecure: true})
+		assert.Nil(t, err)
+	})
+}
+
+func TestURLDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := fmt.Sprintf("%x", sha256.Sum256(content))
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	t.Run("single", func(t *testing.T) {
+		path := filepath.Join(dir, "single")
+		d := cmd.Downloader{SHA256: sum}
+		assert.Nil(t, d.Download(context.Background(), server.URL, path))
+		got, _ := os.ReadFile(path)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(dir, "parallel")
+		d := cmd.Downloader{Parallel: 4, SHA256: sum}
+		assert.Nil(t, d.Download(context.Background(), server.URL, path))
+		got, _ := os.ReadFile(path)
+		assert.Equal(t, content, got)
+		assert.Contains(t, ranges, "bytes=75000-99999")
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(dir, "resume")
+		assert.Nil(t, os.WriteFile(path+".part", content[:1234], 0600))
+		d := cmd.Downloader{SHA256: sum}
+		assert.Nil(t, d.Download(context.Background(), server.URL, path))
+		got, _ := os.ReadFile(path)
+		assert.Equal(t, content, got)
+		assert.Contains(t, ranges, "bytes=1234-")
+		_, err := os.Stat(path + ".part")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("parallel resume", func(t *testing.T) {
+		ranges = nil
+		path := filepath.Join(dir, "parallel-resume")
+		assert.Nil(t, os.WriteFile(path+".part", content[:1000], 0600))
+		assert.Nil(t, os.WriteFile(path+".part.25000-49999", content[25000:26000], 0600))
+		d := cmd.Downloader{Parallel: 4, SHA256: sum}
+		assert.Nil(t, d.Download(context.Background(), server.URL, path))
+		got, _ := os.ReadFile(path)
+		assert.Equal(t, content, got)
+		assert.Contains(t, ranges, "bytes=1000-24999")
+		assert.Contains(t, ranges, "bytes=26000-49999")
+		parts, _ := filepath.Glob(path + ".part*")
+		assert.Empty(t, parts)
+	})
+
+	t.Run("range not satisfiable", func(t *testing.T) {
+		path := filepath.Join(dir, "longer")
+		assert.Nil(t, os.WriteFile(path+".part", append(content, '0'), 0600))
+		d := cmd.Downloader{}
+		assert.ErrorIs(t, d.Download(context.Background(), server.URL, path), common.ErrStatusCode)
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	/* The file changed since the part was written, the part is not resumed. */
+	t.Run("changed", func(t *testing.T) {
+		var noHead bool
+		var ifRanges []string
+		changed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if noHead && r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			mu.Lock()
+			ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+			mu.Unlock()
+			w.Header().Set("ETag", `"v2"`)
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+		}))
+		defer changed.Close()
+		stale := bytes.Repeat([]byte("x"), 1234)
+
+		for _, v := range []struct {
+			name     string
+			parallel int
+			noHead   bool
+		}{{"single", 1, false}, {"parallel", 4, false}, {"if-range", 1, true}} {
+			t.Run(v.name, func(t *testing.T) {
+				noHead, ifRanges = v.noHead, nil
+				path := filepath.Join(dir, "changed-"+v.name)
+				assert.Nil(t, os.WriteFile(path+".part", stale, 0600))
+				assert.Nil(t, os.WriteFile(path+".part.meta", []byte(`"v1"`), 0600))
+				assert.Nil(t, os.WriteFile(path+".part.50000-74999", stale, 0600))
+				d := cmd.Downloader{Parallel: v.parallel, SHA256: sum}
+				assert.Nil(t, d.Download(context.Background(), changed.URL, path))
+				got, _ := os.ReadFile(path)
+				assert.Equal(t, content, got)
+				parts, _ := filepath.Glob(path + ".part*")
+				if v.parallel > 1 {
+					assert.Empty(t, parts)
+				}
+				assert.NotContains(t, parts, path+".part.meta")
+				if v.noHead {
+					assert.Contains(t, ifRanges, `"v1"`)
+				}
+			})
+		}
+
+		/* An unchanged file is resumed with If-Range. */
+		noHead, ifRanges = false, nil
+		path := filepath.Join(dir, "unchanged")
+		assert.Nil(t, os.WriteFile(path+".part", content[:1234], 0600))
+		assert.Nil(t, os.WriteFile(path+".part.meta", []byte(`"v2"`), 0600))
+		d := cmd.Downloader{SHA256: sum}
+		assert.Nil(t, d.Download(context.Background(), changed.URL, path))
+		got, _ := os.ReadFile(path)
+		assert.Equal(t, content, got)
+		assert.Contains(t, ifRanges, `"v2"`)
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		path := filepath.Join(dir, "checksum")
+		d := cmd.Downloader{SHA256: strings.Repeat("0", 64)}
+		err := d.Download(context.Background(), server.URL, path)
+		assert.ErrorIs(t, err, common.ErrChecksum)
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestURLDownloadTimeout(t *testing.T) {
+	/* The body takes longer than the timeout, which only limits the response headers of downloads. */
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		for range 5 {
+			_, _ = w.Write([]byte("0123456789"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "slow")
+	d := cmd.Downloader{Config: common.HTTPConfig{Timeout: 200 * time.Millisecond}}
+	assert.Nil(t, d.Download(context.Background(), server.URL, path))
+	got, _ := os.ReadFile(path)
+	assert.Equal(t, strings.Repeat("0123456789", 5), string(got))
+}
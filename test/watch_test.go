@@ -0,0 +1,172 @@
+package test_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+/* closedAddr returns an address of the loopback which refuses connections. */
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestWatch(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	state := filepath.Join(t.TempDir(), "watch.json")
+	newWatch := func(n cmd.Notifier) *cmd.Watch {
+		w := &cmd.Watch{
+			State: state,
+			Checks: []cmd.WatchCheck{
+				{Name: "web", Type: "HTTP", Target: server.URL, Status: http.StatusOK, Threshold: 2},
+				{Name: "db", Type: cmd.CommandTCPing, Target: closedAddr(t), Timeout: "1s"},
+			},
+			Notifiers: map[string]cmd.Notifier{"slack": n},
+		}
+		assert.Nil(t, w.Load())
+		return w
+	}
+	n := &fakeNotifier{}
+	w := newWatch(n)
+
+	results := w.Once(context.Background())
+	assert.Equal(t, "ok", results[0].Status)
+	assert.Equal(t, "fail", results[1].Status)
+	assert.Len(t, n.sent, 1)
+	assert.True(t, strings.HasPrefix(n.sent[0], "text:[FAIL] db: tcping 127.0.0.1:"), n.sent[0])
+
+	/* The second failure reaches the threshold of web, db stays FAIL without another message. */
+	status.Store(http.StatusServiceUnavailable)
+	w.Once(context.Background())
+	assert.Len(t, n.sent, 1)
+	w.Once(context.Background())
+	assert.Len(t, n.sent, 2)
+	assert.Equal(t, "text:[FAIL] web: http "+server.URL+": response error: status 503", n.sent[1])
+	assert.Equal(t, "fail", w.States()["web"].Status)
+
+	/* The state survives a restart, so the recovery is still reported. */
+	status.Store(http.StatusOK)
+	n = &fakeNotifier{}
+	w = newWatch(n)
+	w.Once(context.Background())
+	assert.Len(t, n.sent, 1)
+	assert.True(t, strings.HasPrefix(n.sent[0], "text:[OK] web recovered after "), n.sent[0])
+	assert.Equal(t, cmd.WatchState{Status: "ok", Since: w.States()["web"].Since}, w.States()["web"])
+
+	for _, v := range []*cmd.Watch{
+		{},
+		{Checks: []cmd.WatchCheck{{Type: "smtp", Target: "mail"}}},
+		{Checks: []cmd.WatchCheck{{Type: cmd.CommandTCPing, Target: "db1"}}},
+		{Checks: []cmd.WatchCheck{{Type: cmd.CommandDig, Target: "example.com", Record: "AAAAA"}}},
+		{Checks: []cmd.WatchCheck{{Type: cmd.CommandPing, Target: "db1", Interval: "soon"}}},
+		{Checks: []cmd.WatchCheck{{Type: cmd.CommandPing, Target: "db1"}, {Type: cmd.CommandPing, Target: "db1"}}},
+	} {
+		assert.NotNil(t, v.Load(), v.Checks)
+	}
+}
+
+func TestWatchBinary(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer server.Close()
+
+	addr := closedAddr(t)
+	config := filepath.Join(t.TempDir(), "checks.yaml")
+	assert.Nil(t, os.WriteFile(config, []byte(`watch:
+  notify: webhook
+  timeout: 2s
+  checks:
+    - name: db
+      type: tcping
+      target: `+addr+`
+webhook:
+  url: `+server.URL+`
+`), 0o600))
+
+	out, _ := exec.Command(binaryCommand, cmd.CommandWatch, "--once", "--config", config, "--output", "json").Output()
+	var results []cmd.WatchResult
+	assert.Nil(t, json.Unmarshal(out, &results), string(out))
+	assert.Len(t, results, 1)
+	assert.Equal(t, "fail", results[0].Status)
+	assert.Contains(t, <-bodies, "[FAIL] db: tcping "+addr)
+}
+
+func TestWatchTelegram(t *testing.T) {
+	server, sent := fakeBotAPI(t, nil)
+	defer server.Close()
+	config := filepath.Join(t.TempDir(), "checks.yaml")
+	assert.Nil(t, os.WriteFile(config, []byte(`watch:
+  notify: telegram
+  checks:
+    - name: web-1
+      type: http
+      target: http://`+closedAddr(t)+`/health.html
+telegram:
+  token: token
+  chat_id: "42"
+  api: `+server.URL+`/bot%s/%s
+`), 0o600))
+
+	/* MarkdownV2 rejects the unescaped brackets, dots and dashes of alerts, so they are sent as plain text. */
+	assert.Nil(t, exec.Command(binaryCommand, cmd.CommandWatch, "--once", "--config", config).Run())
+	select {
+	case form := <-sent:
+		assert.Contains(t, form.Get("text"), "[FAIL] web-1: http http://")
+		assert.Empty(t, form.Get("parse_mode"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert was sent")
+	}
+}
+
+func TestWatchTimeout(t *testing.T) {
+	/* The target accepts connections and never answers the TLS handshake. */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	_, err = new(cmd.Cert).CheckHost(ctx, l.Addr().String())
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(startTime), 2*time.Second)
+}
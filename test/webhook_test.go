@@ -0,0 +1,64 @@
+package test_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	type request struct {
+		method, auth, contentType, body string
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, auth: r.Header.Get("Authorization"), contentType: r.Header.Get("Content-Type")}
+		if file, _, err := r.FormFile("file"); err == nil {
+			b, _ := io.ReadAll(file)
+			req.body = string(b)
+		} else {
+			b, _ := io.ReadAll(r.Body)
+			req.body = string(b)
+		}
+		requests <- req
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	out, err := exec.Command(binaryCommand, cmd.CommandWebhook, cmd.CommandText, "-u", server.URL, "-a", `say "hi"`).CombinedOutput()
+	assert.Nil(t, err, string(out))
+	req := <-requests
+	assert.Equal(t, http.MethodPost, req.method)
+	assert.Equal(t, "application/json", req.contentType)
+	assert.Equal(t, `{"text":"say \"hi\""}`, req.body)
+
+	out, err = exec.Command(binaryCommand, cmd.CommandWebhook, cmd.CommandText, "-u", server.URL, "-X", http.MethodPut,
+		"-H", "Authorization: Bearer token", "--template", `{"content":{{json .Text}},"kind":"{{.Kind}}"}`, "-a", "disk full").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	req = <-requests
+	assert.Equal(t, http.MethodPut, req.method)
+	assert.Equal(t, "Bearer token", req.auth)
+	assert.Equal(t, `{"content":"disk full","kind":"text"}`, req.body)
+
+	/* A rendered body starting with @ is sent as is, not read from a file. */
+	out, err = exec.Command(binaryCommand, cmd.CommandWebhook, cmd.CommandText, "-u", server.URL,
+		"--template", "{{.Text}}", "-a", "@/etc/hostname").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	req = <-requests
+	assert.Equal(t, "@/etc/hostname", req.body)
+
+	file := filepath.Join(t.TempDir(), "report.csv")
+	assert.Nil(t, os.WriteFile(file, []byte("a,b\n1,2\n"), 0o600))
+	out, err = exec.Command(binaryCommand, cmd.CommandWebhook, cmd.CommandFile, "-u", server.URL, "-a", file, "--output", "json").CombinedOutput()
+	assert.Nil(t, err, string(out))
+	req = <-requests
+	assert.Equal(t, "a,b\n1,2\n", req.body)
+	assert.JSONEq(t, `{"ok":true}`, string(out))
+}
@@ -0,0 +1,93 @@
+package test_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/linzeyan/ops-cli/cmd"
+	"github.com/linzeyan/ops-cli/cmd/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWsping(t *testing.T) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"echo"},
+		CheckOrigin:  func(*http.Request) bool { return true },
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" || r.Header.Get("Origin") != "http://example.com" {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			typ, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = ws.WriteMessage(typ, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	uri := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	w := cmd.Wsping{URL: uri, Timeout: 2 * time.Second}
+	_, err := w.Dial(context.Background())
+	assert.NotNil(t, err)
+
+	w = cmd.Wsping{
+		URL:          uri,
+		Origin:       "http://example.com",
+		Subprotocols: []string{"echo"},
+		Timeout:      2 * time.Second,
+		Config:       common.HTTPConfig{Headers: `{"X-Token":"secret"}`},
+	}
+	if _, err = w.Dial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	assert.Equal(t, "echo", w.Conn.Subprotocol())
+
+	rtts := w.Run(context.Background(), 3, 10*time.Millisecond)
+	assert.Len(t, rtts, 3)
+
+	var out bytes.Buffer
+	assert.Nil(t, w.Interactive(context.Background(), strings.NewReader("hello\nworld\n"), &out))
+	assert.Equal(t, "hello\nworld\n", out.String())
+}
+
+/* TestWspingInteractiveTimeout waits for a close frame after stdin ends, the server never sends one. */
+func TestWspingInteractiveTimeout(t *testing.T) {
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	w := cmd.Wsping{URL: "ws" + strings.TrimPrefix(server.URL, "http"), Timeout: 200 * time.Millisecond}
+	if _, err := w.Dial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	startTime := time.Now()
+	assert.NotNil(t, w.Interactive(context.Background(), strings.NewReader("hello\n"), io.Discard))
+	assert.Less(t, time.Since(startTime), 2*time.Second)
+}